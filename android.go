@@ -0,0 +1,143 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AndroidMessagePriority is the delivery priority of a message sent to Android devices.
+type AndroidMessagePriority string
+
+const (
+	// AndroidMessagePriorityNormal is the default priority for data messages.
+	// Normal priority messages may be delayed while the device is in Doze mode.
+	AndroidMessagePriorityNormal AndroidMessagePriority = "normal"
+	// AndroidMessagePriorityHigh attempts to deliver the message immediately,
+	// waking a sleeping device if necessary.
+	AndroidMessagePriorityHigh AndroidMessagePriority = "high"
+)
+
+// maxAndroidTTL is the longest time FCM will store a message for an offline device.
+const maxAndroidTTL = 28 * 24 * time.Hour
+
+var (
+	packageNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*(\.[a-zA-Z][a-zA-Z0-9_]*)+$`)
+	durationPattern    = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,9})?s$`)
+)
+
+// AndroidConfig represents the Android specific options for messages sent through FCM.
+type AndroidConfig struct {
+	CollapseKey string                 `json:"collapse_key,omitempty"`
+	Priority    AndroidMessagePriority `json:"priority,omitempty"`
+	// TTL is how long the message is kept in storage if the device is offline.
+	// It is sent to FCM in the protobuf Duration format (e.g. "3.5s").
+	// A zero value leaves the field unset, in which case FCM uses its default of four weeks.
+	TTL time.Duration `json:"-"`
+	// RestrictedPackageName is the package name of the application which must match
+	// in order to receive the message.
+	RestrictedPackageName string             `json:"restricted_package_name,omitempty"`
+	Data                  map[string]string  `json:"data,omitempty"`
+	Notification          *Notification      `json:"notification,omitempty"`
+	FcmOptions            *AndroidFcmOptions `json:"fcm_options,omitempty"`
+	// DirectBootOk allows the message to be delivered to the app while the device
+	// is in direct boot mode, i.e. before the user has unlocked it after a restart.
+	DirectBootOk bool `json:"direct_boot_ok,omitempty"`
+	// BandwidthConstrainedOk allows the message to be delivered while the device
+	// is on a bandwidth constrained network.
+	BandwidthConstrainedOk bool `json:"bandwidth_constrained_ok,omitempty"`
+	// RestrictedSatelliteOk allows the message to be delivered while the device
+	// is connected to a restricted satellite network.
+	RestrictedSatelliteOk bool `json:"restricted_satellite_ok,omitempty"`
+}
+
+// androidConfig is used to marshal AndroidConfig without recursing into its MarshalJSON method.
+type androidConfig AndroidConfig
+
+// MarshalJSON encodes the config, converting TTL into the protobuf Duration format.
+func (a AndroidConfig) MarshalJSON() ([]byte, error) {
+	type wire struct {
+		androidConfig
+		TTL string `json:"ttl,omitempty"`
+	}
+	w := wire{androidConfig: androidConfig(a)}
+	if a.TTL != 0 {
+		w.TTL = formatDuration(a.TTL)
+	}
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes the config, parsing TTL from the protobuf Duration format.
+func (a *AndroidConfig) UnmarshalJSON(data []byte) error {
+	type wire struct {
+		*androidConfig
+		TTL string `json:"ttl,omitempty"`
+	}
+	w := wire{androidConfig: (*androidConfig)(a)}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	if w.TTL == "" {
+		return nil
+	}
+	ttl, err := parseDuration(w.TTL)
+	if err != nil {
+		return err
+	}
+	a.TTL = ttl
+	return nil
+}
+
+// Validate checks that the Android options are well formed.
+func (a *AndroidConfig) Validate() error {
+	switch a.Priority {
+	case "", AndroidMessagePriorityNormal, AndroidMessagePriorityHigh:
+	default:
+		return fmt.Errorf("android priority must be %q or %q, got %q",
+			AndroidMessagePriorityNormal, AndroidMessagePriorityHigh, a.Priority)
+	}
+	if a.TTL < 0 {
+		return fmt.Errorf("android ttl must not be negative")
+	}
+	if a.TTL > maxAndroidTTL {
+		return fmt.Errorf("android ttl must not be longer than 28 days")
+	}
+	if a.RestrictedPackageName != "" && !packageNamePattern.MatchString(a.RestrictedPackageName) {
+		return fmt.Errorf("restricted_package_name %q is not a valid Android package name", a.RestrictedPackageName)
+	}
+	if a.FcmOptions != nil {
+		return a.FcmOptions.Validate()
+	}
+	return nil
+}
+
+// formatDuration formats d in the protobuf Duration JSON format,
+// i.e. seconds with up to nine fractional digits followed by "s".
+func formatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	seconds := int64(d / time.Second)
+	nanos := int64(d % time.Second)
+	if nanos == 0 {
+		return fmt.Sprintf("%s%ds", sign, seconds)
+	}
+	fraction := strings.TrimRight(fmt.Sprintf("%09d", nanos), "0")
+	return fmt.Sprintf("%s%d.%ss", sign, seconds, fraction)
+}
+
+// parseDuration parses a protobuf Duration JSON string such as "3.5s".
+func parseDuration(s string) (time.Duration, error) {
+	if !durationPattern.MatchString(s) {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,118 @@
+package fcm
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAndroidConfig_MarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   AndroidConfig
+		expected string
+	}{
+		{
+			name:     "without ttl",
+			config:   AndroidConfig{Priority: AndroidMessagePriorityHigh},
+			expected: `{"priority":"high"}`,
+		},
+		{
+			name:     "with whole seconds ttl",
+			config:   AndroidConfig{TTL: time.Hour},
+			expected: `{"ttl":"3600s"}`,
+		},
+		{
+			name:     "with fractional ttl",
+			config:   AndroidConfig{TTL: 3500 * time.Millisecond},
+			expected: `{"ttl":"3.5s"}`,
+		},
+		{
+			name:     "with nanosecond ttl",
+			config:   AndroidConfig{TTL: time.Second + time.Nanosecond},
+			expected: `{"ttl":"1.000000001s"}`,
+		},
+		{
+			name: "with delivery options",
+			config: AndroidConfig{
+				DirectBootOk:           true,
+				BandwidthConstrainedOk: true,
+				RestrictedSatelliteOk:  true,
+			},
+			expected: `{"direct_boot_ok":true,"bandwidth_constrained_ok":true,"restricted_satellite_ok":true}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.config)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, data)
+			}
+		})
+	}
+}
+
+func TestAndroidConfig_UnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name        string
+		data        string
+		expectedTTL time.Duration
+		expectsErr  bool
+	}{
+		{name: "without ttl", data: `{"priority":"high"}`},
+		{name: "with fractional ttl", data: `{"ttl":"3.5s"}`, expectedTTL: 3500 * time.Millisecond},
+		{name: "with missing suffix", data: `{"ttl":"3600"}`, expectsErr: true},
+		{name: "with go duration", data: `{"ttl":"1h"}`, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var config AndroidConfig
+			err := json.Unmarshal([]byte(tc.data), &config)
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if config.TTL != tc.expectedTTL {
+				t.Errorf("expected ttl %v, got %v", tc.expectedTTL, config.TTL)
+			}
+		})
+	}
+}
+
+func TestAndroidConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     AndroidConfig
+		expectsErr bool
+	}{
+		{name: "empty config", config: AndroidConfig{}},
+		{name: "valid priority", config: AndroidConfig{Priority: AndroidMessagePriorityNormal}},
+		{name: "uppercase priority", config: AndroidConfig{Priority: "HIGH"}, expectsErr: true},
+		{name: "negative ttl", config: AndroidConfig{TTL: -time.Second}, expectsErr: true},
+		{name: "ttl longer than 28 days", config: AndroidConfig{TTL: 29 * 24 * time.Hour}, expectsErr: true},
+		{name: "valid package name", config: AndroidConfig{RestrictedPackageName: "com.example.app"}},
+		{name: "package name without dot", config: AndroidConfig{RestrictedPackageName: "example"}, expectsErr: true},
+		{name: "package name with invalid segment", config: AndroidConfig{RestrictedPackageName: "com.1example"}, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,658 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InterruptionLevel indicates the importance and delivery timing of an iOS notification (iOS 15+).
+type InterruptionLevel string
+
+const (
+	// InterruptionLevelPassive adds the notification to the list without lighting up the screen or playing a sound.
+	InterruptionLevelPassive InterruptionLevel = "passive"
+	// InterruptionLevelActive presents the notification immediately. This is the default.
+	InterruptionLevelActive InterruptionLevel = "active"
+	// InterruptionLevelTimeSensitive presents the notification immediately and may break through Focus modes.
+	InterruptionLevelTimeSensitive InterruptionLevel = "time-sensitive"
+	// InterruptionLevelCritical presents the notification immediately, bypassing the mute switch and Focus modes.
+	// It requires the critical alerts entitlement.
+	InterruptionLevelCritical InterruptionLevel = "critical"
+)
+
+// LiveActivityEvent is the action performed by a Live Activity notification.
+type LiveActivityEvent string
+
+const (
+	// LiveActivityEventStart starts a new Live Activity (push-to-start).
+	LiveActivityEventStart LiveActivityEvent = "start"
+	// LiveActivityEventUpdate updates the content state of a running Live Activity.
+	LiveActivityEventUpdate LiveActivityEvent = "update"
+	// LiveActivityEventEnd ends a running Live Activity.
+	LiveActivityEventEnd LiveActivityEvent = "end"
+)
+
+// APNAlert represents the alert dictionary of an APNs payload.
+type APNAlert struct {
+	Title           string   `json:"title,omitempty"`
+	Subtitle        string   `json:"subtitle,omitempty"`
+	Body            string   `json:"body,omitempty"`
+	LaunchImage     string   `json:"launch-image,omitempty"`
+	TitleLocKey     string   `json:"title-loc-key,omitempty"`
+	TitleLocArgs    []string `json:"title-loc-args,omitempty"`
+	SubtitleLocKey  string   `json:"subtitle-loc-key,omitempty"`
+	SubtitleLocArgs []string `json:"subtitle-loc-args,omitempty"`
+	LocKey          string   `json:"loc-key,omitempty"`
+	LocArgs         []string `json:"loc-args,omitempty"`
+	ActionLocKey    string   `json:"action-loc-key,omitempty"`
+}
+
+// CriticalSound represents the sound dictionary used for critical alerts.
+type CriticalSound struct {
+	// Critical marks the sound as a critical alert. It requires the critical alerts entitlement.
+	Critical bool `json:"-"`
+	// Name is the name of a sound file in the app bundle, or "default".
+	Name string `json:"name"`
+	// Volume is the volume of the critical alert, between 0 (silent) and 1 (full volume).
+	Volume float64 `json:"volume,omitempty"`
+}
+
+// MarshalJSON encodes the sound dictionary, sending Critical as 1 as required by Apple.
+func (c CriticalSound) MarshalJSON() ([]byte, error) {
+	type wire struct {
+		Critical int     `json:"critical,omitempty"`
+		Name     string  `json:"name"`
+		Volume   float64 `json:"volume,omitempty"`
+	}
+	return json.Marshal(wire{Critical: boolToInt(c.Critical), Name: c.Name, Volume: c.Volume})
+}
+
+// UnmarshalJSON decodes the sound dictionary.
+func (c *CriticalSound) UnmarshalJSON(data []byte) error {
+	var w struct {
+		Critical int     `json:"critical"`
+		Name     string  `json:"name"`
+		Volume   float64 `json:"volume"`
+	}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	*c = CriticalSound{Critical: w.Critical == 1, Name: w.Name, Volume: w.Volume}
+	return nil
+}
+
+// Aps represents the aps dictionary of an APNs payload.
+//
+// See https://developer.apple.com/documentation/usernotifications/generating-a-remote-notification
+// for the meaning of each key.
+type Aps struct {
+	// Alert is the alert dictionary. It takes precedence over AlertString.
+	Alert *APNAlert `json:"-"`
+	// AlertString is a plain alert body, used when no alert dictionary is required.
+	AlertString string `json:"-"`
+	// Badge is the number to display on the app icon. A pointer to zero clears the badge.
+	Badge *int `json:"-"`
+	// Sound is the name of a sound file in the app bundle, or "default".
+	Sound string `json:"-"`
+	// CriticalSound is the sound dictionary for critical alerts. It takes precedence over Sound.
+	CriticalSound *CriticalSound `json:"-"`
+	// ContentAvailable marks the notification as a background update.
+	ContentAvailable bool `json:"-"`
+	// MutableContent allows a notification service extension to modify the notification.
+	MutableContent    bool              `json:"-"`
+	Category          string            `json:"-"`
+	ThreadID          string            `json:"-"`
+	TargetContentID   string            `json:"-"`
+	InterruptionLevel InterruptionLevel `json:"-"`
+	// RelevanceScore is a value between 0 and 1 used to sort notifications in the summary.
+	RelevanceScore float64 `json:"-"`
+	// FilterCriteria is the criteria used to filter notifications by the current Focus.
+	FilterCriteria string `json:"-"`
+
+	// Event is the Live Activity action. Setting it makes this a Live Activity notification.
+	Event LiveActivityEvent `json:"-"`
+	// ContentState is the dynamic content of the Live Activity. It must match the
+	// ContentState type of the app's ActivityAttributes.
+	ContentState interface{} `json:"-"`
+	// Timestamp is the time the Live Activity content was generated. Apple discards
+	// updates older than the one currently displayed.
+	Timestamp time.Time `json:"-"`
+	// DismissalDate is the time an ended Live Activity is removed from the Lock Screen.
+	DismissalDate time.Time `json:"-"`
+	// StaleDate is the time the Live Activity content is considered outdated.
+	StaleDate time.Time `json:"-"`
+	// AttributesType is the name of the app's ActivityAttributes type, used with push-to-start.
+	AttributesType string `json:"-"`
+	// Attributes are the static attributes of the Live Activity, used with push-to-start.
+	Attributes interface{} `json:"-"`
+}
+
+// apsWire is the on-the-wire representation of Aps.
+type apsWire struct {
+	Alert             json.RawMessage   `json:"alert,omitempty"`
+	Badge             *int              `json:"badge,omitempty"`
+	Sound             json.RawMessage   `json:"sound,omitempty"`
+	ContentAvailable  int               `json:"content-available,omitempty"`
+	MutableContent    int               `json:"mutable-content,omitempty"`
+	Category          string            `json:"category,omitempty"`
+	ThreadID          string            `json:"thread-id,omitempty"`
+	TargetContentID   string            `json:"target-content-id,omitempty"`
+	InterruptionLevel InterruptionLevel `json:"interruption-level,omitempty"`
+	RelevanceScore    float64           `json:"relevance-score,omitempty"`
+	FilterCriteria    string            `json:"filter-criteria,omitempty"`
+	Event             LiveActivityEvent `json:"event,omitempty"`
+	ContentState      interface{}       `json:"content-state,omitempty"`
+	Timestamp         int64             `json:"timestamp,omitempty"`
+	DismissalDate     int64             `json:"dismissal-date,omitempty"`
+	StaleDate         int64             `json:"stale-date,omitempty"`
+	AttributesType    string            `json:"attributes-type,omitempty"`
+	Attributes        interface{}       `json:"attributes,omitempty"`
+}
+
+// MarshalJSON encodes the aps dictionary using the key names required by Apple.
+func (a Aps) MarshalJSON() ([]byte, error) {
+	w := apsWire{
+		Badge:             a.Badge,
+		ContentAvailable:  boolToInt(a.ContentAvailable),
+		MutableContent:    boolToInt(a.MutableContent),
+		Category:          a.Category,
+		ThreadID:          a.ThreadID,
+		TargetContentID:   a.TargetContentID,
+		InterruptionLevel: a.InterruptionLevel,
+		RelevanceScore:    a.RelevanceScore,
+		FilterCriteria:    a.FilterCriteria,
+		Event:             a.Event,
+		ContentState:      a.ContentState,
+		Timestamp:         unixOrZero(a.Timestamp),
+		DismissalDate:     unixOrZero(a.DismissalDate),
+		StaleDate:         unixOrZero(a.StaleDate),
+		AttributesType:    a.AttributesType,
+		Attributes:        a.Attributes,
+	}
+
+	var err error
+	switch {
+	case a.Alert != nil:
+		w.Alert, err = json.Marshal(a.Alert)
+	case a.AlertString != "":
+		w.Alert, err = json.Marshal(a.AlertString)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case a.CriticalSound != nil:
+		w.Sound, err = json.Marshal(a.CriticalSound)
+	case a.Sound != "":
+		w.Sound, err = json.Marshal(a.Sound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes the aps dictionary, accepting both the string and dictionary forms
+// of alert and sound.
+func (a *Aps) UnmarshalJSON(data []byte) error {
+	var w apsWire
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+
+	*a = Aps{
+		Badge:             w.Badge,
+		ContentAvailable:  w.ContentAvailable == 1,
+		MutableContent:    w.MutableContent == 1,
+		Category:          w.Category,
+		ThreadID:          w.ThreadID,
+		TargetContentID:   w.TargetContentID,
+		InterruptionLevel: w.InterruptionLevel,
+		RelevanceScore:    w.RelevanceScore,
+		FilterCriteria:    w.FilterCriteria,
+		Event:             w.Event,
+		ContentState:      w.ContentState,
+		Timestamp:         timeOrZero(w.Timestamp),
+		DismissalDate:     timeOrZero(w.DismissalDate),
+		StaleDate:         timeOrZero(w.StaleDate),
+		AttributesType:    w.AttributesType,
+		Attributes:        w.Attributes,
+	}
+
+	if isJSONObject(w.Alert) {
+		a.Alert = &APNAlert{}
+		if err := json.Unmarshal(w.Alert, a.Alert); err != nil {
+			return err
+		}
+	} else if len(w.Alert) > 0 {
+		if err := json.Unmarshal(w.Alert, &a.AlertString); err != nil {
+			return err
+		}
+	}
+
+	if isJSONObject(w.Sound) {
+		a.CriticalSound = &CriticalSound{}
+		if err := json.Unmarshal(w.Sound, a.CriticalSound); err != nil {
+			return err
+		}
+	} else if len(w.Sound) > 0 {
+		if err := json.Unmarshal(w.Sound, &a.Sound); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the aps dictionary is well formed.
+func (a *Aps) Validate() error {
+	switch a.InterruptionLevel {
+	case "", InterruptionLevelPassive, InterruptionLevelActive, InterruptionLevelTimeSensitive, InterruptionLevelCritical:
+	default:
+		return fmt.Errorf("unknown interruption-level %q", a.InterruptionLevel)
+	}
+	if a.RelevanceScore < 0 || a.RelevanceScore > 1 {
+		return fmt.Errorf("relevance-score must be between 0 and 1")
+	}
+	if a.CriticalSound != nil {
+		if a.CriticalSound.Name == "" {
+			return fmt.Errorf("sound name is required")
+		}
+		if a.CriticalSound.Volume < 0 || a.CriticalSound.Volume > 1 {
+			return fmt.Errorf("sound volume must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// APNSPayload represents the payload of an APNs message.
+type APNSPayload struct {
+	Aps *Aps `json:"aps,omitempty"`
+	// CustomData holds app specific keys sent at the top level of the payload, alongside aps.
+	CustomData map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON encodes the payload, merging CustomData into the top level object.
+func (p APNSPayload) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(p.CustomData)+1)
+	for k, v := range p.CustomData {
+		fields[k] = v
+	}
+	if p.Aps != nil {
+		fields["aps"] = p.Aps
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON decodes the payload, collecting every key other than aps into CustomData.
+func (p *APNSPayload) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*p = APNSPayload{}
+	for k, v := range fields {
+		if k == "aps" {
+			p.Aps = &Aps{}
+			if err := json.Unmarshal(v, p.Aps); err != nil {
+				return err
+			}
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(v, &value); err != nil {
+			return err
+		}
+		if p.CustomData == nil {
+			p.CustomData = make(map[string]interface{})
+		}
+		p.CustomData[k] = value
+	}
+	return nil
+}
+
+// Validate checks that the payload is well formed.
+func (p *APNSPayload) Validate() error {
+	if _, ok := p.CustomData["aps"]; ok {
+		return fmt.Errorf("custom data must not contain the reserved key \"aps\"")
+	}
+	if p.Aps == nil {
+		return nil
+	}
+	return p.Aps.Validate()
+}
+
+// APNSPriority is the value of the apns-priority header.
+type APNSPriority int
+
+const (
+	// APNSPriorityLow prioritizes the device's power considerations over all other factors.
+	APNSPriorityLow APNSPriority = 1
+	// APNSPriorityNormal sends the notification based on power considerations on the device.
+	// It is required for background notifications.
+	APNSPriorityNormal APNSPriority = 5
+	// APNSPriorityHigh sends the notification immediately.
+	APNSPriorityHigh APNSPriority = 10
+)
+
+// APNSPushType is the value of the apns-push-type header.
+type APNSPushType string
+
+const (
+	// APNSPushTypeAlert is used for notifications that display an alert, play a sound or badge the icon.
+	APNSPushTypeAlert APNSPushType = "alert"
+	// APNSPushTypeBackground is used for content-available notifications that deliver content in the background.
+	APNSPushTypeBackground APNSPushType = "background"
+	// APNSPushTypeVoIP is used for PushKit VoIP notifications.
+	APNSPushTypeVoIP APNSPushType = "voip"
+	// APNSPushTypeLiveActivity is used for ActivityKit Live Activity updates.
+	APNSPushTypeLiveActivity APNSPushType = "liveactivity"
+	// APNSPushTypeLocation is used for location query notifications.
+	APNSPushTypeLocation APNSPushType = "location"
+	// APNSPushTypeComplication is used for watchOS complication updates.
+	APNSPushTypeComplication APNSPushType = "complication"
+	// APNSPushTypeFileProvider is used to signal changes to a File Provider extension.
+	APNSPushTypeFileProvider APNSPushType = "fileprovider"
+	// APNSPushTypeMDM is used for mobile device management notifications.
+	APNSPushTypeMDM APNSPushType = "mdm"
+	// APNSPushTypePushToTalk is used for Push to Talk notifications.
+	APNSPushTypePushToTalk APNSPushType = "pushtotalk"
+	// APNSPushTypeWidgets is used to reload widgets.
+	APNSPushTypeWidgets APNSPushType = "widgets"
+)
+
+// topicSuffix returns the suffix Apple requires on apns-topic for the push type, if any.
+func (t APNSPushType) topicSuffix() string {
+	switch t {
+	case APNSPushTypeVoIP:
+		return ".voip"
+	case APNSPushTypeLiveActivity:
+		return ".push-type.liveactivity"
+	case APNSPushTypeLocation:
+		return ".location-query"
+	case APNSPushTypeComplication:
+		return ".complication"
+	case APNSPushTypeFileProvider:
+		return ".pushkit.fileprovider"
+	case APNSPushTypePushToTalk:
+		return ".voip-ptt"
+	}
+	return ""
+}
+
+const (
+	headerAPNSPriority   = "apns-priority"
+	headerAPNSPushType   = "apns-push-type"
+	headerAPNSExpiration = "apns-expiration"
+	headerAPNSCollapseID = "apns-collapse-id"
+	headerAPNSTopic      = "apns-topic"
+
+	maxAPNSCollapseIDLength = 64
+)
+
+// APNSConfig represents the APNs specific options for messages sent through FCM.
+type APNSConfig struct {
+	// Priority is sent as the apns-priority header.
+	Priority APNSPriority `json:"-"`
+	// PushType is sent as the apns-push-type header.
+	PushType APNSPushType `json:"-"`
+	// Expiration is sent as the apns-expiration header. A zero value leaves the header unset, so
+	// that APNs applies its default storage policy; use ExpireImmediately to send an expiration of 0.
+	Expiration time.Time `json:"-"`
+	// ExpireImmediately sends an apns-expiration header of 0: APNs attempts to deliver the
+	// notification once and does not store it if the device is offline. It must not be combined
+	// with Expiration.
+	ExpireImmediately bool `json:"-"`
+	// CollapseID is sent as the apns-collapse-id header.
+	CollapseID string `json:"-"`
+	// Topic is sent as the apns-topic header. It is usually the bundle ID of the app.
+	Topic string `json:"-"`
+	// LiveActivityToken is the ActivityKit push token used to update a Live Activity.
+	// When set, the message is delivered to the Live Activity instead of the device token.
+	LiveActivityToken string `json:"live_activity_token,omitempty"`
+	// Headers holds any additional APNs headers. The typed fields above take precedence.
+	Headers    map[string]string `json:"headers,omitempty"`
+	Payload    *APNSPayload      `json:"payload,omitempty"`
+	FcmOptions *APNSFcmOptions   `json:"fcm_options,omitempty"`
+}
+
+// apnsConfig is used to marshal APNSConfig without recursing into its MarshalJSON method.
+type apnsConfig APNSConfig
+
+// MarshalJSON encodes the config, merging the typed header fields into Headers.
+func (c APNSConfig) MarshalJSON() ([]byte, error) {
+	w := apnsConfig(c)
+	w.Headers = c.headers()
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes the config, moving well-known headers into their typed fields.
+func (c *APNSConfig) UnmarshalJSON(data []byte) error {
+	var w apnsConfig
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+
+	headers := make(map[string]string, len(w.Headers))
+	for k, v := range w.Headers {
+		switch strings.ToLower(k) {
+		case headerAPNSPriority:
+			priority, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s header %q", headerAPNSPriority, v)
+			}
+			w.Priority = APNSPriority(priority)
+		case headerAPNSPushType:
+			w.PushType = APNSPushType(v)
+		case headerAPNSExpiration:
+			expiration, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s header %q", headerAPNSExpiration, v)
+			}
+			if expiration == 0 {
+				w.ExpireImmediately = true
+			} else {
+				w.Expiration = time.Unix(expiration, 0)
+			}
+		case headerAPNSCollapseID:
+			w.CollapseID = v
+		case headerAPNSTopic:
+			w.Topic = v
+		default:
+			headers[k] = v
+		}
+	}
+	w.Headers = nil
+	if len(headers) > 0 {
+		w.Headers = headers
+	}
+
+	*c = APNSConfig(w)
+	return nil
+}
+
+// headers returns Headers with the typed header fields applied.
+func (c *APNSConfig) headers() map[string]string {
+	headers := make(map[string]string, len(c.Headers)+5)
+	for k, v := range c.Headers {
+		headers[k] = v
+	}
+	if c.Priority != 0 {
+		headers[headerAPNSPriority] = strconv.Itoa(int(c.Priority))
+	}
+	if c.PushType != "" {
+		headers[headerAPNSPushType] = string(c.PushType)
+	}
+	if c.ExpireImmediately {
+		headers[headerAPNSExpiration] = "0"
+	} else if !c.Expiration.IsZero() {
+		headers[headerAPNSExpiration] = strconv.FormatInt(c.Expiration.Unix(), 10)
+	}
+	if c.CollapseID != "" {
+		headers[headerAPNSCollapseID] = c.CollapseID
+	}
+	if c.Topic != "" {
+		headers[headerAPNSTopic] = c.Topic
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// Validate checks that the APNs options are well formed and consistent with Apple's requirements.
+func (c *APNSConfig) Validate() error {
+	for k := range c.Headers {
+		switch strings.ToLower(k) {
+		case headerAPNSPriority, headerAPNSPushType, headerAPNSExpiration, headerAPNSCollapseID, headerAPNSTopic:
+			return fmt.Errorf("%s header must be set through its typed field", k)
+		}
+	}
+
+	switch c.Priority {
+	case 0, APNSPriorityLow, APNSPriorityNormal, APNSPriorityHigh:
+	default:
+		return fmt.Errorf("apns-priority must be 1, 5 or 10, got %d", c.Priority)
+	}
+
+	switch c.PushType {
+	case "", APNSPushTypeAlert, APNSPushTypeBackground, APNSPushTypeVoIP, APNSPushTypeLiveActivity,
+		APNSPushTypeLocation, APNSPushTypeComplication, APNSPushTypeFileProvider, APNSPushTypeMDM,
+		APNSPushTypePushToTalk, APNSPushTypeWidgets:
+	default:
+		return fmt.Errorf("unknown apns-push-type %q", c.PushType)
+	}
+
+	if c.ExpireImmediately && !c.Expiration.IsZero() {
+		return fmt.Errorf("apns-expiration must be set through either Expiration or ExpireImmediately")
+	}
+
+	if len(c.CollapseID) > maxAPNSCollapseIDLength {
+		return fmt.Errorf("apns-collapse-id must not be longer than %d bytes", maxAPNSCollapseIDLength)
+	}
+
+	if suffix := c.PushType.topicSuffix(); suffix != "" && c.Topic != "" && !strings.HasSuffix(c.Topic, suffix) {
+		return fmt.Errorf("apns-topic for push type %q must end with %q", c.PushType, suffix)
+	}
+
+	// APNs delivers notifications without an apns-priority header with priority 10.
+	highPriority := c.Priority == 0 || c.Priority == APNSPriorityHigh
+
+	aps := c.aps()
+	if c.PushType == APNSPushTypeBackground {
+		if !aps.ContentAvailable {
+			return fmt.Errorf("background notifications must set content-available")
+		}
+		if aps.hasUserInteraction() {
+			return fmt.Errorf("background notifications must not contain alert, sound or badge")
+		}
+		if highPriority {
+			return fmt.Errorf("background notifications must use apns-priority 5 or lower")
+		}
+	}
+	if highPriority && aps.ContentAvailable && !aps.hasUserInteraction() {
+		return fmt.Errorf("content-available only notifications must use apns-priority 5 or lower")
+	}
+
+	if err := c.validateLiveActivity(); err != nil {
+		return err
+	}
+
+	if c.FcmOptions != nil {
+		if err := c.FcmOptions.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Payload == nil {
+		return nil
+	}
+	return c.Payload.Validate()
+}
+
+// aps returns the aps dictionary of the payload, or an empty one if it is not set.
+func (c *APNSConfig) aps() *Aps {
+	if c.Payload == nil || c.Payload.Aps == nil {
+		return &Aps{}
+	}
+	return c.Payload.Aps
+}
+
+// validateLiveActivity checks the headers and payload of Live Activity notifications.
+func (c *APNSConfig) validateLiveActivity() error {
+	aps := c.aps()
+	if aps.Event == "" && c.LiveActivityToken == "" && c.PushType != APNSPushTypeLiveActivity {
+		return nil
+	}
+
+	if c.PushType != APNSPushTypeLiveActivity {
+		return fmt.Errorf("live activity notifications must use apns-push-type %q", APNSPushTypeLiveActivity)
+	}
+	if suffix := APNSPushTypeLiveActivity.topicSuffix(); !strings.HasSuffix(c.Topic, suffix) {
+		return fmt.Errorf("live activity notifications must set apns-topic to the bundle ID followed by %q", suffix)
+	}
+
+	switch aps.Event {
+	case LiveActivityEventStart:
+		if aps.AttributesType == "" || aps.Attributes == nil {
+			return fmt.Errorf("live activity start events require attributes-type and attributes")
+		}
+	case LiveActivityEventUpdate, LiveActivityEventEnd:
+		if aps.AttributesType != "" || aps.Attributes != nil {
+			return fmt.Errorf("attributes-type and attributes are only allowed on live activity start events")
+		}
+	case "":
+		return fmt.Errorf("live activity notifications require an event")
+	default:
+		return fmt.Errorf("unknown live activity event %q", aps.Event)
+	}
+	if aps.Event != LiveActivityEventEnd && aps.ContentState == nil {
+		return fmt.Errorf("live activity %s events require content-state", aps.Event)
+	}
+	if aps.Timestamp.IsZero() {
+		return fmt.Errorf("live activity notifications require a timestamp")
+	}
+	if !aps.DismissalDate.IsZero() && aps.Event != LiveActivityEventEnd {
+		return fmt.Errorf("dismissal-date is only allowed on live activity end events")
+	}
+
+	return nil
+}
+
+// hasUserInteraction reports whether the aps dictionary alerts the user.
+func (a *Aps) hasUserInteraction() bool {
+	return a.Alert != nil || a.AlertString != "" || a.Sound != "" || a.CriticalSound != nil || a.Badge != nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrZero(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+func isJSONObject(data json.RawMessage) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
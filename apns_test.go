@@ -0,0 +1,349 @@
+package fcm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAps_MarshalJSON(t *testing.T) {
+	zero := 0
+	testCases := []struct {
+		name     string
+		aps      Aps
+		expected string
+	}{
+		{
+			name:     "empty",
+			aps:      Aps{},
+			expected: `{}`,
+		},
+		{
+			name:     "background update",
+			aps:      Aps{ContentAvailable: true},
+			expected: `{"content-available":1}`,
+		},
+		{
+			name:     "clear badge",
+			aps:      Aps{Badge: &zero},
+			expected: `{"badge":0}`,
+		},
+		{
+			name:     "alert string",
+			aps:      Aps{AlertString: "Hello", Sound: "default"},
+			expected: `{"alert":"Hello","sound":"default"}`,
+		},
+		{
+			name: "alert dictionary with loc args",
+			aps: Aps{
+				Alert:          &APNAlert{LocKey: "GREETING", LocArgs: []string{"Jane", "3"}},
+				MutableContent: true,
+				ThreadID:       "chat-1",
+			},
+			expected: `{"alert":{"loc-key":"GREETING","loc-args":["Jane","3"]},"mutable-content":1,"thread-id":"chat-1"}`,
+		},
+		{
+			name: "critical alert",
+			aps: Aps{
+				CriticalSound:     &CriticalSound{Critical: true, Name: "alarm.caf", Volume: 0.5},
+				InterruptionLevel: InterruptionLevelCritical,
+				RelevanceScore:    0.75,
+				TargetContentID:   "window-1",
+				FilterCriteria:    "work",
+			},
+			expected: `{"sound":{"critical":1,"name":"alarm.caf","volume":0.5},"target-content-id":"window-1",` +
+				`"interruption-level":"critical","relevance-score":0.75,"filter-criteria":"work"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.aps)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, data)
+			}
+
+			var decoded Aps
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tc.aps) {
+				t.Errorf("expected round trip to produce %+v, got %+v", tc.aps, decoded)
+			}
+		})
+	}
+}
+
+func TestAps_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		aps        Aps
+		expectsErr bool
+	}{
+		{name: "empty", aps: Aps{}},
+		{name: "valid interruption level", aps: Aps{InterruptionLevel: InterruptionLevelTimeSensitive}},
+		{name: "unknown interruption level", aps: Aps{InterruptionLevel: "urgent"}, expectsErr: true},
+		{name: "relevance score out of range", aps: Aps{RelevanceScore: 1.5}, expectsErr: true},
+		{name: "critical sound without name", aps: Aps{CriticalSound: &CriticalSound{Critical: true}}, expectsErr: true},
+		{name: "critical sound volume out of range", aps: Aps{CriticalSound: &CriticalSound{Name: "default", Volume: 2}}, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.aps.Validate()
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAPNSPayload_CustomData(t *testing.T) {
+	payload := APNSPayload{
+		Aps:        &Aps{ContentAvailable: true},
+		CustomData: map[string]interface{}{"order_id": "42"},
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"aps":{"content-available":1},"order_id":"42"}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var decoded APNSPayload
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(decoded, payload) {
+		t.Errorf("expected round trip to produce %+v, got %+v", payload, decoded)
+	}
+
+	payload.CustomData["aps"] = "oops"
+	if err := payload.Validate(); err == nil {
+		t.Error("expected error for reserved key, got nil")
+	}
+}
+
+func TestAPNSConfig_MarshalJSON(t *testing.T) {
+	config := APNSConfig{
+		Priority:   APNSPriorityNormal,
+		PushType:   APNSPushTypeBackground,
+		Expiration: time.Unix(1700000000, 0),
+		CollapseID: "score",
+		Topic:      "com.example.app",
+		Headers:    map[string]string{"apns-id": "123e4567-e89b-12d3-a456-4266554400a0"},
+		Payload:    &APNSPayload{Aps: &Aps{ContentAvailable: true}},
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"headers":{"apns-collapse-id":"score","apns-expiration":"1700000000",` +
+		`"apns-id":"123e4567-e89b-12d3-a456-4266554400a0","apns-priority":"5",` +
+		`"apns-push-type":"background","apns-topic":"com.example.app"},"payload":{"aps":{"content-available":1}}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var decoded APNSConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !decoded.Expiration.Equal(config.Expiration) {
+		t.Errorf("expected expiration %v, got %v", config.Expiration, decoded.Expiration)
+	}
+	decoded.Expiration = config.Expiration
+	if !reflect.DeepEqual(decoded, config) {
+		t.Errorf("expected round trip to produce %+v, got %+v", config, decoded)
+	}
+}
+
+func TestAPNSConfig_ExpireImmediately(t *testing.T) {
+	config := APNSConfig{ExpireImmediately: true}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected := `{"headers":{"apns-expiration":"0"}}`; string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var decoded APNSConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !decoded.ExpireImmediately || !decoded.Expiration.IsZero() {
+		t.Errorf("expected an immediate expiration, got %+v", decoded)
+	}
+}
+
+func TestAPNSConfig_Validate(t *testing.T) {
+	background := &APNSPayload{Aps: &Aps{ContentAvailable: true}}
+	alert := &APNSPayload{Aps: &Aps{AlertString: "Hello"}}
+
+	testCases := []struct {
+		name       string
+		config     APNSConfig
+		expectsErr bool
+	}{
+		{name: "empty", config: APNSConfig{}},
+		{name: "alert", config: APNSConfig{PushType: APNSPushTypeAlert, Priority: APNSPriorityHigh, Payload: alert}},
+		{name: "invalid priority", config: APNSConfig{Priority: 7}, expectsErr: true},
+		{name: "unknown push type", config: APNSConfig{PushType: "silent"}, expectsErr: true},
+		{name: "typed header in headers map", config: APNSConfig{Headers: map[string]string{"apns-priority": "10"}}, expectsErr: true},
+		{name: "expire immediately", config: APNSConfig{ExpireImmediately: true}},
+		{
+			name:       "expire immediately with expiration",
+			config:     APNSConfig{ExpireImmediately: true, Expiration: time.Unix(1700000000, 0)},
+			expectsErr: true,
+		},
+		{name: "collapse id too long", config: APNSConfig{CollapseID: strings.Repeat("a", 65)}, expectsErr: true},
+		{
+			name:   "background",
+			config: APNSConfig{PushType: APNSPushTypeBackground, Priority: APNSPriorityNormal, Payload: background},
+		},
+		{
+			name:       "background with default priority",
+			config:     APNSConfig{PushType: APNSPushTypeBackground, Payload: background},
+			expectsErr: true,
+		},
+		{
+			name:       "background without content-available",
+			config:     APNSConfig{PushType: APNSPushTypeBackground, Priority: APNSPriorityNormal},
+			expectsErr: true,
+		},
+		{
+			name: "background with alert",
+			config: APNSConfig{
+				PushType: APNSPushTypeBackground,
+				Priority: APNSPriorityNormal,
+				Payload:  &APNSPayload{Aps: &Aps{ContentAvailable: true, AlertString: "Hello"}},
+			},
+			expectsErr: true,
+		},
+		{
+			name:       "content-available only with high priority",
+			config:     APNSConfig{Priority: APNSPriorityHigh, Payload: background},
+			expectsErr: true,
+		},
+		{
+			name:   "voip topic",
+			config: APNSConfig{PushType: APNSPushTypeVoIP, Topic: "com.example.app.voip"},
+		},
+		{
+			name:       "voip topic without suffix",
+			config:     APNSConfig{PushType: APNSPushTypeVoIP, Topic: "com.example.app"},
+			expectsErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAPNSConfig_LiveActivity(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	update := func() APNSConfig {
+		return APNSConfig{
+			PushType:          APNSPushTypeLiveActivity,
+			Topic:             "com.example.app.push-type.liveactivity",
+			LiveActivityToken: "activity-token",
+			Payload: &APNSPayload{Aps: &Aps{
+				Event:        LiveActivityEventUpdate,
+				ContentState: map[string]interface{}{"status": "out_for_delivery"},
+				Timestamp:    now,
+				StaleDate:    now.Add(time.Hour),
+			}},
+		}
+	}
+
+	data, err := json.Marshal(update())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"live_activity_token":"activity-token","headers":{"apns-push-type":"liveactivity",` +
+		`"apns-topic":"com.example.app.push-type.liveactivity"},"payload":{"aps":{"event":"update",` +
+		`"content-state":{"status":"out_for_delivery"},"timestamp":1700000000,"stale-date":1700003600}}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	testCases := []struct {
+		name       string
+		modify     func(c *APNSConfig)
+		expectsErr bool
+	}{
+		{name: "valid update", modify: func(c *APNSConfig) {}},
+		{name: "missing push type", modify: func(c *APNSConfig) { c.PushType = "" }, expectsErr: true},
+		{name: "wrong topic suffix", modify: func(c *APNSConfig) { c.Topic = "com.example.app" }, expectsErr: true},
+		{name: "missing event", modify: func(c *APNSConfig) { c.Payload.Aps.Event = "" }, expectsErr: true},
+		{name: "unknown event", modify: func(c *APNSConfig) { c.Payload.Aps.Event = "pause" }, expectsErr: true},
+		{name: "missing content state", modify: func(c *APNSConfig) { c.Payload.Aps.ContentState = nil }, expectsErr: true},
+		{name: "missing timestamp", modify: func(c *APNSConfig) { c.Payload.Aps.Timestamp = time.Time{} }, expectsErr: true},
+		{
+			name:       "attributes on update",
+			modify:     func(c *APNSConfig) { c.Payload.Aps.AttributesType = "OrderAttributes" },
+			expectsErr: true,
+		},
+		{
+			name:       "dismissal date on update",
+			modify:     func(c *APNSConfig) { c.Payload.Aps.DismissalDate = now },
+			expectsErr: true,
+		},
+		{
+			name: "end with dismissal date",
+			modify: func(c *APNSConfig) {
+				c.Payload.Aps.Event = LiveActivityEventEnd
+				c.Payload.Aps.ContentState = nil
+				c.Payload.Aps.DismissalDate = now.Add(time.Hour)
+			},
+		},
+		{
+			name: "push to start",
+			modify: func(c *APNSConfig) {
+				c.LiveActivityToken = ""
+				c.Payload.Aps.Event = LiveActivityEventStart
+				c.Payload.Aps.AttributesType = "OrderAttributes"
+				c.Payload.Aps.Attributes = map[string]interface{}{"order_id": "42"}
+				c.Payload.Aps.Alert = &APNAlert{Title: "Order placed", Body: "We'll keep you posted"}
+			},
+		},
+		{
+			name:       "push to start without attributes",
+			modify:     func(c *APNSConfig) { c.Payload.Aps.Event = LiveActivityEventStart },
+			expectsErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := update()
+			tc.modify(&config)
+			err := config.Validate()
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
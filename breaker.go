@@ -0,0 +1,263 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the FCM server while the circuit breaker of the client is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Defaults of the CircuitBreaker settings.
+const (
+	DefaultCircuitFailureRatio     = 0.5
+	DefaultCircuitMinRequests      = 20
+	DefaultCircuitWindow           = 10 * time.Second
+	DefaultCircuitOpenTimeout      = 30 * time.Second
+	DefaultCircuitHalfOpenRequests = 1
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every request with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker configures the circuit breaker of the FCM client.
+// Zero values are replaced by the corresponding defaults.
+type CircuitBreaker struct {
+	// FailureRatio is the ratio of failed requests within a window at which the circuit opens.
+	FailureRatio float64
+	// MinRequests is the number of requests a window must count before the circuit can open.
+	MinRequests int
+	// Window is the duration over which failed requests are counted while the circuit is closed.
+	Window time.Duration
+	// OpenTimeout is how long the circuit stays open before letting probe requests through.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe requests that must succeed for the circuit to close.
+	// The circuit opens again as soon as one of them fails.
+	HalfOpenRequests int
+	// OnStateChange, if set, is called after every change of state, for example to raise an alert.
+	// It must not block.
+	OnStateChange func(from, to CircuitState)
+}
+
+// SetCircuitBreaker enables a circuit breaker around the HTTP requests sending messages.
+// Requests failing with a 5xx status code or timing out are counted as failures, and once their ratio
+// within a window reaches the configured ratio the circuit opens: requests then fail immediately with
+// ErrCircuitOpen until the open timeout elapses, after which probe requests decide whether the circuit
+// closes or opens again. Changes of state are logged as warnings. By default there is no circuit breaker.
+// It is not safe to call SetCircuitBreaker concurrently with sending messages.
+func (f *FCMClient) SetCircuitBreaker(settings CircuitBreaker) *FCMClient {
+	onStateChange := settings.OnStateChange
+	settings.OnStateChange = func(from, to CircuitState) {
+		f.log().LogAttrs(context.Background(), slog.LevelWarn, "fcm: circuit breaker state changed",
+			slog.String("from", from.String()), slog.String("to", to.String()))
+		if onStateChange != nil {
+			onStateChange(from, to)
+		}
+	}
+	f.breaker = newCircuitBreaker(settings)
+	return f
+}
+
+// CircuitState returns the state of the circuit breaker of the client, or CircuitClosed if it has none.
+func (f *FCMClient) CircuitState() CircuitState {
+	return f.breaker.currentState()
+}
+
+// circuitBreaker implements the CircuitBreaker settings.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	settings CircuitBreaker
+	state    CircuitState
+	// generation changes with every state, so that requests started in a previous state are ignored.
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	// probes is the number of probe requests in flight while half open, and successes those that succeeded.
+	probes    int
+	successes int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func newCircuitBreaker(settings CircuitBreaker) *circuitBreaker {
+	if settings.FailureRatio <= 0 {
+		settings.FailureRatio = DefaultCircuitFailureRatio
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = DefaultCircuitMinRequests
+	}
+	if settings.Window <= 0 {
+		settings.Window = DefaultCircuitWindow
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = DefaultCircuitOpenTimeout
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = DefaultCircuitHalfOpenRequests
+	}
+	return &circuitBreaker{settings: settings, now: time.Now}
+}
+
+// allow reports whether a request may be sent, returning ErrCircuitOpen if not.
+// It returns a function that must be called with the result of the request once it completes.
+// A nil circuitBreaker allows every request.
+func (b *circuitBreaker) allow() (func(err error), error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	b.mu.Lock()
+	now := b.now()
+	changes := b.refresh(now)
+	switch {
+	case b.state == CircuitOpen:
+		b.mu.Unlock()
+		b.notify(changes)
+		return nil, ErrCircuitOpen
+	case b.state == CircuitHalfOpen && b.probes+b.successes >= b.settings.HalfOpenRequests:
+		b.mu.Unlock()
+		b.notify(changes)
+		return nil, ErrCircuitOpen
+	case b.state == CircuitHalfOpen:
+		b.probes++
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.notify(changes)
+
+	return func(err error) {
+		b.mu.Lock()
+		changes := b.record(b.now(), generation, err)
+		b.mu.Unlock()
+		b.notify(changes)
+	}, nil
+}
+
+// refresh moves an open circuit to half open once its timeout elapses, and starts a new window
+// when the current one ends. It must be called with b.mu held.
+func (b *circuitBreaker) refresh(now time.Time) [][2]CircuitState {
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+			return b.setState(CircuitHalfOpen, now)
+		}
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.settings.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+	return nil
+}
+
+// record counts the result of a request started in generation. It must be called with b.mu held.
+func (b *circuitBreaker) record(now time.Time, generation uint64, err error) [][2]CircuitState {
+	if generation != b.generation {
+		return nil
+	}
+	failed := circuitFailure(err)
+
+	switch b.state {
+	case CircuitClosed:
+		changes := b.refresh(now)
+		if errors.Is(err, context.Canceled) {
+			return changes
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.settings.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.settings.FailureRatio {
+			return append(changes, b.setState(CircuitOpen, now)...)
+		}
+		return changes
+	case CircuitHalfOpen:
+		b.probes--
+		switch {
+		case failed:
+			return b.setState(CircuitOpen, now)
+		case errors.Is(err, context.Canceled):
+		default:
+			b.successes++
+			if b.successes >= b.settings.HalfOpenRequests {
+				return b.setState(CircuitClosed, now)
+			}
+		}
+	}
+	return nil
+}
+
+// setState moves the circuit to state and returns the change to notify.
+// It must be called with b.mu held.
+func (b *circuitBreaker) setState(state CircuitState, now time.Time) [][2]CircuitState {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.windowStart = now
+	b.requests, b.failures = 0, 0
+	b.probes, b.successes = 0, 0
+	if state == CircuitOpen {
+		b.openedAt = now
+	}
+	return [][2]CircuitState{{from, state}}
+}
+
+// notify calls the state change callback for every change, without holding b.mu.
+func (b *circuitBreaker) notify(changes [][2]CircuitState) {
+	if b.settings.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		b.settings.OnStateChange(change[0], change[1])
+	}
+}
+
+// currentState returns the state of the circuit, or CircuitClosed for a nil circuitBreaker.
+func (b *circuitBreaker) currentState() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	changes := b.refresh(b.now())
+	state := b.state
+	b.mu.Unlock()
+	b.notify(changes)
+	return state
+}
+
+// circuitFailure reports whether err counts as a failure of the FCM endpoint: a 5xx response or a timeout.
+func circuitFailure(err error) bool {
+	var fcmErr *FCMError
+	if errors.As(err, &fcmErr) {
+		return fcmErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,170 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTimeoutError struct{}
+
+func (testTimeoutError) Error() string   { return "i/o timeout" }
+func (testTimeoutError) Timeout() bool   { return true }
+func (testTimeoutError) Temporary() bool { return true }
+
+func TestSetCircuitBreaker(t *testing.T) {
+	status := 503
+	requests := 0
+	var changes []string
+	client := NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetCircuitBreaker(CircuitBreaker{
+			MinRequests: 4,
+			OpenTimeout: time.Minute,
+			OnStateChange: func(from, to CircuitState) {
+				changes = append(changes, from.String()+" -> "+to.String())
+			},
+		}).
+		SetHTTPClient(&testHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if !strings.HasSuffix(req.URL.Path, "messages:send") {
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+				}
+				requests++
+				return &http.Response{
+					StatusCode: status,
+					Body:       io.NopCloser(strings.NewReader(`{"name":"projects/project_id/messages/1"}`)),
+				}, nil
+			},
+		})
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+	send := func() error {
+		_, err := client.SendContext(context.Background(), &MessagePayload{Message: Message{Token: "token"}})
+		return err
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := send(); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the circuit to be closed for request %d", i+1)
+		}
+	}
+	if state := client.CircuitState(); state != CircuitOpen {
+		t.Fatalf("expected the circuit to open, got %v", state)
+	}
+	if err := send(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if requests != 4 {
+		t.Errorf("expected no request while the circuit is open, got %d requests", requests)
+	}
+
+	now = now.Add(time.Minute)
+	if err := send(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected the failing probe to be sent, got %v", err)
+	}
+	if state := client.CircuitState(); state != CircuitOpen {
+		t.Errorf("expected a failed probe to open the circuit, got %v", state)
+	}
+
+	now = now.Add(time.Minute)
+	status = 200
+	if err := send(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if state := client.CircuitState(); state != CircuitClosed {
+		t.Errorf("expected a successful probe to close the circuit, got %v", state)
+	}
+
+	expected := []string{"closed -> open", "open -> half-open", "half-open -> open", "open -> half-open", "half-open -> closed"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected state changes %v, got %v", expected, changes)
+	}
+}
+
+func TestCircuitBreaker_Allow(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(CircuitBreaker{MinRequests: 4, FailureRatio: 0.5, Window: time.Second, HalfOpenRequests: 2})
+	breaker.now = func() time.Time { return now }
+	serverErr := &FCMError{StatusCode: 500}
+	record := func(results ...error) {
+		t.Helper()
+		for _, result := range results {
+			done, err := breaker.allow()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			done(result)
+		}
+	}
+
+	// Client errors and canceled requests do not count as failures.
+	record(serverErr, &FCMError{StatusCode: 404}, context.Canceled, nil, nil)
+	if breaker.state != CircuitClosed {
+		t.Fatalf("expected the circuit to be closed, got %v", breaker.state)
+	}
+
+	// Failures are counted within a window.
+	now = now.Add(time.Second)
+	record(serverErr, nil, nil)
+	if breaker.state != CircuitClosed {
+		t.Fatalf("expected a new window, got %v", breaker.state)
+	}
+	stale, _ := breaker.allow()
+	record(serverErr)
+	if breaker.state != CircuitOpen {
+		t.Fatalf("expected the circuit to open, got %v", breaker.state)
+	}
+
+	// Results of requests started before the circuit opened are ignored.
+	now = now.Add(DefaultCircuitOpenTimeout)
+	first, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("expected a probe request, got %v", err)
+	}
+	second, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("expected a probe request, got %v", err)
+	}
+	if _, err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen beyond the probe requests, got %v", err)
+	}
+	stale(serverErr)
+	first(nil)
+	if breaker.state != CircuitHalfOpen {
+		t.Errorf("expected the circuit to stay half open, got %v", breaker.state)
+	}
+	second(nil)
+	if breaker.state != CircuitClosed {
+		t.Errorf("expected the circuit to close, got %v", breaker.state)
+	}
+}
+
+func TestCircuitFailure(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: &FCMError{StatusCode: 503}, expected: true},
+		{err: &FCMError{StatusCode: 500}, expected: true},
+		{err: &FCMError{StatusCode: 429}, expected: false},
+		{err: &FCMError{StatusCode: 400}, expected: false},
+		{err: context.DeadlineExceeded, expected: true},
+		{err: fmt.Errorf("post: %w", testTimeoutError{}), expected: true},
+		{err: context.Canceled, expected: false},
+		{err: errors.New("connection refused"), expected: false},
+	}
+
+	for _, tc := range testCases {
+		if actual := circuitFailure(tc.err); actual != tc.expected {
+			t.Errorf("expected circuitFailure(%v) to be %v, got %v", tc.err, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package fcm
+
+import "time"
+
+// MessageBuilder builds a MessagePayload using a fluent API.
+//
+//	msg, err := fcm.NewMessage().
+//		ToToken(token).
+//		Title("Order shipped").
+//		Body("Your order is on its way").
+//		Data("order_id", "42").
+//		Sound("default").
+//		Android(func(a *fcm.AndroidBuilder) {
+//			a.Priority(fcm.AndroidMessagePriorityHigh).TTL(time.Hour)
+//		}).
+//		Build()
+type MessageBuilder struct {
+	msg     Message
+	sound   string
+	android *AndroidBuilder
+	apns    *APNSBuilder
+	webpush *WebpushBuilder
+}
+
+// NewMessage returns a new MessageBuilder.
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// ToToken sends the message to a single device registration token.
+func (b *MessageBuilder) ToToken(token string) *MessageBuilder {
+	b.msg.Token = token
+	return b
+}
+
+// ToTopic sends the message to all devices subscribed to the topic.
+func (b *MessageBuilder) ToTopic(topic string) *MessageBuilder {
+	b.msg.Topic = topic
+	return b
+}
+
+// ToCondition sends the message to all devices matching the topic condition,
+// e.g. "'stock' in topics && 'industry' in topics".
+func (b *MessageBuilder) ToCondition(condition string) *MessageBuilder {
+	b.msg.Condition = condition
+	return b
+}
+
+// Title sets the notification title shown on all platforms.
+func (b *MessageBuilder) Title(title string) *MessageBuilder {
+	b.notification().Title = title
+	return b
+}
+
+// Body sets the notification body shown on all platforms.
+func (b *MessageBuilder) Body(body string) *MessageBuilder {
+	b.notification().Body = body
+	return b
+}
+
+// Image sets the URL of the image shown in the notification on all platforms.
+func (b *MessageBuilder) Image(image string) *MessageBuilder {
+	b.notification().Image = image
+	return b
+}
+
+// Data adds a key-value pair to the data payload.
+func (b *MessageBuilder) Data(key, value string) *MessageBuilder {
+	if b.msg.Data == nil {
+		b.msg.Data = make(map[string]string)
+	}
+	b.msg.Data[key] = value
+	return b
+}
+
+// Sound sets the notification sound on Android and APNs, unless a platform specific
+// sound has been set through Android or APNS.
+func (b *MessageBuilder) Sound(sound string) *MessageBuilder {
+	b.sound = sound
+	return b
+}
+
+// Android configures the Android specific options of the message.
+func (b *MessageBuilder) Android(fn func(a *AndroidBuilder)) *MessageBuilder {
+	if b.android == nil {
+		b.android = &AndroidBuilder{}
+	}
+	fn(b.android)
+	return b
+}
+
+// APNS configures the APNs specific options of the message.
+func (b *MessageBuilder) APNS(fn func(a *APNSBuilder)) *MessageBuilder {
+	if b.apns == nil {
+		b.apns = &APNSBuilder{}
+	}
+	fn(b.apns)
+	return b
+}
+
+// Webpush configures the Web Push specific options of the message.
+func (b *MessageBuilder) Webpush(fn func(w *WebpushBuilder)) *MessageBuilder {
+	if b.webpush == nil {
+		b.webpush = &WebpushBuilder{}
+	}
+	fn(b.webpush)
+	return b
+}
+
+// Build returns the message payload. It returns the ValidationErrors reported by
+// Message.Validate if the message is invalid.
+// The message is a deep copy, so that building the message again with more options does not modify
+// the messages already built, except for the values of custom data which are not copied.
+func (b *MessageBuilder) Build() (*MessagePayload, error) {
+	msg := b.msg
+	msg.Notification = cloneNotification(msg.Notification)
+	msg.Data = cloneStrings(msg.Data)
+	msg.Tokens = append([]string(nil), msg.Tokens...)
+	if b.android != nil {
+		msg.Android = cloneAndroidConfig(&b.android.config)
+	}
+	if b.apns != nil {
+		msg.APNS = cloneAPNSConfig(&b.apns.config)
+	}
+	if b.webpush != nil {
+		msg.Webpush = cloneWebpushConfig(&b.webpush.config)
+	}
+
+	if b.sound != "" {
+		// Copy the nested sections so that applying the default sound never mutates the builder.
+		if msg.Android == nil {
+			msg.Android = &AndroidConfig{}
+		}
+		notification := Notification{}
+		if msg.Android.Notification != nil {
+			notification = *msg.Android.Notification
+		}
+		if notification.Sound == "" {
+			notification.Sound = b.sound
+		}
+		msg.Android.Notification = &notification
+
+		if msg.APNS == nil {
+			msg.APNS = &APNSConfig{}
+		}
+		payload := APNSPayload{}
+		if msg.APNS.Payload != nil {
+			payload = *msg.APNS.Payload
+		}
+		aps := Aps{}
+		if payload.Aps != nil {
+			aps = *payload.Aps
+		}
+		if aps.Sound == "" && aps.CriticalSound == nil {
+			aps.Sound = b.sound
+		}
+		payload.Aps = &aps
+		msg.APNS.Payload = &payload
+	}
+
+	if err := msg.Validate(); err != nil {
+		return nil, err
+	}
+	return &MessagePayload{Message: msg}, nil
+}
+
+// cloneStrings returns a copy of m, or nil if it is empty.
+func cloneStrings(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+// cloneCustomData returns a copy of m, or nil if it is empty. The values are not copied.
+func cloneCustomData(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	clone := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func cloneNotification(n *Notification) *Notification {
+	if n == nil {
+		return nil
+	}
+	clone := *n
+	clone.BodyLocArgs = append([]string(nil), n.BodyLocArgs...)
+	clone.TitleLocArgs = append([]string(nil), n.TitleLocArgs...)
+	return &clone
+}
+
+func cloneAndroidConfig(c *AndroidConfig) *AndroidConfig {
+	clone := *c
+	clone.Data = cloneStrings(c.Data)
+	clone.Notification = cloneNotification(c.Notification)
+	if c.FcmOptions != nil {
+		options := *c.FcmOptions
+		clone.FcmOptions = &options
+	}
+	return &clone
+}
+
+func cloneAPNSConfig(c *APNSConfig) *APNSConfig {
+	clone := *c
+	clone.Headers = cloneStrings(c.Headers)
+	if c.FcmOptions != nil {
+		options := *c.FcmOptions
+		clone.FcmOptions = &options
+	}
+	if c.Payload == nil {
+		return &clone
+	}
+	payload := APNSPayload{CustomData: cloneCustomData(c.Payload.CustomData)}
+	if aps := c.Payload.Aps; aps != nil {
+		apsClone := *aps
+		if aps.Alert != nil {
+			alert := *aps.Alert
+			alert.TitleLocArgs = append([]string(nil), aps.Alert.TitleLocArgs...)
+			alert.SubtitleLocArgs = append([]string(nil), aps.Alert.SubtitleLocArgs...)
+			alert.LocArgs = append([]string(nil), aps.Alert.LocArgs...)
+			apsClone.Alert = &alert
+		}
+		if aps.Badge != nil {
+			badge := *aps.Badge
+			apsClone.Badge = &badge
+		}
+		if aps.CriticalSound != nil {
+			sound := *aps.CriticalSound
+			apsClone.CriticalSound = &sound
+		}
+		payload.Aps = &apsClone
+	}
+	clone.Payload = &payload
+	return &clone
+}
+
+func cloneWebpushConfig(c *WebpushConfig) *WebpushConfig {
+	clone := *c
+	clone.Headers = cloneStrings(c.Headers)
+	clone.Data = cloneStrings(c.Data)
+	if c.TTL != nil {
+		ttl := *c.TTL
+		clone.TTL = &ttl
+	}
+	if c.FcmOptions != nil {
+		options := *c.FcmOptions
+		clone.FcmOptions = &options
+	}
+	if n := c.Notification; n != nil {
+		notification := *n
+		notification.Actions = append([]WebpushNotificationAction(nil), n.Actions...)
+		notification.Vibrate = append([]int(nil), n.Vibrate...)
+		notification.CustomData = cloneCustomData(n.CustomData)
+		clone.Notification = &notification
+	}
+	return &clone
+}
+
+func (b *MessageBuilder) notification() *Notification {
+	if b.msg.Notification == nil {
+		b.msg.Notification = &Notification{}
+	}
+	return b.msg.Notification
+}
+
+// AndroidBuilder configures the Android specific options of a message.
+type AndroidBuilder struct {
+	config AndroidConfig
+}
+
+// Priority sets the delivery priority of the message.
+func (a *AndroidBuilder) Priority(priority AndroidMessagePriority) *AndroidBuilder {
+	a.config.Priority = priority
+	return a
+}
+
+// TTL sets how long the message is kept if the device is offline.
+func (a *AndroidBuilder) TTL(ttl time.Duration) *AndroidBuilder {
+	a.config.TTL = ttl
+	return a
+}
+
+// CollapseKey sets the key used to collapse a group of messages.
+func (a *AndroidBuilder) CollapseKey(key string) *AndroidBuilder {
+	a.config.CollapseKey = key
+	return a
+}
+
+// RestrictedPackageName restricts delivery to the application with the given package name.
+func (a *AndroidBuilder) RestrictedPackageName(name string) *AndroidBuilder {
+	a.config.RestrictedPackageName = name
+	return a
+}
+
+// DirectBootOk allows delivery while the device is in direct boot mode.
+func (a *AndroidBuilder) DirectBootOk(ok bool) *AndroidBuilder {
+	a.config.DirectBootOk = ok
+	return a
+}
+
+// Data adds a key-value pair to the Android data payload, overriding the message data.
+func (a *AndroidBuilder) Data(key, value string) *AndroidBuilder {
+	if a.config.Data == nil {
+		a.config.Data = make(map[string]string)
+	}
+	a.config.Data[key] = value
+	return a
+}
+
+// Notification configures the Android notification.
+func (a *AndroidBuilder) Notification(fn func(n *Notification)) *AndroidBuilder {
+	if a.config.Notification == nil {
+		a.config.Notification = &Notification{}
+	}
+	fn(a.config.Notification)
+	return a
+}
+
+// Sound sets the Android notification sound.
+func (a *AndroidBuilder) Sound(sound string) *AndroidBuilder {
+	return a.Notification(func(n *Notification) { n.Sound = sound })
+}
+
+// APNSBuilder configures the APNs specific options of a message.
+type APNSBuilder struct {
+	config APNSConfig
+}
+
+// Priority sets the apns-priority header.
+func (a *APNSBuilder) Priority(priority APNSPriority) *APNSBuilder {
+	a.config.Priority = priority
+	return a
+}
+
+// PushType sets the apns-push-type header.
+func (a *APNSBuilder) PushType(pushType APNSPushType) *APNSBuilder {
+	a.config.PushType = pushType
+	return a
+}
+
+// Expiration sets the apns-expiration header.
+func (a *APNSBuilder) Expiration(expiration time.Time) *APNSBuilder {
+	a.config.Expiration = expiration
+	return a
+}
+
+// ExpireImmediately sets the apns-expiration header to 0, so that APNs does not store the
+// notification if it cannot be delivered at once.
+func (a *APNSBuilder) ExpireImmediately() *APNSBuilder {
+	a.config.ExpireImmediately = true
+	return a
+}
+
+// CollapseID sets the apns-collapse-id header.
+func (a *APNSBuilder) CollapseID(id string) *APNSBuilder {
+	a.config.CollapseID = id
+	return a
+}
+
+// Topic sets the apns-topic header.
+func (a *APNSBuilder) Topic(topic string) *APNSBuilder {
+	a.config.Topic = topic
+	return a
+}
+
+// Header sets an additional APNs header.
+func (a *APNSBuilder) Header(key, value string) *APNSBuilder {
+	if a.config.Headers == nil {
+		a.config.Headers = make(map[string]string)
+	}
+	a.config.Headers[key] = value
+	return a
+}
+
+// Aps configures the aps dictionary of the payload.
+func (a *APNSBuilder) Aps(fn func(aps *Aps)) *APNSBuilder {
+	fn(a.payload().Aps)
+	return a
+}
+
+// Badge sets the number displayed on the app icon.
+func (a *APNSBuilder) Badge(badge int) *APNSBuilder {
+	return a.Aps(func(aps *Aps) { aps.Badge = &badge })
+}
+
+// Sound sets the APNs notification sound.
+func (a *APNSBuilder) Sound(sound string) *APNSBuilder {
+	return a.Aps(func(aps *Aps) { aps.Sound = sound })
+}
+
+// ContentAvailable marks the notification as a background update.
+func (a *APNSBuilder) ContentAvailable(available bool) *APNSBuilder {
+	return a.Aps(func(aps *Aps) { aps.ContentAvailable = available })
+}
+
+// MutableContent allows a notification service extension to modify the notification.
+func (a *APNSBuilder) MutableContent(mutable bool) *APNSBuilder {
+	return a.Aps(func(aps *Aps) { aps.MutableContent = mutable })
+}
+
+// CustomData adds an app specific key to the top level of the payload.
+func (a *APNSBuilder) CustomData(key string, value interface{}) *APNSBuilder {
+	payload := a.payload()
+	if payload.CustomData == nil {
+		payload.CustomData = make(map[string]interface{})
+	}
+	payload.CustomData[key] = value
+	return a
+}
+
+func (a *APNSBuilder) payload() *APNSPayload {
+	if a.config.Payload == nil {
+		a.config.Payload = &APNSPayload{}
+	}
+	if a.config.Payload.Aps == nil {
+		a.config.Payload.Aps = &Aps{}
+	}
+	return a.config.Payload
+}
+
+// WebpushBuilder configures the Web Push specific options of a message.
+type WebpushBuilder struct {
+	config WebpushConfig
+}
+
+// TTL sets the TTL header. A zero ttl is sent as is, asking for immediate delivery only.
+func (w *WebpushBuilder) TTL(ttl time.Duration) *WebpushBuilder {
+	w.config.TTL = &ttl
+	return w
+}
+
+// Urgency sets the Urgency header.
+func (w *WebpushBuilder) Urgency(urgency WebpushUrgency) *WebpushBuilder {
+	w.config.Urgency = urgency
+	return w
+}
+
+// Header sets an additional Web Push header.
+func (w *WebpushBuilder) Header(key, value string) *WebpushBuilder {
+	if w.config.Headers == nil {
+		w.config.Headers = make(map[string]string)
+	}
+	w.config.Headers[key] = value
+	return w
+}
+
+// Data adds a key-value pair to the Web Push data payload, overriding the message data.
+func (w *WebpushBuilder) Data(key, value string) *WebpushBuilder {
+	if w.config.Data == nil {
+		w.config.Data = make(map[string]string)
+	}
+	w.config.Data[key] = value
+	return w
+}
+
+// Notification configures the Web notification.
+func (w *WebpushBuilder) Notification(fn func(n *WebpushNotification)) *WebpushBuilder {
+	if w.config.Notification == nil {
+		w.config.Notification = &WebpushNotification{}
+	}
+	fn(w.config.Notification)
+	return w
+}
+
+// Link sets the HTTPS URL opened when the user clicks the notification.
+func (w *WebpushBuilder) Link(link string) *WebpushBuilder {
+	if w.config.FcmOptions == nil {
+		w.config.FcmOptions = &WebpushFcmOptions{}
+	}
+	w.config.FcmOptions.Link = link
+	return w
+}
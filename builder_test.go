@@ -0,0 +1,141 @@
+package fcm
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMessageBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name       string
+		builder    *MessageBuilder
+		expected   string
+		expectsErr bool
+	}{
+		{
+			name:       "without target",
+			builder:    NewMessage().Title("Hello"),
+			expectsErr: true,
+		},
+		{
+			name:       "with multiple targets",
+			builder:    NewMessage().ToToken("token").ToTopic("news"),
+			expectsErr: true,
+		},
+		{
+			name:     "data only",
+			builder:  NewMessage().ToToken("token").Data("order_id", "42"),
+			expected: `{"message":{"token":"token","data":{"order_id":"42"}}}`,
+		},
+		{
+			name:     "notification",
+			builder:  NewMessage().ToTopic("news").Title("Hello").Body("World"),
+			expected: `{"message":{"topic":"news","notification":{"title":"Hello","body":"World"}}}`,
+		},
+		{
+			name:    "sound applied to all platforms",
+			builder: NewMessage().ToToken("token").Title("Hello").Sound("default"),
+			expected: `{"message":{"token":"token","notification":{"title":"Hello"},` +
+				`"android":{"notification":{"sound":"default"}},"apns":{"payload":{"aps":{"sound":"default"}}}}}`,
+		},
+		{
+			name: "platform sound takes precedence",
+			builder: NewMessage().ToToken("token").Sound("default").
+				Android(func(a *AndroidBuilder) { a.Sound("chime") }).
+				APNS(func(a *APNSBuilder) { a.Sound("chime.caf") }),
+			expected: `{"message":{"token":"token","android":{"notification":{"sound":"chime"}},` +
+				`"apns":{"payload":{"aps":{"sound":"chime.caf"}}}}}`,
+		},
+		{
+			name: "platform overrides",
+			builder: NewMessage().ToCondition("'news' in topics").
+				Android(func(a *AndroidBuilder) {
+					a.Priority(AndroidMessagePriorityHigh).TTL(90 * time.Second).CollapseKey("news")
+				}).
+				APNS(func(a *APNSBuilder) {
+					a.PushType(APNSPushTypeAlert).Priority(APNSPriorityHigh).Badge(1).CustomData("story", "7")
+				}).
+				Webpush(func(w *WebpushBuilder) {
+					w.Urgency(WebpushUrgencyHigh).Link("https://example.com/news/7")
+				}),
+			expected: `{"message":{"android":{"collapse_key":"news","priority":"high","ttl":"90s"},` +
+				`"webpush":{"headers":{"Urgency":"high"},"fcm_options":{"link":"https://example.com/news/7"}},` +
+				`"apns":{"headers":{"apns-priority":"10","apns-push-type":"alert"},"payload":{"aps":{"badge":1},"story":"7"}},` +
+				`"condition":"'news' in topics"}}`,
+		},
+		{
+			name: "invalid platform options",
+			builder: NewMessage().ToToken("token").
+				Android(func(a *AndroidBuilder) { a.Priority("HIGH") }).
+				Webpush(func(w *WebpushBuilder) { w.Link("http://example.com") }),
+			expectsErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := tc.builder.Build()
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			data, err := json.Marshal(payload)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, data)
+			}
+		})
+	}
+}
+
+func TestMessageBuilder_BuildDoesNotMutateBuilder(t *testing.T) {
+	builder := NewMessage().ToToken("token").Sound("default").
+		Android(func(a *AndroidBuilder) { a.Notification(func(n *Notification) { n.Icon = "ic_stat" }) })
+
+	if _, err := builder.Build(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if sound := builder.android.config.Notification.Sound; sound != "" {
+		t.Errorf("expected builder notification sound to stay empty, got %q", sound)
+	}
+}
+
+func TestMessageBuilder_BuildDoesNotShareState(t *testing.T) {
+	builder := NewMessage().ToToken("token").Title("First").Data("k", "v").
+		Android(func(a *AndroidBuilder) { a.Data("k", "v") }).
+		APNS(func(a *APNSBuilder) { a.Badge(1).Header("apns-id", "1").CustomData("k", "v") }).
+		Webpush(func(w *WebpushBuilder) {
+			w.Header("x", "1").Notification(func(n *WebpushNotification) { n.Vibrate = []int{100} })
+		})
+
+	first, err := builder.Build()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected, _ := json.Marshal(first)
+
+	builder.Title("Second").Data("k", "changed").
+		Android(func(a *AndroidBuilder) { a.Data("k", "changed") }).
+		APNS(func(a *APNSBuilder) {
+			a.Header("apns-id", "2").CustomData("k", "changed").Aps(func(aps *Aps) { *aps.Badge = 2 })
+		}).
+		Webpush(func(w *WebpushBuilder) {
+			w.Header("x", "2").Notification(func(n *WebpushNotification) { n.Vibrate[0] = 200 })
+		})
+	if _, err := builder.Build(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if actual, _ := json.Marshal(first); string(actual) != string(expected) {
+		t.Errorf("expected the built message not to change, got %s instead of %s", actual, expected)
+	}
+}
@@ -0,0 +1,245 @@
+// Package campaign sends personalized messages to every row of a CSV or JSONL file.
+//
+// Each row is rendered into a message by a Template and sent with bounded concurrency, within the
+// rate limits of the client (see fcm.FCMClient.SetRateLimits). Progress is checkpointed to a local file so that a crashed or
+// interrupted run resumes where it stopped, and the outcome of every row is written to a
+// results file as JSON lines.
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+// DefaultCheckpointInterval is the number of rows processed between two checkpoint writes
+// when Options.CheckpointInterval is not set.
+const DefaultCheckpointInterval = 100
+
+// DefaultCheckpointPeriod is the longest time between two checkpoint writes when
+// Options.CheckpointPeriod is not set.
+const DefaultCheckpointPeriod = 5 * time.Second
+
+// Options configures a campaign run.
+type Options struct {
+	// Concurrency is the maximum number of messages sent in parallel. Defaults to fcm.DefaultConcurrency.
+	Concurrency int
+	// CheckpointFile is the path of the file recording the processed rows. When the file exists,
+	// the rows it records are skipped. An empty path disables checkpointing.
+	CheckpointFile string
+	// CheckpointInterval is the number of rows processed between two checkpoint writes.
+	// Rows processed after the last write are sent again when a crashed run resumes, and their
+	// results written again. Defaults to DefaultCheckpointInterval.
+	CheckpointInterval int
+	// CheckpointPeriod is the longest time between two checkpoint writes, so that a slow run
+	// is checkpointed before CheckpointInterval rows are processed. Defaults to DefaultCheckpointPeriod.
+	CheckpointPeriod time.Duration
+	// Results receives one Result per processed row, encoded as a JSON line. It may be nil.
+	Results io.Writer
+}
+
+// Result is the outcome of a row.
+type Result struct {
+	Row       int           `json:"row"`
+	Target    string        `json:"target,omitempty"`
+	MessageID string        `json:"message_id,omitempty"`
+	ErrorCode fcm.ErrorCode `json:"error_code,omitempty"`
+	Error     string        `json:"error,omitempty"`
+
+	// interrupted is set when the send was aborted by the cancellation of the run,
+	// in which case the row is neither reported nor checkpointed.
+	interrupted bool
+}
+
+// Summary counts the rows of a campaign run.
+type Summary struct {
+	// Sent is the number of rows sent successfully.
+	Sent int `json:"sent"`
+	// Failed is the number of rows that are malformed or failed to render or send.
+	Failed int `json:"failed"`
+	// Skipped is the number of rows skipped because a previous run processed them.
+	Skipped int `json:"skipped"`
+}
+
+// Run renders every row read from input with tmpl and sends it with sender.
+//
+// It returns when every row has been processed, or with an error when the input cannot be read,
+// the results or checkpoint cannot be written, or ctx is cancelled. In every case the messages
+// in flight are awaited and the checkpoint is saved, so the run can be resumed.
+// Malformed rows and rows failing to render or send are reported in the results and do not stop the run.
+func Run(ctx context.Context, sender fcm.Sender, input Reader, tmpl *Template, opts Options) (*Summary, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = fcm.DefaultConcurrency
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = DefaultCheckpointInterval
+	}
+	if opts.CheckpointPeriod <= 0 {
+		opts.CheckpointPeriod = DefaultCheckpointPeriod
+	}
+
+	cp, err := loadCheckpoint(opts.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan job)
+	results := make(chan Result)
+
+	var workers sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				results <- send(ctx, sender, j)
+			}
+		}()
+	}
+
+	summary := &Summary{}
+	collected := make(chan error, 1)
+	go func() {
+		collected <- collect(results, cp, opts, summary, cancel)
+	}()
+
+	readErr := dispatch(ctx, input, tmpl, cp.clone(), jobs, results, summary)
+	close(jobs)
+	workers.Wait()
+	close(results)
+	collectErr := <-collected
+
+	if err := cp.save(opts.CheckpointFile); err != nil && collectErr == nil {
+		collectErr = fmt.Errorf("campaign: saving checkpoint: %w", err)
+	}
+	if collectErr != nil {
+		return summary, collectErr
+	}
+	return summary, readErr
+}
+
+// job is a rendered row waiting to be sent.
+type job struct {
+	row     int
+	payload *fcm.MessagePayload
+}
+
+// dispatch reads the input, skipping the rows processed by a previous run according to resumed, and
+// hands the rendered rows to the workers. Malformed rows and rows failing to render are reported
+// directly as results.
+func dispatch(ctx context.Context, input Reader, tmpl *Template, resumed *checkpoint,
+	jobs chan<- job, results chan<- Result, summary *Summary) error {
+	for {
+		row, err := input.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			row.Number = rowErr.Number
+		} else if err != nil {
+			return err
+		}
+		if resumed.isDone(row.Number) {
+			summary.Skipped++
+			continue
+		}
+
+		var payload *fcm.MessagePayload
+		if err == nil {
+			payload, err = tmpl.Render(row)
+		}
+		if err != nil {
+			select {
+			case results <- Result{Row: row.Number, Error: err.Error()}:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case jobs <- job{row: row.Number, payload: payload}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// send sends the message of a job and returns its result.
+func send(ctx context.Context, sender fcm.Sender, j job) Result {
+	result := Result{Row: j.row, Target: target(j.payload.Message)}
+	res, err := sender.SendContext(ctx, j.payload)
+	if err != nil && ctx.Err() != nil {
+		result.interrupted = true
+		return result
+	}
+	if err != nil {
+		result.ErrorCode = fcm.ErrorCodeOf(err)
+		result.Error = err.Error()
+		return result
+	}
+	result.MessageID = res.MessageID()
+	return result
+}
+
+// collect writes the results, updates the summary and checkpoints the progress.
+// It cancels the run if a result or the checkpoint cannot be written.
+func collect(results <-chan Result, cp *checkpoint, opts Options, summary *Summary, cancel context.CancelFunc) error {
+	var encoder *json.Encoder
+	if opts.Results != nil {
+		encoder = json.NewEncoder(opts.Results)
+	}
+
+	var err error
+	processed := 0
+	saved := time.Now()
+	for result := range results {
+		if err != nil || result.interrupted {
+			continue
+		}
+		if encoder != nil {
+			if err = encoder.Encode(result); err != nil {
+				err = fmt.Errorf("campaign: writing results: %w", err)
+				cancel()
+				continue
+			}
+		}
+
+		if result.Error != "" {
+			summary.Failed++
+		} else {
+			summary.Sent++
+		}
+		cp.markDone(result.Row)
+
+		if processed++; processed%opts.CheckpointInterval == 0 || time.Since(saved) >= opts.CheckpointPeriod {
+			processed, saved = 0, time.Now()
+			if err = cp.save(opts.CheckpointFile); err != nil {
+				err = fmt.Errorf("campaign: saving checkpoint: %w", err)
+				cancel()
+			}
+		}
+	}
+	return err
+}
+
+// target describes the target of a message in the results.
+func target(msg fcm.Message) string {
+	switch {
+	case msg.Token != "":
+		return msg.Token
+	case msg.Topic != "":
+		return "/topics/" + msg.Topic
+	}
+	return msg.Condition
+}
@@ -0,0 +1,255 @@
+package campaign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+type testSender struct {
+	mu          sync.Mutex
+	sent        []string
+	inFlight    int
+	maxInFlight int
+	send        func(ctx context.Context, msg *fcm.MessagePayload) error
+}
+
+func (s *testSender) SendContext(ctx context.Context, msg *fcm.MessagePayload) (*fcm.SendResponse, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond)
+	if s.send != nil {
+		if err := s.send(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, msg.Message.Token)
+	return &fcm.SendResponse{Name: "projects/p/messages/" + msg.Message.Token}, nil
+}
+
+func testInput(rows int) string {
+	var b strings.Builder
+	b.WriteString("token,name\n")
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&b, "t%d,user%d\n", i, i)
+	}
+	return b.String()
+}
+
+func testTemplate(t *testing.T) *Template {
+	t.Helper()
+	tmpl, err := ParseTemplate([]byte(`{"message":{"token":"{{.token}}","notification":{"title":"Hi {{.name}}"}}}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return tmpl
+}
+
+func decodeResults(t *testing.T, data []byte) map[int]Result {
+	t.Helper()
+	results := make(map[int]Result)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var result Result
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("expected JSON results, got %v", err)
+		}
+		results[result.Row] = result
+	}
+	return results
+}
+
+func TestRun(t *testing.T) {
+	sender := &testSender{send: func(ctx context.Context, msg *fcm.MessagePayload) error {
+		if msg.Message.Token == "t3" {
+			return &fcm.FCMError{StatusCode: 404, Code: fcm.ErrorCodeUnregistered, Status: "NOT_FOUND", Message: "gone"}
+		}
+		return nil
+	}}
+	input := testInput(20) + "t21\n"
+
+	var results bytes.Buffer
+	summary, err := Run(context.Background(), sender, NewCSVReader(strings.NewReader(input)), testTemplate(t), Options{
+		Concurrency: 4,
+		Results:     &results,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if *summary != (Summary{Sent: 19, Failed: 2}) {
+		t.Errorf("unexpected summary %+v", *summary)
+	}
+	if sender.maxInFlight > 4 {
+		t.Errorf("expected at most 4 sends in flight, got %d", sender.maxInFlight)
+	}
+
+	byRow := decodeResults(t, results.Bytes())
+	if len(byRow) != 21 {
+		t.Fatalf("expected 21 results, got %d", len(byRow))
+	}
+	if byRow[1] != (Result{Row: 1, Target: "t1", MessageID: "t1"}) {
+		t.Errorf("unexpected result %+v", byRow[1])
+	}
+	if byRow[3].ErrorCode != fcm.ErrorCodeUnregistered || byRow[3].Error == "" {
+		t.Errorf("expected UNREGISTERED result, got %+v", byRow[3])
+	}
+	if byRow[21].Error == "" {
+		t.Errorf("expected an error result for the malformed last row, got %+v", byRow[21])
+	}
+}
+
+func TestRun_RenderError(t *testing.T) {
+	sender := &testSender{}
+	tmpl, err := ParseTemplate([]byte(`{"message":{"token":"{{.token}}","data":{"coupon":"{{.coupon}}"}}}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	input := `{"token":"a","coupon":"X1"}` + "\n" + `{"token":"b"}` + "\n"
+
+	var results bytes.Buffer
+	summary, err := Run(context.Background(), sender, NewJSONLReader(strings.NewReader(input)), tmpl, Options{Results: &results})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if *summary != (Summary{Sent: 1, Failed: 1}) {
+		t.Errorf("unexpected summary %+v", *summary)
+	}
+	if byRow := decodeResults(t, results.Bytes()); byRow[2].Error == "" {
+		t.Errorf("expected render error for row 2, got %+v", byRow[2])
+	}
+}
+
+func TestRun_MalformedRow(t *testing.T) {
+	sender := &testSender{}
+	input := `{"token":"a","name":"Ana"}` + "\n" + `{"token":` + "\n" + `{"token":"c","name":"Cy"}` + "\n"
+
+	var results bytes.Buffer
+	summary, err := Run(context.Background(), sender, NewJSONLReader(strings.NewReader(input)), testTemplate(t), Options{Results: &results})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if *summary != (Summary{Sent: 2, Failed: 1}) {
+		t.Errorf("unexpected summary %+v", *summary)
+	}
+	if byRow := decodeResults(t, results.Bytes()); byRow[2].Error == "" || byRow[3].MessageID != "c" {
+		t.Errorf("expected an error result for row 2 and row 3 to be sent, got %+v", byRow)
+	}
+}
+
+func TestRun_Resume(t *testing.T) {
+	checkpointFile := filepath.Join(t.TempDir(), "campaign.checkpoint")
+	input := testInput(50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var count int
+	var mu sync.Mutex
+	first := &testSender{send: func(ctx context.Context, msg *fcm.MessagePayload) error {
+		mu.Lock()
+		count++
+		if count == 20 {
+			cancel()
+		}
+		mu.Unlock()
+		return ctx.Err()
+	}}
+
+	summary, err := Run(ctx, first, NewCSVReader(strings.NewReader(input)), testTemplate(t), Options{
+		Concurrency:        3,
+		CheckpointFile:     checkpointFile,
+		CheckpointInterval: 5,
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	second := &testSender{}
+	resumed, err := Run(context.Background(), second, NewCSVReader(strings.NewReader(input)), testTemplate(t), Options{
+		Concurrency:    3,
+		CheckpointFile: checkpointFile,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if resumed.Skipped != summary.Sent {
+		t.Errorf("expected the %d rows sent by the first run to be skipped, got %d", summary.Sent, resumed.Skipped)
+	}
+	all := append(append([]string(nil), first.sent...), second.sent...)
+	sort.Strings(all)
+	if len(all) != 50 {
+		t.Fatalf("expected every row to be sent exactly once, got %d sends", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Errorf("expected %s to be sent once", all[i])
+		}
+	}
+}
+
+func TestRun_Checkpoint(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts Options
+	}{
+		{name: "every row", opts: Options{CheckpointInterval: 1}},
+		{name: "period", opts: Options{CheckpointPeriod: time.Nanosecond}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkpointFile := filepath.Join(t.TempDir(), "campaign.checkpoint")
+			sender := &testSender{send: func(ctx context.Context, msg *fcm.MessagePayload) error {
+				if msg.Message.Token != "t10" {
+					return nil
+				}
+				// The rows sent before are checkpointed without waiting for the end of the run.
+				deadline := time.Now().Add(time.Second)
+				for {
+					cp, err := loadCheckpoint(checkpointFile)
+					if err == nil && cp.isDone(9) {
+						return nil
+					}
+					if time.Now().After(deadline) {
+						return fmt.Errorf("row 9 not checkpointed")
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}}
+
+			opts := tc.opts
+			opts.Concurrency = 1
+			opts.CheckpointFile = checkpointFile
+			summary, err := Run(context.Background(), sender, NewCSVReader(strings.NewReader(testInput(10))), testTemplate(t), opts)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if summary.Failed != 0 {
+				t.Errorf("expected every row to be checkpointed as soon as it is processed, got %+v", summary)
+			}
+		})
+	}
+}
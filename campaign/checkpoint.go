@@ -0,0 +1,110 @@
+package campaign
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// checkpoint tracks the rows of the input that have been processed. Rows complete out of order
+// because they are sent concurrently, so it records the highest row number up to which every
+// row is done, plus the rows done beyond it.
+type checkpoint struct {
+	// CompletedThrough is the highest row number such that this row and all the rows before it are done.
+	CompletedThrough int `json:"completed_through"`
+	// Completed lists the rows done after CompletedThrough.
+	Completed []int `json:"completed,omitempty"`
+
+	done map[int]bool
+}
+
+// loadCheckpoint reads the checkpoint stored at path, or returns an empty one if the file does not exist.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{done: make(map[int]bool)}
+	if path == "" {
+		return cp, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("campaign: parsing checkpoint %s: %w", path, err)
+	}
+	for _, number := range cp.Completed {
+		cp.done[number] = true
+	}
+	cp.Completed = nil
+	return cp, nil
+}
+
+// isDone reports whether the row has already been processed.
+func (c *checkpoint) isDone(number int) bool {
+	return number <= c.CompletedThrough || c.done[number]
+}
+
+// clone returns a copy of the checkpoint.
+func (c *checkpoint) clone() *checkpoint {
+	clone := &checkpoint{CompletedThrough: c.CompletedThrough, done: make(map[int]bool, len(c.done))}
+	for number := range c.done {
+		clone.done[number] = true
+	}
+	return clone
+}
+
+// markDone records that the row has been processed.
+func (c *checkpoint) markDone(number int) {
+	c.done[number] = true
+	for c.done[c.CompletedThrough+1] {
+		delete(c.done, c.CompletedThrough+1)
+		c.CompletedThrough++
+	}
+}
+
+// save atomically writes the checkpoint to path.
+func (c *checkpoint) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	c.Completed = make([]int, 0, len(c.done))
+	for number := range c.done {
+		c.Completed = append(c.Completed, number)
+	}
+	sort.Ints(c.Completed)
+	data, err := json.Marshal(c)
+	c.Completed = nil
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
+
+// writeFile atomically replaces the file at path with data.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
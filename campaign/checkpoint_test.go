@@ -0,0 +1,50 @@
+package campaign
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaign.checkpoint")
+
+	cp, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, number := range []int{2, 1, 5, 3} {
+		cp.markDone(number)
+	}
+	if cp.CompletedThrough != 3 {
+		t.Errorf("expected rows completed through 3, got %d", cp.CompletedThrough)
+	}
+	if err := cp.save(path); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(data) != `{"completed_through":3,"completed":[5]}` {
+		t.Errorf("unexpected checkpoint file %s", data)
+	}
+
+	loaded, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for number, expected := range map[int]bool{1: true, 3: true, 4: false, 5: true, 6: false} {
+		if loaded.isDone(number) != expected {
+			t.Errorf("expected row %d done to be %v", number, expected)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(path); err == nil {
+		t.Error("expected error for a corrupt checkpoint, got nil")
+	}
+}
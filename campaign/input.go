@@ -0,0 +1,139 @@
+package campaign
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Row is a record of the campaign input.
+type Row struct {
+	// Number is the 1-based position of the row in the input, not counting the CSV header.
+	Number int
+	// Data holds the fields of the row, available to the template as {{.field}}.
+	Data map[string]interface{}
+}
+
+// Reader streams the rows of a campaign input. Next returns io.EOF after the last row, and a
+// *RowError for a malformed row that can be skipped; any other error stops the run.
+type Reader interface {
+	Next() (Row, error)
+}
+
+// RowError reports a malformed row of the input. Run reports it as a failed result and continues
+// with the next row.
+type RowError struct {
+	// Number is the 1-based position of the row in the input, not counting the CSV header.
+	Number int
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("campaign: reading row %d: %v", e.Number, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// NewReader returns a CSV or JSONL reader for r depending on the extension of name:
+// ".jsonl" and ".ndjson" files are read as JSONL, every other file as CSV.
+func NewReader(name string, r io.Reader) Reader {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jsonl", ".ndjson":
+		return NewJSONLReader(r)
+	}
+	return NewCSVReader(r)
+}
+
+// CSVReader reads rows from CSV data whose first record holds the field names.
+type CSVReader struct {
+	reader *csv.Reader
+	header []string
+	number int
+}
+
+// NewCSVReader creates a CSVReader reading from r.
+func NewCSVReader(r io.Reader) *CSVReader {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	return &CSVReader{reader: reader}
+}
+
+// Next implements Reader.
+func (c *CSVReader) Next() (Row, error) {
+	if c.header == nil {
+		header, err := c.reader.Read()
+		if err == io.EOF {
+			return Row{}, io.EOF
+		}
+		if err != nil {
+			return Row{}, fmt.Errorf("campaign: reading CSV header: %w", err)
+		}
+		for i := range header {
+			header[i] = strings.TrimSpace(header[i])
+		}
+		c.header = header
+	}
+
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return Row{}, io.EOF
+	}
+	c.number++
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Row{}, &RowError{Number: c.number, Err: err}
+	}
+	if err != nil {
+		return Row{}, fmt.Errorf("campaign: reading CSV row %d: %w", c.number, err)
+	}
+
+	data := make(map[string]interface{}, len(record))
+	for i, value := range record {
+		data[c.header[i]] = value
+	}
+	return Row{Number: c.number, Data: data}, nil
+}
+
+// JSONLReader reads rows from JSONL data holding one JSON object per line. Blank lines are skipped.
+type JSONLReader struct {
+	scanner *bufio.Scanner
+	number  int
+}
+
+// NewJSONLReader creates a JSONLReader reading from r.
+func NewJSONLReader(r io.Reader) *JSONLReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &JSONLReader{scanner: scanner}
+}
+
+// Next implements Reader.
+func (j *JSONLReader) Next() (Row, error) {
+	for j.scanner.Scan() {
+		line := bytes.TrimSpace(j.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		j.number++
+
+		var data map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&data); err != nil {
+			return Row{}, &RowError{Number: j.number, Err: err}
+		}
+		return Row{Number: j.number, Data: data}, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return Row{}, fmt.Errorf("campaign: reading JSONL row %d: %w", j.number+1, err)
+	}
+	return Row{}, io.EOF
+}
@@ -0,0 +1,75 @@
+package campaign
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, reader Reader) ([]Row, error) {
+	t.Helper()
+	var rows []Row
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	testCases := []struct {
+		name       string
+		file       string
+		input      string
+		expected   []Row
+		expectsErr bool
+	}{
+		{
+			name:  "csv",
+			file:  "tokens.csv",
+			input: "token, name\na,Ana\nb,\"Bo, Jr\"\n",
+			expected: []Row{
+				{Number: 1, Data: map[string]interface{}{"token": "a", "name": "Ana"}},
+				{Number: 2, Data: map[string]interface{}{"token": "b", "name": "Bo, Jr"}},
+			},
+		},
+		{
+			name:  "jsonl",
+			file:  "tokens.JSONL",
+			input: "{\"token\":\"a\",\"points\":42}\n\n{\"token\":\"b\",\"points\":7}\n",
+			expected: []Row{
+				{Number: 1, Data: map[string]interface{}{"token": "a", "points": json.Number("42")}},
+				{Number: 2, Data: map[string]interface{}{"token": "b", "points": json.Number("7")}},
+			},
+		},
+		{name: "empty csv", file: "tokens.csv", input: ""},
+		{name: "csv with missing field", file: "tokens.csv", input: "token,name\na\n", expectsErr: true},
+		{name: "invalid jsonl", file: "tokens.ndjson", input: "{\"token\":\"a\"}\n{nope\n", expectsErr: true},
+		{name: "invalid csv header", file: "tokens.csv", input: "\"token\n", expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows, err := readAll(t, NewReader(tc.file, strings.NewReader(tc.input)))
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(rows, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// PruneResults rewrites the results file at path, written by a previous run, so that it holds a
+// single result for each row recorded in the checkpoint file. The results of the other rows, and a
+// last line cut short by a crash, are dropped: the run resuming from the checkpoint processes these
+// rows again and appends their new results. It does nothing if the results file does not exist.
+func PruneResults(path, checkpointFile string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cp, err := loadCheckpoint(checkpointFile)
+	if err != nil {
+		return err
+	}
+
+	byRow := make(map[int][]byte)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var result Result
+		if err := json.Unmarshal(line, &result); err != nil || !cp.isDone(result.Row) {
+			continue
+		}
+		byRow[result.Row] = line
+	}
+	rows := make([]int, 0, len(byRow))
+	for row := range byRow {
+		rows = append(rows, row)
+	}
+	sort.Ints(rows)
+
+	var pruned bytes.Buffer
+	for _, row := range rows {
+		pruned.Write(byRow[row])
+		pruned.WriteByte('\n')
+	}
+	if err := writeFile(path, pruned.Bytes()); err != nil {
+		return fmt.Errorf("campaign: pruning results: %w", err)
+	}
+	return nil
+}
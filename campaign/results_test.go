@@ -0,0 +1,44 @@
+package campaign
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneResults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "campaign.results.jsonl")
+	checkpointFile := filepath.Join(dir, "campaign.checkpoint")
+
+	if err := PruneResults(path, checkpointFile); err != nil {
+		t.Fatalf("expected no error without results, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no results file to be created, got %v", err)
+	}
+
+	results := `{"row":2,"target":"b","error":"unavailable"}` + "\n" +
+		`{"row":1,"target":"a","message_id":"1"}` + "\n" +
+		`{"row":4,"target":"d","message_id":"4"}` + "\n" +
+		`{"row":2,"target":"b","message_id":"2"}` + "\n" +
+		`{"row":3,"tar`
+	if err := os.WriteFile(path, []byte(results), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(checkpointFile, []byte(`{"completed_through":2}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PruneResults(path, checkpointFile); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"row":1,"target":"a","message_id":"1"}` + "\n" + `{"row":2,"target":"b","message_id":"2"}` + "\n"
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
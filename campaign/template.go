@@ -0,0 +1,135 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+// Template renders the rows of a campaign into messages. It is an FCM v1 request body,
+// {"message": {...}}, whose string values are text/template templates executed with the
+// data of each row, e.g.
+//
+//	{"message": {"token": "{{.token}}", "notification": {"title": "Hi {{.name}}"}}}
+//
+// Referencing a field missing from a row is an error.
+type Template struct {
+	root interface{}
+}
+
+// ParseTemplate parses a template from an FCM v1 request body.
+func ParseTemplate(data []byte) (*Template, error) {
+	if _, err := fcm.ParseMessage(data); err != nil {
+		return nil, err
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	root, err := compile("", document)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{root: root}, nil
+}
+
+// NewTemplate creates a template from a message payload whose string fields may hold templates.
+func NewTemplate(payload *fcm.MessagePayload) (*Template, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTemplate(data)
+}
+
+// Render renders the template with the data of row into a message payload.
+func (t *Template) Render(row Row) (*fcm.MessagePayload, error) {
+	rendered, err := render(t.root, row.Data)
+	if err != nil {
+		return nil, fmt.Errorf("campaign: rendering row %d: %w", row.Number, err)
+	}
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := fcm.ParseMessage(data)
+	if err != nil {
+		return nil, fmt.Errorf("campaign: rendering row %d: %w", row.Number, err)
+	}
+	return payload, nil
+}
+
+// compile replaces the string values of the decoded JSON document v holding template actions with
+// their parsed templates.
+func compile(path string, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		compiled := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c, err := compile(path+"."+key, value)
+			if err != nil {
+				return nil, err
+			}
+			compiled[key] = c
+		}
+		return compiled, nil
+	case []interface{}:
+		compiled := make([]interface{}, len(v))
+		for i, value := range v {
+			c, err := compile(fmt.Sprintf("%s[%d]", path, i), value)
+			if err != nil {
+				return nil, err
+			}
+			compiled[i] = c
+		}
+		return compiled, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New(path).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("campaign: parsing template %s: %w", strings.TrimPrefix(path, "."), err)
+		}
+		return tmpl, nil
+	}
+	return v, nil
+}
+
+// render executes the templates of the compiled document v with data.
+func render(v interface{}, data map[string]interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			r, err := render(value, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, value := range v {
+			r, err := render(value, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	case *template.Template:
+		var buf bytes.Buffer
+		if err := v.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	}
+	return v, nil
+}
@@ -0,0 +1,96 @@
+package campaign
+
+import (
+	"encoding/json"
+	"testing"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	tmpl, err := ParseTemplate([]byte(`{"message":{
+		"token":"{{.token}}",
+		"notification":{"title":"Hi {{.name}}","body":"You have {{.points}} \"points\""},
+		"data":{"campaign":"spring","points":"{{.points}}"},
+		"android":{"priority":"high"}
+	}}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		row        Row
+		expected   string
+		expectsErr bool
+	}{
+		{
+			name: "complete row",
+			row:  Row{Number: 1, Data: map[string]interface{}{"token": "a", "name": "Ana", "points": json.Number("42")}},
+			expected: `{"message":{"token":"a","notification":{"title":"Hi Ana","body":"You have 42 \"points\""},` +
+				`"data":{"campaign":"spring","points":"42"},"android":{"priority":"high"}}}`,
+		},
+		{
+			name:       "missing field",
+			row:        Row{Number: 2, Data: map[string]interface{}{"token": "b", "points": "1"}},
+			expectsErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := tmpl.Render(tc.row)
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			data, err := json.Marshal(payload)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, data)
+			}
+		})
+	}
+}
+
+func TestParseTemplate_Invalid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+	}{
+		{name: "without message", template: `{"token":"{{.token}}"}`},
+		{name: "invalid action", template: `{"message":{"token":"{{.token"}}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseTemplate([]byte(tc.template)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestNewTemplate(t *testing.T) {
+	tmpl, err := NewTemplate(&fcm.MessagePayload{Message: fcm.Message{
+		Topic:        "{{.topic}}",
+		Notification: &fcm.Notification{Title: "News for {{.topic}}"},
+	}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	payload, err := tmpl.Render(Row{Number: 1, Data: map[string]interface{}{"topic": "sports"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payload.Message.Topic != "sports" || payload.Message.Notification.Title != "News for sports" {
+		t.Errorf("expected rendered topic message, got %+v", payload.Message)
+	}
+}
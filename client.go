@@ -2,10 +2,15 @@ package fcm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 const (
@@ -13,16 +18,62 @@ const (
 	SCOPES     = "https://www.googleapis.com/auth/firebase.messaging"
 )
 
+// defaultRetryBackoff is the delay before the first retry of a request, doubled on every following retry.
+const defaultRetryBackoff = time.Second
+
+// maxRetryBackoff caps the delay between two retries of a request, unless the server asks for more.
+const maxRetryBackoff = time.Minute
+
+// MaxBatchSize is the largest number of tokens SendAll sends a message to, as the FCM batch API did.
+const MaxBatchSize = 500
+
+// SendResponse represents a successful response from the FCM server.
+type SendResponse struct {
+	// Name is the identifier of the sent message, in the format projects/*/messages/{message_id}.
+	Name string `json:"name"`
+	// Deduplicated is set when the message was not sent because a message was already sent with
+	// the same deduplication key, see WithDedupKey. Name is then the name of that message.
+	Deduplicated bool `json:"-"`
+}
+
+// MessageID returns the message ID part of Name.
+func (r *SendResponse) MessageID() string {
+	return r.Name[strings.LastIndex(r.Name, "/")+1:]
+}
 
 // HttpClient is an interface that represents an HTTP client.
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// Sender sends message payloads. It is implemented by *FCMClient, and accepted by the outbox,
+// scheduler, campaign and notify packages so that their sends can be wrapped or replaced in tests.
+type Sender interface {
+	SendContext(ctx context.Context, msg *MessagePayload) (*SendResponse, error)
+}
+
+// DefaultConcurrency is the number of messages sent in parallel by the outbox, scheduler, campaign
+// and notify packages when their concurrency is not configured.
+const DefaultConcurrency = 4
+
 // FCMClient represents a client for interacting with the Firebase Cloud Messaging (FCM) service.
 type FCMClient struct {
-	credentials *Credentials
-	httpClient  HttpClient
+	credentials     *Credentials
+	httpClient      HttpClient
+	middlewares     []Middleware
+	httpMiddlewares []HTTPMiddleware
+	logger          *slog.Logger
+	metrics         Metrics
+	tracer          Tracer
+	limiter         *rateLimiter
+	breaker         *circuitBreaker
+	dedupStore      DedupStore
+	dedupWindow     time.Duration
+	dedup           dedup
+	tokenRegistry   TokenRegistry
+	invalidToken    []func(token string, reason ErrorCode)
+	maxRetries      int
+	retryBackoff    time.Duration
 }
 
 // NewClient creates a new FCMClient instance with the default HTTP client.
@@ -32,9 +83,19 @@ func NewClient() *FCMClient {
 }
 
 // Send sends the given message payload to the FCM server.
-// It returns an error if the API call fails.
+// It returns an error if the message fails validation or if the API call fails.
 func (f *FCMClient) Send(msg *MessagePayload) error {
-	return f.makeAPICall(msg)
+	_, err := f.SendContext(context.Background(), msg)
+	return err
+}
+
+// SendContext sends the given message payload to the FCM server through the middleware chain.
+// It returns the response of the FCM server, or an error if the message fails validation or if the API call fails.
+func (f *FCMClient) SendContext(ctx context.Context, msg *MessagePayload) (*SendResponse, error) {
+	if err := msg.Message.Validate(); err != nil {
+		return nil, err
+	}
+	return f.dispatch(ctx, msg)
 }
 
 // SendToTopic sends a message payload to a specific topic.
@@ -43,7 +104,7 @@ func (f *FCMClient) SendToTopic(msg *MessagePayload) error {
 	if msg.Message.Topic == "" {
 		return fmt.Errorf("topic is required")
 	}
-	return f.makeAPICall(msg)
+	return f.Send(msg)
 }
 
 // SendToCondition sends a message payload to a specific condition.
@@ -52,24 +113,55 @@ func (f *FCMClient) SendToCondition(msg *MessagePayload) error {
 	if msg.Message.Condition == "" {
 		return fmt.Errorf("condition is required")
 	}
-
-	return f.makeAPICall(msg)
+	return f.Send(msg)
 }
 
 // SendToMultiple sends a message payload to multiple FCM tokens.
-// It returns an error if no tokens are provided or if there is an issue making the API call.
+// The FCM v1 API has no multicast, so the message is sent to each token of Message.Tokens in turn,
+// through SendContext. It returns an error if no tokens are provided or if the message fails
+// validation, or the errors of the tokens the message could not be sent to, joined.
 func (f *FCMClient) SendToMultiple(msg *MessagePayload) error {
 	if len(msg.Message.Tokens) == 0 {
 		return fmt.Errorf("no tokens provided")
 	}
-	return f.makeAPICall(msg)
+	return f.sendEach(context.Background(), msg)
+}
+
+// sendEach sends the payload to each token of Message.Tokens through SendContext, after validating
+// it once. It returns the errors of the tokens the message could not be sent to, joined.
+func (f *FCMClient) sendEach(ctx context.Context, msg *MessagePayload) error {
+	if err := msg.forToken(msg.Message.Tokens[0]).Message.Validate(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, token := range msg.Message.Tokens {
+		if _, err := f.SendContext(ctx, msg.forToken(token)); err != nil {
+			errs = append(errs, fmt.Errorf("sending to token %s: %w", RedactToken(token), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forToken returns a copy of the payload sent to the single token instead of Message.Tokens.
+func (p *MessagePayload) forToken(token string) *MessagePayload {
+	payload := *p
+	payload.Message.Tokens = nil
+	payload.Message.Token = token
+	return &payload
 }
 
 // SendAll sends a message payload to all the provided tokens.
-// It returns an error if no tokens are provided or if there is an issue making the API call.
-// Create a list containing up to 500 messages.
+// A message with Message.Tokens is sent as a batch of up to MaxBatchSize messages, one per token,
+// like SendToMultiple; any other message is sent as is, like Send.
+// It returns an error if there are too many tokens or if there is an issue making the API calls.
 func (f *FCMClient) SendAll(msg *MessagePayload) error {
-	return f.makeAPICall(msg)
+	switch {
+	case len(msg.Message.Tokens) == 0:
+		return f.Send(msg)
+	case len(msg.Message.Tokens) > MaxBatchSize:
+		return fmt.Errorf("got %d tokens, a batch is limited to %d", len(msg.Message.Tokens), MaxBatchSize)
+	}
+	return f.sendEach(context.Background(), msg)
 }
 
 // SetCredentialFile sets the service account credentials for the FCM client
@@ -118,59 +210,259 @@ func (f *FCMClient) SetHTTPClient(httpClient HttpClient) *FCMClient {
 	return f
 }
 
+// SetMaxRetries sets how many times a request is retried when the FCM server responds with
+// a retryable error (HTTP 429, 500 or 503). Retries wait for the delay given by the Retry-After
+// header, or back off exponentially from one second up to one minute. By default requests are
+// not retried.
+func (f *FCMClient) SetMaxRetries(maxRetries int) *FCMClient {
+	f.maxRetries = maxRetries
+	return f
+}
+
+// SendRaw sends an already serialized FCM v1 request body, such as {"message": {...}}, to the FCM server.
+// The body is sent as is, without local validation, and bypasses the middlewares registered with Use;
+// the HTTP middlewares registered with UseHTTP still apply.
+// It returns the response of the FCM server or an error if the API call fails.
+func (f *FCMClient) SendRaw(ctx context.Context, body json.RawMessage) (*SendResponse, error) {
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("body is not valid JSON")
+	}
+	res, err := f.send(ctx, body, TargetRaw, "")
+	if err != nil {
+		f.checkInvalidToken(ctx, rawToken(body), err)
+	}
+	return res, err
+}
+
 // makeAPICall sends an HTTP POST request to the FCM API with the provided message payload.
 // It marshals the message payload into JSON format and includes it in the request body.
 // The function sets the necessary headers, makes the API request, and handles the response.
 // If any error occurs during the process, it is returned.
-func (f *FCMClient) makeAPICall(msg *MessagePayload) error {
+// It is the innermost SendFunc of the middleware chain.
+func (f *FCMClient) makeAPICall(ctx context.Context, msg *MessagePayload) (*SendResponse, error) {
 	jsonData, err := json.Marshal(msg)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	res, err := f.send(ctx, jsonData, msg.Message.targetType(), msg.Message.recipient(), slog.Any("message", msg.Message))
+	if err != nil {
+		f.checkInvalidToken(ctx, msg.Message.deviceToken(), err)
+	}
+	return res, err
+}
+
+// send makes the HTTP POST request to the FCM API with the given JSON body and handles the response,
+// unless the body is a duplicate according to the deduplication key of ctx.
+// The recipient is the device token or topic the body is sent to, used for per target rate limits.
+// It records the send in the metrics and traces of the client.
+func (f *FCMClient) send(ctx context.Context, body []byte, target, recipient string, attrs ...slog.Attr) (*SendResponse, error) {
+	return f.sendOnce(ctx, body, func() (*SendResponse, error) {
+		return f.trackedSend(ctx, body, target, recipient, attrs...)
+	})
+}
+
+// trackedSend sends the body, recording the send in the metrics and traces of the client.
+func (f *FCMClient) trackedSend(ctx context.Context, body []byte, target, recipient string, attrs ...slog.Attr) (*SendResponse, error) {
+	ctx, span := f.startSpan(ctx, SpanSend,
+		slog.String(AttributeTargetType, target),
+		slog.String(AttributeProjectID, f.credentials.ProjectID),
+	)
+	metrics := f.metric()
+	metrics.AddInFlight(1)
+	defer metrics.AddInFlight(-1)
+
+	res, err := f.sendWithRetries(ctx, body, target, recipient, attrs...)
+	if err == nil {
+		span.SetAttributes(slog.String(AttributeMessageID, res.MessageID()))
+	}
+	metrics.IncSends(target, outcome(err), ErrorCodeOf(err))
+	endSpan(span, err)
+	return res, err
+}
+
+// sendWithRetries sends the body to the FCM API within the rate limits of the client, retrying
+// requests failing with a retryable error up to the configured maximum number of retries.
+func (f *FCMClient) sendWithRetries(ctx context.Context, body []byte, target, recipient string, attrs ...slog.Attr) (*SendResponse, error) {
+	logger := f.log()
+	accessToken, err := f.accessToken(ctx, f.credentials)
+	if err != nil {
+		return nil, fmt.Errorf("fcm: fetching access token: %w", err)
+	}
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		logger.LogAttrs(ctx, slog.LevelDebug, "fcm: send attempt", append(attrs, slog.Int("attempt", attempt))...)
+
+		res, err := f.limitedSendAttempt(ctx, body, accessToken, attempt, target, recipient)
+		if err == nil {
+			logger.LogAttrs(ctx, slog.LevelInfo, "fcm: message sent", append(attrs,
+				slog.String("message_id", res.MessageID()),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int("attempts", attempt),
+			)...)
+			return res, nil
+		}
+
+		var fcmErr *FCMError
+		if !errors.As(err, &fcmErr) || !fcmErr.Retryable() || attempt > f.maxRetries {
+			logger.LogAttrs(ctx, slog.LevelError, "fcm: send failed", append(attrs,
+				slog.String("error_code", string(ErrorCodeOf(err))),
+				slog.String("error", err.Error()),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int("attempts", attempt),
+			)...)
+			return nil, err
+		}
+
+		delay := f.retryDelay(fcmErr, attempt)
+		logger.LogAttrs(ctx, slog.LevelWarn, "fcm: retrying send", append(attrs,
+			slog.String("error_code", string(fcmErr.Code)),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+		)...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
 	}
-	req, err := http.NewRequest(
+}
+
+// sendAttempt makes a single HTTP POST request to the FCM API.
+func (f *FCMClient) sendAttempt(ctx context.Context, body []byte, accessToken string, attempt int) (res *SendResponse, err error) {
+	url := fmt.Sprintf(FCM_V1_URL, f.credentials.ProjectID)
+	ctx, span := f.startSpan(ctx, SpanHTTPAttempt,
+		slog.Int(AttributeAttempt, attempt),
+		slog.String(AttributeHTTPMethod, http.MethodPost),
+		slog.String(AttributeHTTPURL, url),
+	)
+	defer func() { endSpan(span, err) }()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf(FCM_V1_URL, f.credentials.ProjectID),
-		bytes.NewBuffer(jsonData),
+		url,
+		bytes.NewReader(body),
 	)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", f.getAccessToken(f.credentials)))
-	res, err := f.httpClient.Do(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	httpRes, err := f.do(req)
+	f.metric().ObserveSendLatency(time.Since(start))
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	defer httpRes.Body.Close()
+	span.SetAttributes(slog.Int(AttributeHTTPStatusCode, httpRes.StatusCode))
+
+	return f.handleResponse(httpRes)
+}
+
+// limitedSendAttempt makes a single HTTP POST request to the FCM API once allowed by the rate limits
+// and the circuit breaker. An open circuit fails the request before it waits for the rate limits.
+func (f *FCMClient) limitedSendAttempt(ctx context.Context, body []byte, accessToken string, attempt int, target, recipient string) (*SendResponse, error) {
+	if f.breaker.currentState() == CircuitOpen {
+		return nil, ErrCircuitOpen
+	}
+	limited, err := f.limiter.acquire(ctx, target, recipient)
+	if err != nil {
+		return nil, err
+	}
+	tripped, err := f.breaker.allow()
+	if err != nil {
+		limited(nil)
+		return nil, err
+	}
+	res, err := f.sendAttempt(ctx, body, accessToken, attempt)
+	tripped(err)
+	limited(err)
+	return res, err
+}
+
+// retryDelay returns how long to wait before retrying a request that failed with err.
+// It honours the Retry-After header and otherwise backs off exponentially, up to maxRetryBackoff.
+func (f *FCMClient) retryDelay(err *FCMError, attempt int) time.Duration {
+	if err.RetryAfter > 0 {
+		return err.RetryAfter
+	}
+	backoff := f.retryBackoff
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+	if attempt-1 < 32 {
+		if delay := backoff << (attempt - 1); delay > 0 && delay < maxRetryBackoff {
+			return delay
+		}
+	}
+	return maxRetryBackoff
+}
+
+// AccessToken returns an OAuth 2.0 access token for the service account of the client,
+// authorized for the Firebase Cloud Messaging API.
+// A new token is fetched from Google on every call.
+func (f *FCMClient) AccessToken(ctx context.Context) (string, error) {
+	if f.credentials == nil {
+		return "", fmt.Errorf("credentials are required")
+	}
+	return f.accessToken(ctx, f.credentials)
+}
+
+// accessToken fetches an access token for the service account, recording the request in the
+// metrics, traces and logs of the client.
+func (f *FCMClient) accessToken(ctx context.Context, serviceAccount *Credentials) (string, error) {
+	ctx, span := f.startSpan(ctx, SpanTokenFetch, slog.String(AttributeProjectID, serviceAccount.ProjectID))
+	start := time.Now()
+	token, err := f.fetchAccessToken(ctx, serviceAccount)
+	latency := time.Since(start)
+	f.metric().ObserveTokenLatency(outcome(err), latency)
+	endSpan(span, err)
 
-	return f.handleResponse(res)
+	if err != nil {
+		f.log().LogAttrs(ctx, slog.LevelWarn, "fcm: access token refresh failed",
+			slog.Any("credentials", serviceAccount), slog.String("error", err.Error()))
+		return "", err
+	}
+	f.log().LogAttrs(ctx, slog.LevelDebug, "fcm: access token refreshed",
+		slog.Any("credentials", serviceAccount), slog.Duration("latency", latency))
+	return token, nil
 }
 
 // getAccessToken generates and retrieves an access token for the FCM client using the provided service account.
 // It first generates a Google JWT using the given service account, then uses the JWT to obtain an access token
 // from Google. If any error occurs during the process, an empty string is returned.
-func (f *FCMClient) getAccessToken(serviceAccount *Credentials) string {
+func (f *FCMClient) getAccessToken(ctx context.Context, serviceAccount *Credentials) string {
+	token, _ := f.accessToken(ctx, serviceAccount)
+	return token
+}
+
+// fetchAccessToken signs a JWT with the service account and exchanges it for an access token.
+func (f *FCMClient) fetchAccessToken(ctx context.Context, serviceAccount *Credentials) (string, error) {
 	jwt, err := generateGoogleJWT(serviceAccount)
 
 	if err != nil {
-		return ""
-	}
-	token, err := f.getAccessTokenFromGoogle(jwt)
-	if err != nil {
-		return ""
+		return "", err
 	}
-	return token
+	return f.getAccessTokenFromGoogle(ctx, jwt)
 }
 
 // getAccessTokenFromGoogle retrieves an access token from Google using the provided JWT.
 // It sends a POST request to the TokenURI endpoint of the service account with the JWT as the assertion.
 // The function returns the access token as a string if successful, otherwise it returns an error.
-func (f *FCMClient) getAccessTokenFromGoogle(jwt string) (string, error) {
-	req, err := http.NewRequest(
+func (f *FCMClient) getAccessTokenFromGoogle(ctx context.Context, jwt string) (string, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
 		f.credentials.TokenURI,
 		bytes.NewBuffer([]byte(fmt.Sprintf("grant_type=urn:ietf:params:oauth:grant-type:jwt-bearer&assertion=%s", jwt))),
@@ -182,12 +474,14 @@ func (f *FCMClient) getAccessTokenFromGoogle(jwt string) (string, error) {
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	res, err := f.httpClient.Do(req)
+	res, err := f.do(req)
 
 	if err != nil {
 		return "", err
 	}
 
+	defer res.Body.Close()
+
 	var response map[string]interface{}
 
 	err = json.NewDecoder(res.Body).Decode(&response)
@@ -206,22 +500,49 @@ func (f *FCMClient) getAccessTokenFromGoogle(jwt string) (string, error) {
 }
 
 // handleResponse decodes the response body from an HTTP response and handles the FCM server's response.
-// It returns an error if there was an error decoding the response body or if the FCM server returned an error status.
-// If the response is successful, it logs a success message and returns nil.
-func (f *FCMClient) handleResponse(res *http.Response) error {
-	var response map[string]interface{}
+// It returns an error if there was an error decoding the response body, or an *FCMError if the FCM server
+// returned an error status. If the response is successful, it returns the decoded SendResponse.
+func (f *FCMClient) handleResponse(res *http.Response) (*SendResponse, error) {
+	var response struct {
+		SendResponse
+		Error *struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				Type            string           `json:"@type"`
+				ErrorCode       ErrorCode        `json:"errorCode"`
+				FieldViolations []FieldViolation `json:"fieldViolations"`
+			} `json:"details"`
+		} `json:"error"`
+	}
 
 	err := json.NewDecoder(res.Body).Decode(&response)
 
-	if err != nil {
-		return err
+	if err != nil && res.StatusCode == http.StatusOK {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusOK {
+		return &response.SendResponse, nil
+	}
+
+	fcmErr := &FCMError{
+		StatusCode:     res.StatusCode,
+		Code:           errorCodeFromStatus(res.StatusCode),
+		CodeFromStatus: true,
+		RetryAfter:     parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
 	}
-	switch res.StatusCode != http.StatusOK {
-	case true:
-		status := response["error"].(map[string]interface{})["status"].(string)
-		message := response["error"].(map[string]interface{})["message"].(string)
-		return fmt.Errorf(`%s: %s`, status, message)
-	default:
-		return nil
+	if response.Error != nil {
+		fcmErr.Status = response.Error.Status
+		fcmErr.Message = response.Error.Message
+		for _, detail := range response.Error.Details {
+			switch {
+			case detail.Type == fcmErrorType && detail.ErrorCode != "":
+				fcmErr.Code = detail.ErrorCode
+				fcmErr.CodeFromStatus = false
+			case detail.Type == badRequestType:
+				fcmErr.FieldViolations = append(fcmErr.FieldViolations, detail.FieldViolations...)
+			}
+		}
 	}
+	return nil, fcmErr
 }
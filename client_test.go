@@ -2,8 +2,12 @@ package fcm
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -11,6 +15,8 @@ const (
 	testServiceAccountFile = "testdata/service_test.json"
 )
 
+var _ Sender = (*FCMClient)(nil)
+
 func TestNew(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -71,7 +77,7 @@ func TestSend(t *testing.T) {
 			payload: &MessagePayload{
 				Message: Message{
 					Token: "test",
-					Notification: Notification{
+					Notification: &Notification{
 						Title: "Coming Soon!",
 						Body:  "Stay tuned for the latest features and improvements. We are constantly working to improve your experience.",
 					},
@@ -131,7 +137,7 @@ func TestSendToTopic(t *testing.T) {
 			payload: &MessagePayload{
 				Message: Message{
 					Topic: "test",
-					Notification: Notification{
+					Notification: &Notification{
 						Title: "Coming Soon!",
 						Body:  "Stay tuned for the latest features and improvements. We are constantly working to improve your experience.",
 					},
@@ -191,7 +197,7 @@ func TestSendToCondition(t *testing.T) {
 			payload: &MessagePayload{
 				Message: Message{
 					Condition: "'test' in topics",
-					Notification: Notification{
+					Notification: &Notification{
 						Title: "Coming Soon!",
 						Body:  "Stay tuned for the latest features and improvements. We are constantly working to improve your experience.",
 					},
@@ -251,7 +257,7 @@ func TestSendToMultiple(t *testing.T) {
 			payload: &MessagePayload{
 				Message: Message{
 					Tokens: []string{"test1", "test2"},
-					Notification: Notification{
+					Notification: &Notification{
 						Title: "Coming Soon!",
 						Body:  "Stay tuned for the latest features and improvements. We are constantly working to improve your experience.",
 					},
@@ -310,7 +316,7 @@ func TestSendAll(t *testing.T) {
 			},
 			payload: &MessagePayload{
 				Message: Message{
-					Notification: Notification{
+					Notification: &Notification{
 						Title: "Coming Soon!",
 						Body:  "Stay tuned for the latest features and improvements. We are constantly working to improve your experience.",
 					},
@@ -332,7 +338,7 @@ func TestSendAll(t *testing.T) {
 			},
 			payload: &MessagePayload{
 				Message: Message{
-					Notification: Notification{
+					Notification: &Notification{
 						Title: "Coming Soon!",
 						Body:  "Stay tuned for the latest features and improvements. We are constantly working to improve your experience.",
 					},
@@ -344,6 +350,21 @@ func TestSendAll(t *testing.T) {
 			},
 			expectedErr: false,
 		},
+		{
+			name: "with too many tokens",
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 200,
+					Body:       io.NopCloser(bytes.NewReader([]byte(`{}`))),
+				}, nil
+			},
+			payload: &MessagePayload{
+				Message: Message{
+					Tokens: make([]string, MaxBatchSize+1),
+				},
+			},
+			expectedErr: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -370,27 +391,101 @@ func TestGetAccessToken(t *testing.T) {
 	client := NewClient().
 		SetCredentialFile(testServiceAccountFile).
 		SetHTTPClient(&testHttpClient{
-			DoFunc: func(req *http.Request) (*http.Response, error) {
+			TokenFunc: func(req *http.Request) (*http.Response, error) {
 				return &http.Response{
 					StatusCode: 200,
 					Body:       io.NopCloser(bytes.NewReader([]byte(resBody))),
 				}, nil
 			},
 		})
-	token := client.getAccessToken(client.credentials)
+	token := client.getAccessToken(context.Background(), client.credentials)
 
 	if token == "" {
 		t.Error("Expected token to be generated")
 	}
 }
 
+func TestSend_AccessTokenError(t *testing.T) {
+	sends := 0
+	client := NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetHTTPClient(&testHttpClient{
+			TokenFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 400, Body: io.NopCloser(strings.NewReader(`{"error":"invalid_grant"}`))}, nil
+			},
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				sends++
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"name":"projects/p/messages/1"}`))}, nil
+			},
+		})
+
+	err := client.Send(&MessagePayload{Message: Message{Topic: "news"}})
+	if err == nil || !strings.Contains(err.Error(), "access token") {
+		t.Errorf("expected access token error, got %v", err)
+	}
+	if sends != 0 {
+		t.Errorf("expected no request without an access token, got %d", sends)
+	}
+}
+
 type testHttpClient struct {
 	DoFunc func(req *http.Request) (*http.Response, error)
+	// TokenFunc answers the access token requests. By default they are granted the token "test".
+	TokenFunc func(req *http.Request) (*http.Response, error)
 }
 
 func (t *testHttpClient) Do(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == "oauth2.googleapis.com" {
+		if t.TokenFunc != nil {
+			return t.TokenFunc(req)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(`{"access_token":"test","expires_in":3600}`)),
+		}, nil
+	}
 	if t.DoFunc != nil {
 		return t.DoFunc(req)
 	}
 	return &http.Response{}, nil
 }
+
+func TestSendToMultiple_PerToken(t *testing.T) {
+	var tokens []string
+	client := NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetHTTPClient(&testHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if !strings.HasSuffix(req.URL.Path, "messages:send") {
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+				}
+				var body struct {
+					Message map[string]interface{} `json:"message"`
+				}
+				json.NewDecoder(req.Body).Decode(&body)
+				if _, ok := body.Message["tokens"]; ok {
+					t.Error("expected tokens not to be sent")
+				}
+				token, _ := body.Message["token"].(string)
+				tokens = append(tokens, token)
+				if token == "dead" {
+					return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+				}
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"name":"projects/p/messages/1"}`))}, nil
+			},
+		})
+
+	err := client.SendToMultiple(&MessagePayload{Message: Message{Tokens: []string{"a", "dead", "b"}, Data: map[string]string{"k": "v"}}})
+	if ErrorCodeOf(err) != ErrorCodeUnregistered {
+		t.Errorf("expected the error of the dead token, got %v", err)
+	}
+	if !reflect.DeepEqual(tokens, []string{"a", "dead", "b"}) {
+		t.Errorf("expected one request per token, got %v", tokens)
+	}
+
+	tokens = nil
+	err = client.SendToMultiple(&MessagePayload{Message: Message{Tokens: []string{"a"}, Data: map[string]string{"from": "x"}}})
+	if err == nil || len(tokens) != 0 {
+		t.Errorf("expected the reserved data key to be rejected before sending, got %v after %d requests", err, len(tokens))
+	}
+}
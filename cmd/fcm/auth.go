@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// runAuth runs the auth commands. print-access-token prints the bare token, like
+// "gcloud auth print-access-token", so that it can be used in shell substitutions.
+func runAuth(ctx context.Context, env *env, args []string) (interface{}, error) {
+	if len(args) == 0 || args[0] != "print-access-token" {
+		return nil, &usageError{message: "usage: fcm auth print-access-token [flags]"}
+	}
+
+	fs, cf := newFlagSet(env, "auth print-access-token")
+	if err := parseFlags(env, fs, args[1:]); err != nil {
+		return nil, err
+	}
+
+	client, err := cf.newClient(env)
+	if err != nil {
+		return nil, err
+	}
+	token, err := client.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(env.stdout, token)
+	return nil, nil
+}
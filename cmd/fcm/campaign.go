@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+	"github.com/patrickkabwe/go-fcm/campaign"
+)
+
+// campaignResult is the result of the campaign command.
+type campaignResult struct {
+	*campaign.Summary
+	Results    string `json:"results"`
+	Checkpoint string `json:"checkpoint"`
+}
+
+func runCampaign(ctx context.Context, env *env, args []string) (interface{}, error) {
+	fs, cf := newFlagSet(env, "campaign")
+	var input, templateFile, checkpointFile, resultsFile string
+	var rate float64
+	opts := campaign.Options{}
+	fs.StringVar(&input, "input", "", "CSV file with a header row, or JSONL file (.jsonl, .ndjson), with one recipient per row")
+	fs.StringVar(&templateFile, "template", "", "FCM v1 request body whose string values are templates rendered with each row, e.g. \"{{.token}}\"")
+	fs.IntVar(&opts.Concurrency, "concurrency", fcm.DefaultConcurrency, "maximum number of messages sent in parallel")
+	fs.Float64Var(&rate, "rate", 0, "maximum number of messages sent per second (0 for no limit)")
+	fs.StringVar(&checkpointFile, "checkpoint", "", "checkpoint file used to resume an interrupted run (default: <input>.checkpoint)")
+	fs.StringVar(&resultsFile, "results", "", "file the per-row results are written to as JSON lines, one per row across resumed runs (default: <input>.results.jsonl)")
+	if err := parseFlags(env, fs, args); err != nil {
+		return nil, err
+	}
+	if input == "" || templateFile == "" {
+		return nil, &usageError{message: "-input and -template are required"}
+	}
+	if checkpointFile == "" {
+		checkpointFile = input + ".checkpoint"
+	}
+	if resultsFile == "" {
+		resultsFile = input + ".results.jsonl"
+	}
+
+	data, err := os.ReadFile(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := campaign.ParseTemplate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := cf.newClient(env)
+	if err != nil {
+		return nil, err
+	}
+	if rate > 0 {
+		client.SetRateLimits(fcm.RateLimits{Global: fcm.RateLimit{Rate: rate}})
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	// Rows processed after the last checkpoint of an interrupted run are sent again, so their
+	// results are dropped before appending the results of this run.
+	if err := campaign.PruneResults(resultsFile, checkpointFile); err != nil {
+		return nil, err
+	}
+	results, err := os.OpenFile(resultsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	opts.CheckpointFile = checkpointFile
+	opts.Results = results
+	summary, err := campaign.Run(ctx, client, campaign.NewReader(input, in), tmpl, opts)
+	if err != nil {
+		return nil, err
+	}
+	return campaignResult{Summary: summary, Results: resultsFile, Checkpoint: checkpointFile}, nil
+}
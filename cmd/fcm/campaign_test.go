@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun_Campaign(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "recipients.csv")
+	template := filepath.Join(dir, "template.json")
+	if err := os.WriteFile(input, []byte("token,name\na,Ana\nstale,Bo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(template, []byte(`{"message":{"token":"{{.token}}","notification":{"title":"Hi {{.name}}"}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	withServer(t, func(req *http.Request) (int, string) {
+		data, _ := io.ReadAll(req.Body)
+		if strings.Contains(string(data), `"token":"stale"`) {
+			return http.StatusNotFound, `{"error":{"status":"NOT_FOUND","message":"gone"}}`
+		}
+		return http.StatusOK, `{"name":"projects/project_id/messages/1"}`
+	})
+
+	code, stdout, stderr := runCommand(t, "", "campaign", "--credentials", testCredentials,
+		"--input", input, "--template", template, "--concurrency", "2")
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+
+	var output struct {
+		Sent    int    `json:"sent"`
+		Failed  int    `json:"failed"`
+		Results string `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+		t.Fatalf("expected JSON output, got %q", stdout)
+	}
+	if output.Sent != 1 || output.Failed != 1 || output.Results != input+".results.jsonl" {
+		t.Errorf("unexpected output %+v", output)
+	}
+
+	results, err := os.ReadFile(output.Results)
+	if err != nil {
+		t.Fatalf("expected results file, got %v", err)
+	}
+	if lines := strings.Count(string(results), "\n"); lines != 2 {
+		t.Errorf("expected 2 result lines, got %d", lines)
+	}
+	if !strings.Contains(string(results), `"error_code":"UNREGISTERED"`) {
+		t.Errorf("expected UNREGISTERED result, got %s", results)
+	}
+
+	// A second run resumes from the checkpoint and sends nothing.
+	code, stdout, _ = runCommand(t, "", "campaign", "--credentials", testCredentials, "--input", input, "--template", template)
+	if code != exitOK || !strings.Contains(stdout, `"skipped": 2`) {
+		t.Errorf("expected every row to be skipped, got %d: %s", code, stdout)
+	}
+
+	// A run resuming from an older checkpoint resends the rows it does not record, and replaces their results.
+	if err := os.WriteFile(input+".checkpoint", []byte(`{"completed_through":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, _ = runCommand(t, "", "campaign", "--credentials", testCredentials, "--input", input, "--template", template)
+	if code != exitOK || !strings.Contains(stdout, `"skipped": 1`) {
+		t.Errorf("expected the first row to be skipped, got %d: %s", code, stdout)
+	}
+	if results, err = os.ReadFile(output.Results); err != nil {
+		t.Fatalf("expected results file, got %v", err)
+	}
+	if lines := strings.Count(string(results), "\n"); lines != 2 {
+		t.Errorf("expected a single result line per row, got %s", results)
+	}
+}
+
+func TestRun_CampaignRate(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "recipients.csv")
+	template := filepath.Join(dir, "template.json")
+	if err := os.WriteFile(input, []byte("token\na\nb\nc\nd\ne\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(template, []byte(`{"message":{"token":"{{.token}}"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	withServer(t, func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"name":"projects/project_id/messages/1"}`
+	})
+
+	start := time.Now()
+	code, _, stderr := runCommand(t, "", "campaign", "--credentials", testCredentials,
+		"--input", input, "--template", template, "--rate", "100")
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected 5 sends at 100/s to take at least 40ms, took %v", elapsed)
+	}
+}
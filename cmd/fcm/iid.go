@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+func runSubscribe(ctx context.Context, env *env, args []string) (interface{}, error) {
+	return manageTopic(ctx, env, "subscribe", args, (*fcm.FCMClient).SubscribeToTopic)
+}
+
+func runUnsubscribe(ctx context.Context, env *env, args []string) (interface{}, error) {
+	return manageTopic(ctx, env, "unsubscribe", args, (*fcm.FCMClient).UnsubscribeFromTopic)
+}
+
+type topicFunc func(f *fcm.FCMClient, ctx context.Context, topic string, tokens []string) (*fcm.TopicManagementResponse, error)
+
+func manageTopic(ctx context.Context, env *env, name string, args []string, manage topicFunc) (interface{}, error) {
+	fs, cf := newFlagSet(env, name)
+	var topic, tokensFile string
+	var tokens stringsFlag
+	fs.StringVar(&topic, "topic", "", "topic name")
+	fs.Var(&tokens, "token", "registration token, may be repeated")
+	fs.StringVar(&tokensFile, "tokens-file", "", "file with one registration token per line")
+	if err := parseFlags(env, fs, args); err != nil {
+		return nil, err
+	}
+
+	if tokensFile != "" {
+		fileTokens, err := readLines(tokensFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+	if topic == "" {
+		return nil, &usageError{message: "-topic is required"}
+	}
+	if len(tokens) == 0 {
+		return nil, &usageError{message: "-token or -tokens-file is required"}
+	}
+
+	client, err := cf.newClient(env)
+	if err != nil {
+		return nil, err
+	}
+	return manage(client, ctx, topic, tokens)
+}
+
+func runTokenInfo(ctx context.Context, env *env, args []string) (interface{}, error) {
+	fs, cf := newFlagSet(env, "token-info")
+	var token string
+	fs.StringVar(&token, "token", "", "registration token")
+	if err := parseFlags(env, fs, args); err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, &usageError{message: "-token is required"}
+	}
+
+	client, err := cf.newClient(env)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetTokenInfo(ctx, token)
+}
+
+// readLines returns the non-empty lines of the file.
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+func TestRun_Subscribe(t *testing.T) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens.txt")
+	if err := os.WriteFile(tokensFile, []byte("b\n\nc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name        string
+		command     string
+		expectedURL string
+	}{
+		{name: "subscribe", command: "subscribe", expectedURL: fcm.IID_BATCH_ADD_URL},
+		{name: "unsubscribe", command: "unsubscribe", expectedURL: fcm.IID_BATCH_REMOVE_URL},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tokens []string
+			withServer(t, func(req *http.Request) (int, string) {
+				if req.URL.String() != tc.expectedURL {
+					t.Errorf("expected %s, got %s", tc.expectedURL, req.URL)
+				}
+				var body struct {
+					Tokens []string `json:"registration_tokens"`
+				}
+				_ = json.NewDecoder(req.Body).Decode(&body)
+				tokens = body.Tokens
+				return http.StatusOK, `{"results":[{},{"error":"NOT_FOUND"},{}]}`
+			})
+
+			code, stdout, stderr := runCommand(t, "", tc.command, "--credentials", testCredentials,
+				"--topic", "news", "--token", "a", "--tokens-file", tokensFile)
+			if code != exitOK {
+				t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr)
+			}
+			if !reflect.DeepEqual(tokens, []string{"a", "b", "c"}) {
+				t.Errorf("expected tokens [a b c], got %v", tokens)
+			}
+
+			var output fcm.TopicManagementResponse
+			if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+				t.Fatalf("expected JSON output, got %q", stdout)
+			}
+			if output.SuccessCount != 2 || output.FailureCount != 1 {
+				t.Errorf("expected 2 successes and 1 failure, got %+v", output)
+			}
+		})
+	}
+}
+
+func TestRun_TokenInfo(t *testing.T) {
+	withServer(t, func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"application":"com.example.app","platform":"ANDROID"}`
+	})
+
+	code, stdout, stderr := runCommand(t, "", "token-info", "--credentials", testCredentials, "--token", "token")
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+	var info fcm.TokenInfo
+	if err := json.Unmarshal([]byte(stdout), &info); err != nil {
+		t.Fatalf("expected JSON output, got %q", stdout)
+	}
+	if info.Application != "com.example.app" || info.Platform != "ANDROID" {
+		t.Errorf("expected token info, got %+v", info)
+	}
+
+	if code, _, _ := runCommand(t, "", "token-info", "--credentials", testCredentials); code != exitUsage {
+		t.Errorf("expected exit code %d without token, got %d", exitUsage, code)
+	}
+}
@@ -0,0 +1,271 @@
+// Command fcm sends and debugs Firebase Cloud Messaging pushes from the command line.
+//
+// Usage:
+//
+//	fcm <command> [flags]
+//
+// The commands are:
+//
+//	send                     send a message to a token, topic or condition
+//	validate                 validate a message with FCM without delivering it
+//	subscribe                subscribe registration tokens to a topic
+//	unsubscribe              unsubscribe registration tokens from a topic
+//	token-info               print the details of a registration token
+//	campaign                 send a templated message to every row of a CSV or JSONL file
+//	auth print-access-token  print an OAuth 2.0 access token for the service account
+//
+// Every command reads the service account from the --credentials flag, or from Application
+// Default Credentials (the GOOGLE_APPLICATION_CREDENTIALS environment variable) when it is
+// not given. Results are printed to stdout as JSON; errors are printed to stderr as JSON
+// and make the command exit with a non-zero status.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+// Exit codes of the command.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// httpClient is the HTTP client of the FCM clients created by the commands.
+var httpClient fcm.HttpClient = http.DefaultClient
+
+// command is a subcommand of the fcm tool. run returns the result printed as JSON on success.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, env *env, args []string) (interface{}, error)
+}
+
+var commands = []command{
+	{name: "send", summary: "send a message to a token, topic or condition", run: runSend},
+	{name: "validate", summary: "validate a message with FCM without delivering it", run: runValidate},
+	{name: "subscribe", summary: "subscribe registration tokens to a topic", run: runSubscribe},
+	{name: "unsubscribe", summary: "unsubscribe registration tokens from a topic", run: runUnsubscribe},
+	{name: "token-info", summary: "print the details of a registration token", run: runTokenInfo},
+	{name: "campaign", summary: "send a templated message to every row of a CSV or JSONL file", run: runCampaign},
+	{name: "auth", summary: "print-access-token: print an OAuth 2.0 access token", run: runAuth},
+}
+
+// env holds the standard streams of the command.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// usageError is returned for invalid command lines.
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+// run runs the command line args and returns the exit code.
+func run(ctx context.Context, args []string, env *env) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage(env.stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		result, err := cmd.run(ctx, env, args[1:])
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		if err != nil {
+			writeJSON(env.stderr, errorOutput{Error: describeError(err)})
+			var usageErr *usageError
+			if errors.As(err, &usageErr) {
+				return exitUsage
+			}
+			return exitError
+		}
+		if result != nil {
+			writeJSON(env.stdout, result)
+		}
+		return exitOK
+	}
+
+	writeJSON(env.stderr, errorOutput{Error: describeError(&usageError{message: fmt.Sprintf("unknown command %q", args[0])})})
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: fcm <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "fcm <command> -h" for the flags of a command.`)
+}
+
+// clientFlags are the flags shared by every command creating an FCM client.
+type clientFlags struct {
+	credentials string
+	verbose     bool
+}
+
+// newFlagSet creates the flag set of a command with the flags shared by every command.
+func newFlagSet(env *env, name string) (*flag.FlagSet, *clientFlags) {
+	fs := flag.NewFlagSet("fcm "+name, flag.ContinueOnError)
+	// Parse errors are reported as JSON by run, so the flag package must not print them.
+	fs.SetOutput(io.Discard)
+	cf := &clientFlags{}
+	fs.StringVar(&cf.credentials, "credentials", "", "service account file (default: Application Default Credentials)")
+	fs.BoolVar(&cf.verbose, "verbose", false, "log requests to stderr")
+	return fs, cf
+}
+
+// parseFlags parses args, reporting invalid flags and unexpected arguments as usage errors.
+func parseFlags(env *env, fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(env.stderr, "Usage of %s:\n", fs.Name())
+			fs.SetOutput(env.stderr)
+			fs.PrintDefaults()
+			return err
+		}
+		return &usageError{message: err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return &usageError{message: fmt.Sprintf("unexpected arguments: %s", strings.Join(fs.Args(), " "))}
+	}
+	return nil
+}
+
+// newClient creates an FCM client with the credentials given by the flags.
+func (cf *clientFlags) newClient(env *env) (*fcm.FCMClient, error) {
+	var credentials *fcm.Credentials
+	var err error
+	if cf.credentials != "" {
+		credentials, err = fcm.ReadCredentialsFile(cf.credentials)
+	} else {
+		credentials, err = fcm.FindDefaultCredentials()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := fcm.NewClient().SetHTTPClient(httpClient).SetCredentials(credentials)
+	if cf.verbose {
+		client.SetLogger(slog.New(slog.NewTextHandler(env.stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	}
+	return client, nil
+}
+
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// keyValueFlag is a repeatable key=value flag.
+type keyValueFlag map[string]string
+
+func (kv keyValueFlag) String() string {
+	keys := make([]string, 0, len(kv))
+	for k, v := range kv {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func (kv keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	kv[key] = val
+	return nil
+}
+
+// errorOutput is the JSON document printed for failed commands.
+type errorOutput struct {
+	Error errorDetails `json:"error"`
+}
+
+type errorDetails struct {
+	// Type is one of usage, validation, fcm or error.
+	Type       string        `json:"type"`
+	Message    string        `json:"message"`
+	Code       fcm.ErrorCode `json:"code,omitempty"`
+	Status     string        `json:"status,omitempty"`
+	HTTPStatus int           `json:"http_status,omitempty"`
+	Violations []violation   `json:"violations,omitempty"`
+}
+
+type violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// describeError converts err into its JSON representation.
+func describeError(err error) errorDetails {
+	details := errorDetails{Type: "error", Message: err.Error()}
+
+	var usageErr *usageError
+	var fcmErr *fcm.FCMError
+	var validationErrs fcm.ValidationErrors
+	switch {
+	case errors.As(err, &usageErr):
+		details.Type = "usage"
+	case errors.As(err, &fcmErr):
+		details.Type = "fcm"
+		details.Code = fcmErr.Code
+		details.Status = fcmErr.Status
+		details.HTTPStatus = fcmErr.StatusCode
+	case errors.As(err, &validationErrs):
+		details.Type = "validation"
+		for _, e := range validationErrs {
+			details.Violations = append(details.Violations, violation{Field: e.Field, Message: e.Err.Error()})
+		}
+	}
+	return details
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+const testCredentials = "../../testdata/service_test.json"
+
+type testHTTPClient func(req *http.Request) (*http.Response, error)
+
+func (c testHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c(req)
+}
+
+// withServer makes the FCM clients of the commands answer every API request with handle,
+// and every access token request with the token "access".
+func withServer(t *testing.T, handle func(req *http.Request) (int, string)) {
+	t.Helper()
+	previous := httpClient
+	t.Cleanup(func() { httpClient = previous })
+	httpClient = testHTTPClient(func(req *http.Request) (*http.Response, error) {
+		status, body := http.StatusOK, `{"access_token":"access"}`
+		if req.URL.Host != "oauth2.googleapis.com" {
+			status, body = handle(req)
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+}
+
+// runCommand runs the command line and returns its exit code, stdout and stderr.
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr})
+	return code, stdout.String(), stderr.String()
+}
+
+func decodeError(t *testing.T, stderr string) errorDetails {
+	t.Helper()
+	var output errorOutput
+	if err := json.Unmarshal([]byte(stderr), &output); err != nil {
+		t.Fatalf("expected JSON error, got %q", stderr)
+	}
+	return output.Error
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name         string
+		args         []string
+		expectedCode int
+		expectedType string
+	}{
+		{name: "without command", args: nil, expectedCode: exitUsage},
+		{name: "help", args: []string{"help"}, expectedCode: exitOK},
+		{name: "unknown command", args: []string{"push"}, expectedCode: exitUsage, expectedType: "usage"},
+		{name: "unknown flag", args: []string{"send", "--nope"}, expectedCode: exitUsage, expectedType: "usage"},
+		{name: "missing credentials", args: []string{"send", "--credentials", "missing.json", "--topic", "news"}, expectedCode: exitError, expectedType: "error"},
+		{name: "unknown auth command", args: []string{"auth", "login"}, expectedCode: exitUsage, expectedType: "usage"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, stderr := runCommand(t, "", tc.args...)
+			if code != tc.expectedCode {
+				t.Errorf("expected exit code %d, got %d", tc.expectedCode, code)
+			}
+			if tc.expectedType != "" {
+				if details := decodeError(t, stderr); details.Type != tc.expectedType {
+					t.Errorf("expected %s error, got %+v", tc.expectedType, details)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_FCMError(t *testing.T) {
+	withServer(t, func(req *http.Request) (int, string) {
+		return http.StatusNotFound, `{"error":{"status":"NOT_FOUND","message":"Requested entity was not found.","details":[` +
+			`{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`
+	})
+
+	code, _, stderr := runCommand(t, "", "send", "--credentials", testCredentials, "--token", "stale")
+	if code != exitError {
+		t.Errorf("expected exit code %d, got %d", exitError, code)
+	}
+	expected := errorDetails{
+		Type:       "fcm",
+		Message:    "NOT_FOUND: Requested entity was not found.",
+		Code:       fcm.ErrorCodeUnregistered,
+		Status:     "NOT_FOUND",
+		HTTPStatus: http.StatusNotFound,
+	}
+	if details := decodeError(t, stderr); details.Type != expected.Type || details.Code != expected.Code ||
+		details.Status != expected.Status || details.HTTPStatus != expected.HTTPStatus || details.Message != expected.Message {
+		t.Errorf("expected %+v, got %+v", expected, details)
+	}
+}
+
+func TestRun_AuthPrintAccessToken(t *testing.T) {
+	withServer(t, func(req *http.Request) (int, string) {
+		t.Errorf("expected no API request, got %s", req.URL)
+		return http.StatusInternalServerError, ""
+	})
+
+	code, stdout, stderr := runCommand(t, "", "auth", "print-access-token", "--credentials", testCredentials)
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+	if stdout != "access\n" {
+		t.Errorf("expected the bare access token, got %q", stdout)
+	}
+}
+
+func TestRun_DefaultCredentials(t *testing.T) {
+	withServer(t, func(req *http.Request) (int, string) { return http.StatusOK, "" })
+	t.Setenv(fcm.CredentialsEnvVar, testCredentials)
+
+	if code, _, stderr := runCommand(t, "", "auth", "print-access-token"); code != exitOK {
+		t.Errorf("expected exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+}
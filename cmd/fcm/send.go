@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+// messageFlags are the flags describing the message of the send and validate commands.
+type messageFlags struct {
+	token     string
+	topic     string
+	condition string
+	title     string
+	body      string
+	image     string
+	data      keyValueFlag
+	file      string
+}
+
+// sendResult is the result of the send and validate commands.
+type sendResult struct {
+	Name         string `json:"name"`
+	MessageID    string `json:"message_id"`
+	ValidateOnly bool   `json:"validate_only,omitempty"`
+}
+
+func runSend(ctx context.Context, env *env, args []string) (interface{}, error) {
+	return sendMessage(ctx, env, "send", args, false)
+}
+
+func runValidate(ctx context.Context, env *env, args []string) (interface{}, error) {
+	return sendMessage(ctx, env, "validate", args, true)
+}
+
+func sendMessage(ctx context.Context, env *env, name string, args []string, validateOnly bool) (interface{}, error) {
+	fs, cf := newFlagSet(env, name)
+	mf := &messageFlags{data: keyValueFlag{}}
+	fs.StringVar(&mf.token, "token", "", "registration token of the target device")
+	fs.StringVar(&mf.topic, "topic", "", "target topic")
+	fs.StringVar(&mf.condition, "condition", "", "target condition, e.g. \"'news' in topics\"")
+	fs.StringVar(&mf.title, "title", "", "notification title")
+	fs.StringVar(&mf.body, "body", "", "notification body")
+	fs.StringVar(&mf.image, "image", "", "notification image URL")
+	fs.Var(mf.data, "data", "data `key=value` pair, may be repeated")
+	fs.StringVar(&mf.file, "file", "", "FCM v1 request body {\"message\": {...}} to send, or - for stdin; other flags override its fields")
+	if err := parseFlags(env, fs, args); err != nil {
+		return nil, err
+	}
+
+	payload, err := mf.payload(env)
+	if err != nil {
+		return nil, err
+	}
+	payload.ValidateOnly = validateOnly
+
+	client, err := cf.newClient(env)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.SendContext(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return sendResult{Name: res.Name, MessageID: res.MessageID(), ValidateOnly: validateOnly}, nil
+}
+
+// payload builds the message described by the flags.
+func (mf *messageFlags) payload(env *env) (*fcm.MessagePayload, error) {
+	targets := 0
+	for _, target := range []string{mf.token, mf.topic, mf.condition} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return nil, &usageError{message: "only one of -token, -topic or -condition may be set"}
+	}
+
+	if mf.file == "" {
+		builder := fcm.NewMessage()
+		switch {
+		case mf.token != "":
+			builder.ToToken(mf.token)
+		case mf.topic != "":
+			builder.ToTopic(mf.topic)
+		case mf.condition != "":
+			builder.ToCondition(mf.condition)
+		default:
+			return nil, &usageError{message: "one of -token, -topic, -condition or -file is required"}
+		}
+		if mf.title != "" {
+			builder.Title(mf.title)
+		}
+		if mf.body != "" {
+			builder.Body(mf.body)
+		}
+		if mf.image != "" {
+			builder.Image(mf.image)
+		}
+		for k, v := range mf.data {
+			builder.Data(k, v)
+		}
+		return builder.Build()
+	}
+
+	var data []byte
+	var err error
+	if mf.file == "-" {
+		data, err = io.ReadAll(env.stdin)
+	} else {
+		data, err = os.ReadFile(mf.file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	payload, err := fcm.ParseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &payload.Message
+	if mf.token != "" || mf.topic != "" || mf.condition != "" {
+		msg.Token, msg.Topic, msg.Condition = mf.token, mf.topic, mf.condition
+	}
+	if mf.title != "" || mf.body != "" || mf.image != "" {
+		if msg.Notification == nil {
+			msg.Notification = &fcm.Notification{}
+		}
+		if mf.title != "" {
+			msg.Notification.Title = mf.title
+		}
+		if mf.body != "" {
+			msg.Notification.Body = mf.body
+		}
+		if mf.image != "" {
+			msg.Notification.Image = mf.image
+		}
+	}
+	for k, v := range mf.data {
+		if msg.Data == nil {
+			msg.Data = make(map[string]string)
+		}
+		msg.Data[k] = v
+	}
+	return payload, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRun_Send(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "message.json")
+	if err := os.WriteFile(file, []byte(`{"message":{"topic":"news","notification":{"title":"From file"},"data":{"a":"1"}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name            string
+		args            []string
+		stdin           string
+		expectedMessage map[string]interface{}
+		expectedOutput  sendResult
+	}{
+		{
+			name: "send with flags",
+			args: []string{"send", "--token", "token", "--title", "Hello", "--body", "World", "--data", "order_id=42"},
+			expectedMessage: map[string]interface{}{
+				"token":        "token",
+				"notification": map[string]interface{}{"title": "Hello", "body": "World"},
+				"data":         map[string]interface{}{"order_id": "42"},
+			},
+			expectedOutput: sendResult{Name: "projects/project_id/messages/1", MessageID: "1"},
+		},
+		{
+			name: "send file with overrides",
+			args: []string{"send", "--file", file, "--condition", "'news' in topics", "--data", "b=2"},
+			expectedMessage: map[string]interface{}{
+				"condition":    "'news' in topics",
+				"notification": map[string]interface{}{"title": "From file"},
+				"data":         map[string]interface{}{"a": "1", "b": "2"},
+			},
+			expectedOutput: sendResult{Name: "projects/project_id/messages/1", MessageID: "1"},
+		},
+		{
+			name:  "validate from stdin",
+			args:  []string{"validate", "--file", "-"},
+			stdin: `{"message":{"token":"token","future_field":true}}`,
+			expectedMessage: map[string]interface{}{
+				"token":        "token",
+				"future_field": true,
+			},
+			expectedOutput: sendResult{Name: "projects/project_id/messages/1", MessageID: "1", ValidateOnly: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent struct {
+				ValidateOnly bool                   `json:"validate_only"`
+				Message      map[string]interface{} `json:"message"`
+			}
+			withServer(t, func(req *http.Request) (int, string) {
+				data, _ := io.ReadAll(req.Body)
+				if err := json.Unmarshal(data, &sent); err != nil {
+					t.Errorf("expected JSON request body, got %s", data)
+				}
+				return http.StatusOK, `{"name":"projects/project_id/messages/1"}`
+			})
+
+			code, stdout, stderr := runCommand(t, tc.stdin, append(tc.args, "--credentials", testCredentials)...)
+			if code != exitOK {
+				t.Fatalf("expected exit code %d, got %d: %s", exitOK, code, stderr)
+			}
+			if !reflect.DeepEqual(sent.Message, tc.expectedMessage) {
+				t.Errorf("expected message %v, got %v", tc.expectedMessage, sent.Message)
+			}
+			if sent.ValidateOnly != tc.expectedOutput.ValidateOnly {
+				t.Errorf("expected validate_only %v, got %v", tc.expectedOutput.ValidateOnly, sent.ValidateOnly)
+			}
+
+			var output sendResult
+			if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+				t.Fatalf("expected JSON output, got %q", stdout)
+			}
+			if output != tc.expectedOutput {
+				t.Errorf("expected output %+v, got %+v", tc.expectedOutput, output)
+			}
+		})
+	}
+}
+
+func TestRun_SendInvalid(t *testing.T) {
+	withServer(t, func(req *http.Request) (int, string) {
+		t.Errorf("expected no request for an invalid message, got %s", req.URL)
+		return http.StatusOK, ""
+	})
+
+	testCases := []struct {
+		name         string
+		args         []string
+		expectedCode int
+		expectedType string
+	}{
+		{name: "without target", args: []string{"send"}, expectedCode: exitUsage, expectedType: "usage"},
+		{name: "with several targets", args: []string{"send", "--token", "abc", "--topic", "news"}, expectedCode: exitUsage, expectedType: "usage"},
+		{name: "with reserved data key", args: []string{"send", "--topic", "news", "--data", "from=x"}, expectedCode: exitError, expectedType: "validation"},
+		{name: "with invalid data flag", args: []string{"send", "--topic", "news", "--data", "novalue"}, expectedCode: exitUsage, expectedType: "usage"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, stderr := runCommand(t, "", append(tc.args, "--credentials", testCredentials)...)
+			if code != tc.expectedCode {
+				t.Errorf("expected exit code %d, got %d", tc.expectedCode, code)
+			}
+			if details := decodeError(t, stderr); details.Type != tc.expectedType {
+				t.Errorf("expected %s error, got %+v", tc.expectedType, details)
+			}
+		})
+	}
+}
@@ -1,6 +1,14 @@
 package fcm
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CredentialsEnvVar is the environment variable naming the service account file of
+// Application Default Credentials.
+const CredentialsEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
 
 // Credentials represents the service account credentials required to authenticate with the FCM server.
 type Credentials struct {
@@ -44,3 +52,36 @@ func (c *Credentials) Validate() error {
 	}
 	return nil
 }
+
+// ReadCredentialsFile reads and validates the service account credentials stored in the given file.
+func ReadCredentialsFile(path string) (*Credentials, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials Credentials
+	if err := json.Unmarshal(file, &credentials); err != nil {
+		return nil, fmt.Errorf("parsing credentials file %s: %w", path, err)
+	}
+	if credentials.Type != "" && credentials.Type != "service_account" {
+		return nil, fmt.Errorf("credentials file %s: unsupported credentials type %q, a service account is required", path, credentials.Type)
+	}
+	if err := credentials.Validate(); err != nil {
+		return nil, fmt.Errorf("credentials file %s: %w", path, err)
+	}
+	return &credentials, nil
+}
+
+// FindDefaultCredentials reads the service account credentials file named by the
+// GOOGLE_APPLICATION_CREDENTIALS environment variable, as Application Default Credentials do.
+// Only service account JSON files are supported: the user credentials written by
+// "gcloud auth application-default login" and the credentials of the metadata server of
+// Google Cloud runtimes cannot be used.
+func FindDefaultCredentials() (*Credentials, error) {
+	path := os.Getenv(CredentialsEnvVar)
+	if path == "" {
+		return nil, fmt.Errorf("no credentials found: set %s or pass a service account file", CredentialsEnvVar)
+	}
+	return ReadCredentialsFile(path)
+}
@@ -1,6 +1,8 @@
 package fcm
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -103,3 +105,55 @@ func TestCredentials_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestReadCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+	userCredentials := filepath.Join(dir, "user.json")
+	if err := os.WriteFile(userCredentials, []byte(`{"type":"authorized_user","refresh_token":"x"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		path       string
+		expectsErr bool
+	}{
+		{name: "service account", path: testServiceAccountFile},
+		{name: "missing file", path: filepath.Join(dir, "missing.json"), expectsErr: true},
+		{name: "authorized user", path: userCredentials, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credentials, err := ReadCredentialsFile(tc.path)
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if credentials.ProjectID != "project_id" {
+				t.Errorf("expected project_id, got %q", credentials.ProjectID)
+			}
+		})
+	}
+}
+
+func TestFindDefaultCredentials(t *testing.T) {
+	t.Setenv(CredentialsEnvVar, testServiceAccountFile)
+	credentials, err := FindDefaultCredentials()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if credentials.ProjectID != "project_id" {
+		t.Errorf("expected project_id, got %q", credentials.ProjectID)
+	}
+
+	t.Setenv(CredentialsEnvVar, "")
+	if _, err := FindDefaultCredentials(); err == nil {
+		t.Error("expected error without credentials, got nil")
+	}
+}
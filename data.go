@@ -0,0 +1,278 @@
+package fcm
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// DataFromStruct converts a struct into a data payload suitable for Message.Data.
+//
+// Each exported field becomes a key named after its `fcm` struct tag, or the field name
+// if the tag is missing. A tag of "-" skips the field and the "omitempty" option skips
+// zero values. Strings are sent as is, numbers and bools are formatted with strconv,
+// durations with time.Duration.String, types implementing encoding.TextMarshaler
+// (such as time.Time) with MarshalText, and any other value is JSON encoded.
+// Nil pointers are omitted. Fields of embedded structs are promoted.
+//
+//	type OrderUpdate struct {
+//		OrderID   int64     `fcm:"order_id"`
+//		Shipped   bool      `fcm:"shipped"`
+//		UpdatedAt time.Time `fcm:"updated_at"`
+//		Items     []Item    `fcm:"items,omitempty"`
+//	}
+func DataFromStruct(v interface{}) (map[string]string, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("fcm: DataFromStruct of nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("fcm: DataFromStruct of non-struct type %s", rv.Type())
+	}
+
+	data := make(map[string]string)
+	if err := encodeDataFields(rv, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DecodeData populates the struct pointed to by v from a data payload.
+// It is the inverse of DataFromStruct and uses the same `fcm` struct tags.
+// Keys without a matching field are ignored, as are fields without a matching key.
+func DecodeData(data map[string]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("fcm: DecodeData requires a non-nil pointer to a struct, got %T", v)
+	}
+	return decodeDataFields(data, rv.Elem())
+}
+
+// DataSize returns the size in bytes of the data payload once serialized to JSON,
+// which must not exceed MaxPayloadSize together with the notification payload.
+func DataSize(data map[string]string) int {
+	if len(data) == 0 {
+		return 0
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return 0
+	}
+	return len(encoded)
+}
+
+// dataField describes a struct field mapped to a data key.
+type dataField struct {
+	key       string
+	omitEmpty bool
+}
+
+// parseDataField returns the data key for the struct field, and false if the field is skipped.
+func parseDataField(field reflect.StructField) (dataField, bool) {
+	if !field.IsExported() {
+		return dataField{}, false
+	}
+	tag := field.Tag.Get("fcm")
+	if tag == "-" {
+		return dataField{}, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return dataField{key: name, omitEmpty: options == "omitempty"}, true
+}
+
+func isEmbeddedStruct(field reflect.StructField) bool {
+	if !field.Anonymous || field.Tag.Get("fcm") != "" {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func encodeDataFields(rv reflect.Value, data map[string]string) error {
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		value := rv.Field(i)
+
+		if isEmbeddedStruct(field) {
+			if value.Kind() == reflect.Pointer {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			if err := encodeDataFields(value, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		df, ok := parseDataField(field)
+		if !ok {
+			continue
+		}
+		if df.omitEmpty && value.IsZero() {
+			continue
+		}
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+
+		encoded, err := encodeDataValue(value)
+		if err != nil {
+			return fmt.Errorf("fcm: encoding field %s: %w", field.Name, err)
+		}
+		data[df.key] = encoded
+	}
+	return nil
+}
+
+func encodeDataValue(v reflect.Value) (string, error) {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String(), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if reflect.PointerTo(v.Type()).Implements(textMarshalerType) {
+		// MarshalText has a pointer receiver, like the UnmarshalText used to decode the value.
+		if !v.CanAddr() {
+			addressable := reflect.New(v.Type()).Elem()
+			addressable.Set(v)
+			v = addressable
+		}
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+
+	encoded, err := json.Marshal(v.Interface())
+	return string(encoded), err
+}
+
+func decodeDataFields(data map[string]string, rv reflect.Value) error {
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		value := rv.Field(i)
+
+		if isEmbeddedStruct(field) {
+			if value.Kind() == reflect.Pointer {
+				if value.IsNil() {
+					if !value.CanSet() {
+						continue
+					}
+					value.Set(reflect.New(field.Type.Elem()))
+				}
+				value = value.Elem()
+			}
+			if err := decodeDataFields(data, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		df, ok := parseDataField(field)
+		if !ok {
+			continue
+		}
+		raw, ok := data[df.key]
+		if !ok {
+			continue
+		}
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				value.Set(reflect.New(field.Type.Elem()))
+			}
+			value = value.Elem()
+		}
+
+		if err := decodeDataValue(raw, value); err != nil {
+			return fmt.Errorf("fcm: decoding key %q into field %s: %w", df.key, field.Name, err)
+		}
+	}
+	return nil
+}
+
+func decodeDataValue(raw string, v reflect.Value) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+
+	return json.Unmarshal([]byte(raw), v.Addr().Interface())
+}
@@ -0,0 +1,174 @@
+package fcm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testDataItem struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+type testDataMeta struct {
+	Campaign string `fcm:"campaign"`
+}
+
+type testDataPayload struct {
+	testDataMeta
+	OrderID   int64          `fcm:"order_id"`
+	Total     float64        `fcm:"total"`
+	Shipped   bool           `fcm:"shipped"`
+	Status    string         `fcm:"status"`
+	UpdatedAt time.Time      `fcm:"updated_at"`
+	ETA       time.Duration  `fcm:"eta"`
+	Items     []testDataItem `fcm:"items"`
+	Coupon    *string        `fcm:"coupon"`
+	Note      string         `fcm:"note,omitempty"`
+	Internal  string         `fcm:"-"`
+	Untagged  uint8
+	private   string
+}
+
+func TestDataFromStruct(t *testing.T) {
+	payload := testDataPayload{
+		testDataMeta: testDataMeta{Campaign: "spring"},
+		OrderID:      42,
+		Total:        19.99,
+		Shipped:      true,
+		Status:       "in_transit",
+		UpdatedAt:    time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+		ETA:          90 * time.Minute,
+		Items:        []testDataItem{{SKU: "A-1", Quantity: 2}},
+		Internal:     "secret",
+		Untagged:     7,
+		private:      "ignored",
+	}
+
+	data, err := DataFromStruct(&payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := map[string]string{
+		"campaign":   "spring",
+		"order_id":   "42",
+		"total":      "19.99",
+		"shipped":    "true",
+		"status":     "in_transit",
+		"updated_at": "2024-03-01T12:30:00Z",
+		"eta":        "1h30m0s",
+		"items":      `[{"sku":"A-1","quantity":2}]`,
+		"Untagged":   "7",
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+
+	var decoded testDataPayload
+	if err := DecodeData(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	payload.Internal = ""
+	payload.private = ""
+	if !reflect.DeepEqual(decoded, payload) {
+		t.Errorf("expected round trip to produce %+v, got %+v", payload, decoded)
+	}
+}
+
+// testDataLevel implements encoding.TextMarshaler and encoding.TextUnmarshaler with pointer receivers.
+type testDataLevel struct {
+	level int
+}
+
+func (l *testDataLevel) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("*", l.level)), nil
+}
+
+func (l *testDataLevel) UnmarshalText(text []byte) error {
+	l.level = len(text)
+	return nil
+}
+
+func TestDataFromStruct_PointerTextMarshaler(t *testing.T) {
+	type payload struct {
+		Level testDataLevel `fcm:"level"`
+	}
+	for _, value := range []interface{}{payload{Level: testDataLevel{3}}, &payload{Level: testDataLevel{3}}} {
+		data, err := DataFromStruct(value)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if data["level"] != "***" {
+			t.Errorf("expected the level to be encoded with MarshalText, got %q", data["level"])
+		}
+
+		var decoded payload
+		if err := DecodeData(data, &decoded); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if decoded.Level.level != 3 {
+			t.Errorf("expected round trip to produce level 3, got %d", decoded.Level.level)
+		}
+	}
+}
+
+func TestDataFromStruct_InvalidInput(t *testing.T) {
+	var nilPayload *testDataPayload
+	testCases := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "nil pointer", value: nilPayload},
+		{name: "non struct", value: map[string]string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DataFromStruct(tc.value); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestDecodeData(t *testing.T) {
+	testCases := []struct {
+		name       string
+		data       map[string]string
+		target     interface{}
+		expectsErr bool
+	}{
+		{name: "pointer field", data: map[string]string{"coupon": "SAVE10"}, target: &testDataPayload{}},
+		{name: "invalid number", data: map[string]string{"order_id": "forty-two"}, target: &testDataPayload{}, expectsErr: true},
+		{name: "invalid bool", data: map[string]string{"shipped": "yes"}, target: &testDataPayload{}, expectsErr: true},
+		{name: "invalid time", data: map[string]string{"updated_at": "yesterday"}, target: &testDataPayload{}, expectsErr: true},
+		{name: "invalid json", data: map[string]string{"items": "["}, target: &testDataPayload{}, expectsErr: true},
+		{name: "non pointer target", data: map[string]string{}, target: testDataPayload{}, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := DecodeData(tc.data, tc.target)
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDataSize(t *testing.T) {
+	if size := DataSize(nil); size != 0 {
+		t.Errorf("expected 0, got %d", size)
+	}
+	if size := DataSize(map[string]string{"k": "v"}); size != len(`{"k":"v"}`) {
+		t.Errorf("expected %d, got %d", len(`{"k":"v"}`), size)
+	}
+	if size := DataSize(map[string]string{"blob": strings.Repeat("a", MaxPayloadSize)}); size <= MaxPayloadSize {
+		t.Errorf("expected size over %d, got %d", MaxPayloadSize, size)
+	}
+}
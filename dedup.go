@@ -0,0 +1,251 @@
+package fcm
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDedupWindow is how long a deduplication key is remembered when no window is configured.
+	DefaultDedupWindow = time.Hour
+	// DefaultDedupCapacity is the number of keys remembered by the default DedupStore.
+	DefaultDedupCapacity = 100000
+)
+
+// DedupStore records the message sent for each deduplication key. The keys it is given are the keys
+// passed to WithDedupKey, followed by a colon and the recipient of the message: its registration token
+// redacted by RedactToken, its topic as /topics/<name>, or its condition.
+// Implementations must be safe for concurrent use.
+type DedupStore interface {
+	// Get returns the message name recorded for key, and false if there is none or it has expired.
+	Get(ctx context.Context, key string) (name string, ok bool, err error)
+	// Set records the message name for key until ttl elapses.
+	Set(ctx context.Context, key, name string, ttl time.Duration) error
+}
+
+// dedupKeyContextKey is the context key of the deduplication key of a send.
+type dedupKeyContextKey struct{}
+
+// WithDedupKey returns a context making the send it is given to idempotent: once a message has been
+// sent with key, the following sends of the same message with the same key within the deduplication
+// window of the client are not sent again, and return the response of the original message, with
+// Deduplicated set. The key is scoped to the recipient of the message, so that the messages sent to
+// other devices or topics with a context derived from ctx are not mistaken for duplicates, while a
+// message rendered again for the same recipient, even with a different content, is.
+// Sends with ValidateOnly set deliver nothing, so they are neither deduplicated nor record the key.
+// Concurrent sends with the same key wait for the first one to complete. A failed send does not
+// record the key, so it can be retried.
+func WithDedupKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, dedupKeyContextKey{}, key)
+}
+
+// SetDedupStore sets the store recording the deduplication keys of the sends, and how long they are
+// remembered. A zero window defaults to DefaultDedupWindow. By default the keys are recorded in a
+// MemoryDedupStore of DefaultDedupCapacity keys, which is only shared by the sends of the client;
+// use a shared store to deduplicate the sends of several processes.
+// It is not safe to call SetDedupStore concurrently with sending messages.
+func (f *FCMClient) SetDedupStore(store DedupStore, window time.Duration) *FCMClient {
+	f.dedupStore = store
+	f.dedupWindow = window
+	return f
+}
+
+// dedupCall is a send in progress for a deduplication key.
+type dedupCall struct {
+	done chan struct{}
+	res  *SendResponse
+	err  error
+}
+
+// dedup holds the sends in progress by deduplication key, and the default store of the client.
+type dedup struct {
+	once         sync.Once
+	defaultStore DedupStore
+	mu           sync.Mutex
+	calls        map[string]*dedupCall
+}
+
+// sendOnce calls send unless a message has already been sent with the deduplication key of ctx.
+// Bodies only validated by FCM are always sent, and do not record the key: nothing was delivered.
+func (f *FCMClient) sendOnce(ctx context.Context, body []byte, send func() (*SendResponse, error)) (*SendResponse, error) {
+	key, _ := ctx.Value(dedupKeyContextKey{}).(string)
+	if key == "" || validateOnly(body) {
+		return send()
+	}
+	f.dedup.once.Do(func() {
+		f.dedup.calls = make(map[string]*dedupCall)
+		f.dedup.defaultStore = NewMemoryDedupStore(DefaultDedupCapacity)
+	})
+
+	storeKey := dedupStoreKey(key, body)
+	for {
+		f.dedup.mu.Lock()
+		if call, ok := f.dedup.calls[storeKey]; ok {
+			f.dedup.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if call.err == nil {
+				return f.deduplicated(ctx, key, call.res.Name), nil
+			}
+			// The send in progress failed, so this one is attempted.
+			continue
+		}
+		call := &dedupCall{done: make(chan struct{})}
+		f.dedup.calls[storeKey] = call
+		f.dedup.mu.Unlock()
+
+		call.res, call.err = f.sendWithDedup(ctx, key, storeKey, send)
+
+		f.dedup.mu.Lock()
+		delete(f.dedup.calls, storeKey)
+		f.dedup.mu.Unlock()
+		close(call.done)
+		return call.res, call.err
+	}
+}
+
+// sendWithDedup returns the response recorded in the store for storeKey, or calls send and records
+// its response. key is the deduplication key given by the caller, used in the logs.
+func (f *FCMClient) sendWithDedup(ctx context.Context, key, storeKey string, send func() (*SendResponse, error)) (*SendResponse, error) {
+	store := f.dedupStore
+	if store == nil {
+		store = f.dedup.defaultStore
+	}
+	name, ok, err := store.Get(ctx, storeKey)
+	if err != nil {
+		return nil, fmt.Errorf("fcm: reading dedup key: %w", err)
+	}
+	if ok {
+		return f.deduplicated(ctx, key, name), nil
+	}
+
+	res, err := send()
+	if err != nil {
+		return nil, err
+	}
+	window := f.dedupWindow
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	if err := store.Set(ctx, storeKey, res.Name, window); err != nil {
+		// The message was sent, so the send succeeds; only its deduplication is lost.
+		f.log().LogAttrs(ctx, slog.LevelWarn, "fcm: recording dedup key failed",
+			slog.String("dedup_key", key), slog.String("error", err.Error()))
+	}
+	return res, nil
+}
+
+// dedupStoreKey returns the key recording the send of body with the deduplication key, scoped to
+// the recipient of the message.
+func dedupStoreKey(key string, body []byte) string {
+	var request struct {
+		Message struct {
+			Token     string   `json:"token"`
+			Tokens    []string `json:"tokens"`
+			Topic     string   `json:"topic"`
+			Condition string   `json:"condition"`
+		} `json:"message"`
+	}
+	_ = json.Unmarshal(body, &request)
+	msg := request.Message
+	switch {
+	case msg.Token != "":
+		return key + ":" + RedactToken(msg.Token)
+	case len(msg.Tokens) == 1:
+		return key + ":" + RedactToken(msg.Tokens[0])
+	case msg.Topic != "":
+		return key + ":/topics/" + msg.Topic
+	}
+	return key + ":" + msg.Condition
+}
+
+// validateOnly reports whether the request body asks FCM to validate the message without delivering it.
+func validateOnly(body []byte) bool {
+	var request struct {
+		ValidateOnly bool `json:"validate_only"`
+	}
+	return json.Unmarshal(body, &request) == nil && request.ValidateOnly
+}
+
+// deduplicated returns the response of a send suppressed as a duplicate of the message name.
+func (f *FCMClient) deduplicated(ctx context.Context, key, name string) *SendResponse {
+	res := &SendResponse{Name: name, Deduplicated: true}
+	f.log().LogAttrs(ctx, slog.LevelInfo, "fcm: duplicate send suppressed",
+		slog.String("dedup_key", key), slog.String("message_id", res.MessageID()))
+	return res
+}
+
+// MemoryDedupStore is a DedupStore keeping the most recently used keys in memory.
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	// recency orders the entries from the most to the least recently used.
+	recency *list.List
+	now     func() time.Time
+}
+
+type dedupEntry struct {
+	key       string
+	name      string
+	expiresAt time.Time
+}
+
+// NewMemoryDedupStore returns a MemoryDedupStore remembering up to capacity keys, evicting the
+// least recently used ones beyond. A capacity that is not positive defaults to DefaultDedupCapacity.
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = DefaultDedupCapacity
+	}
+	return &MemoryDedupStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		recency:  list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get implements DedupStore.
+func (s *MemoryDedupStore) Get(ctx context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+	entry := element.Value.(*dedupEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.recency.Remove(element)
+		delete(s.entries, key)
+		return "", false, nil
+	}
+	s.recency.MoveToFront(element)
+	return entry.name, true, nil
+}
+
+// Set implements DedupStore.
+func (s *MemoryDedupStore) Set(ctx context.Context, key, name string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &dedupEntry{key: key, name: name, expiresAt: s.now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.recency.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.recency.PushFront(entry)
+	for s.recency.Len() > s.capacity {
+		oldest := s.recency.Back()
+		s.recency.Remove(oldest)
+		delete(s.entries, oldest.Value.(*dedupEntry).key)
+	}
+	return nil
+}
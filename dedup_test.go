@@ -0,0 +1,238 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDedupClient(sends *int, status func() int) *FCMClient {
+	var mu sync.Mutex
+	return NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetHTTPClient(&testHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if !strings.HasSuffix(req.URL.Path, "messages:send") {
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+				}
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				*sends++
+				body := fmt.Sprintf(`{"name":"projects/project_id/messages/%d"}`, *sends)
+				mu.Unlock()
+				return &http.Response{StatusCode: status(), Body: io.NopCloser(strings.NewReader(body))}, nil
+			},
+		})
+}
+
+func TestWithDedupKey(t *testing.T) {
+	sends := 0
+	status := 200
+	client := newTestDedupClient(&sends, func() int { return status })
+	msg := &MessagePayload{Message: Message{Token: "token"}}
+
+	first, err := client.SendContext(WithDedupKey(context.Background(), "order-1"), msg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	repeated, err := client.SendContext(WithDedupKey(context.Background(), "order-1"), msg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if sends != 1 {
+		t.Errorf("expected the repeated key not to be sent, got %d sends", sends)
+	}
+	if first.Deduplicated || !repeated.Deduplicated || repeated.MessageID() != first.MessageID() {
+		t.Errorf("expected the original message ID, got %+v and %+v", first, repeated)
+	}
+
+	if _, err := client.SendContext(WithDedupKey(context.Background(), "order-2"), msg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.SendContext(context.Background(), msg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if sends != 3 {
+		t.Errorf("expected other keys and sends without key to be sent, got %d sends", sends)
+	}
+
+	// A failed send does not record its key.
+	status = 503
+	if _, err := client.SendContext(WithDedupKey(context.Background(), "order-3"), msg); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	status = 200
+	res, err := client.SendContext(WithDedupKey(context.Background(), "order-3"), msg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res.Deduplicated || sends != 5 {
+		t.Errorf("expected the failed send to be retried, got %+v after %d sends", res, sends)
+	}
+}
+
+func TestWithDedupKey_Concurrent(t *testing.T) {
+	sends := 0
+	client := newTestDedupClient(&sends, func() int { return 200 })
+	ctx := WithDedupKey(context.Background(), "order-1")
+
+	var wg sync.WaitGroup
+	responses := make([]*SendResponse, 10)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := client.SendContext(ctx, &MessagePayload{Message: Message{Token: "token"}})
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+			responses[i] = res
+		}(i)
+	}
+	wg.Wait()
+
+	if sends != 1 {
+		t.Errorf("expected a single send, got %d", sends)
+	}
+	deduplicated := 0
+	for _, res := range responses {
+		if res != nil && res.Deduplicated {
+			deduplicated++
+		}
+	}
+	if deduplicated != 9 {
+		t.Errorf("expected 9 deduplicated sends, got %d", deduplicated)
+	}
+}
+
+func TestWithDedupKey_ValidateOnly(t *testing.T) {
+	sends := 0
+	client := newTestDedupClient(&sends, func() int { return 200 })
+	ctx := WithDedupKey(context.Background(), "order-1")
+
+	for _, validateOnly := range []bool{true, true, false} {
+		res, err := client.SendContext(ctx, &MessagePayload{ValidateOnly: validateOnly, Message: Message{Token: "token"}})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if res.Deduplicated {
+			t.Errorf("expected the send with validate_only %v not to be deduplicated", validateOnly)
+		}
+	}
+	if sends != 3 {
+		t.Errorf("expected the dry runs not to record the key, got %d sends", sends)
+	}
+}
+
+func TestWithDedupKey_OtherMessage(t *testing.T) {
+	sends := 0
+	client := newTestDedupClient(&sends, func() int { return 200 })
+	ctx := WithDedupKey(context.Background(), "order-1")
+
+	first, err := client.SendContext(ctx, &MessagePayload{Message: Message{Token: "a"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	other, err := client.SendContext(ctx, &MessagePayload{Message: Message{Token: "b"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if other.Deduplicated || other.MessageID() == first.MessageID() {
+		t.Errorf("expected the message to another token to be sent, got %+v", other)
+	}
+	// The message rendered again for the same device is a duplicate, even if its content changed.
+	repeated, err := client.SendContext(ctx, &MessagePayload{Message: Message{Token: "b", Data: map[string]string{"sent_at": "now"}}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !repeated.Deduplicated || repeated.MessageID() != other.MessageID() || sends != 2 {
+		t.Errorf("expected the repeated message to be deduplicated, got %+v after %d sends", repeated, sends)
+	}
+
+	topic, err := client.SendContext(ctx, &MessagePayload{Message: Message{Topic: "b"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if topic.Deduplicated || sends != 3 {
+		t.Errorf("expected the message to a topic to be sent, got %+v after %d sends", topic, sends)
+	}
+}
+
+func TestSetDedupStore(t *testing.T) {
+	sends := 0
+	now := time.Now()
+	store := NewMemoryDedupStore(10)
+	store.now = func() time.Time { return now }
+	client := newTestDedupClient(&sends, func() int { return 200 }).SetDedupStore(store, time.Minute)
+	ctx := WithDedupKey(context.Background(), "order-1")
+
+	body := []byte(`{"message":{"token":"token"}}`)
+	if _, err := client.SendRaw(ctx, body); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if name, ok, _ := store.Get(ctx, "order-1:"+RedactToken("token")); !ok || name != "projects/project_id/messages/1" {
+		t.Errorf("expected the message name to be recorded, got %q", name)
+	}
+
+	now = now.Add(time.Minute)
+	if res, err := client.SendRaw(ctx, body); err != nil || res.Deduplicated {
+		t.Errorf("expected the key to expire after the window, got %+v, %v", res, err)
+	}
+	if sends != 2 {
+		t.Errorf("expected 2 sends, got %d", sends)
+	}
+
+	// A store set after the first keyed send replaces the one in use.
+	other := NewMemoryDedupStore(10)
+	client.SetDedupStore(other, time.Minute)
+	if res, err := client.SendRaw(ctx, body); err != nil || res.Deduplicated {
+		t.Errorf("expected the key to be unknown to the new store, got %+v, %v", res, err)
+	}
+	if _, ok, _ := other.Get(ctx, "order-1:"+RedactToken("token")); !ok {
+		t.Error("expected the key to be recorded in the new store")
+	}
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryDedupStore(2)
+	store.now = func() time.Time { return now }
+
+	store.Set(ctx, "a", "name-a", time.Minute)
+	store.Set(ctx, "b", "name-b", time.Hour)
+	store.Get(ctx, "a")
+	store.Set(ctx, "c", "name-c", time.Hour)
+
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Error("expected the least recently used key to be evicted")
+	}
+	if name, ok, _ := store.Get(ctx, "a"); !ok || name != "name-a" {
+		t.Errorf("expected name-a, got %q", name)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("expected the key to expire")
+	}
+	if name, ok, _ := store.Get(ctx, "c"); !ok || name != "name-c" {
+		t.Errorf("expected name-c, got %q", name)
+	}
+}
+
+func TestNewMemoryDedupStore_Capacity(t *testing.T) {
+	ctx := context.Background()
+	for _, capacity := range []int{0, -1} {
+		store := NewMemoryDedupStore(capacity)
+		store.Set(ctx, "a", "name-a", time.Hour)
+		if name, ok, _ := store.Get(ctx, "a"); !ok || name != "name-a" {
+			t.Errorf("expected capacity %d to default to DefaultDedupCapacity, got %q", capacity, name)
+		}
+	}
+}
@@ -15,7 +15,7 @@
 // err := client.Send(&MessagePayload{
 // 	Message: Message{
 // 		Token: "test",
-// 		Notification: Notification{
+// 		Notification: &Notification{
 // 			Title: "Coming Soon!",
 // 			Body:  "Stay tuned for the latest features and improvements. We are constantly working to improve your experience.",
 // 		},
@@ -0,0 +1,121 @@
+package fcm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorCode is the error code of a failed FCM request.
+// See https://firebase.google.com/docs/reference/fcm/rest/v1/ErrorCode.
+type ErrorCode string
+
+const (
+	ErrorCodeUnspecified      ErrorCode = "UNSPECIFIED_ERROR"
+	ErrorCodeInvalidArgument  ErrorCode = "INVALID_ARGUMENT"
+	ErrorCodeUnregistered     ErrorCode = "UNREGISTERED"
+	ErrorCodeSenderIDMismatch ErrorCode = "SENDER_ID_MISMATCH"
+	ErrorCodeQuotaExceeded    ErrorCode = "QUOTA_EXCEEDED"
+	ErrorCodeUnavailable      ErrorCode = "UNAVAILABLE"
+	ErrorCodeInternal         ErrorCode = "INTERNAL"
+	ErrorCodeThirdPartyAuth   ErrorCode = "THIRD_PARTY_AUTH_ERROR"
+)
+
+// fcmErrorType is the type of the error details carrying the FCM specific error code.
+const fcmErrorType = "type.googleapis.com/google.firebase.fcm.v1.FcmError"
+
+// badRequestType is the type of the error details listing the invalid fields of a request.
+const badRequestType = "type.googleapis.com/google.rpc.BadRequest"
+
+// FieldViolation describes an invalid field of a rejected request.
+type FieldViolation struct {
+	// Field is the path of the invalid field, such as message.token.
+	Field string `json:"field"`
+	// Description explains why the field is invalid.
+	Description string `json:"description"`
+}
+
+// FCMError is returned when the FCM server rejects a request.
+type FCMError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code is the FCM error code, such as UNREGISTERED. When the response does not carry one,
+	// it is derived from the HTTP status code, and CodeFromStatus is set.
+	Code ErrorCode
+	// CodeFromStatus is set when Code was derived from the HTTP status code rather than read from
+	// the FcmError details of the response, such as for a 404 response of a proxy.
+	CodeFromStatus bool
+	// Status is the canonical status of the error, such as NOT_FOUND.
+	Status string
+	// Message is the error message returned by the server.
+	Message string
+	// RetryAfter is the delay requested by the Retry-After header, if any.
+	RetryAfter time.Duration
+	// FieldViolations lists the invalid fields of the request, when the server reports them.
+	FieldViolations []FieldViolation
+}
+
+func (e *FCMError) Error() string {
+	if e.Status == "" && e.Message == "" {
+		return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+	}
+	if e.Status == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
+// Retryable reports whether the request may succeed if sent again later.
+func (e *FCMError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// ErrorCodeOf returns the FCM error code of err, or an empty code if err is not an *FCMError.
+func ErrorCodeOf(err error) ErrorCode {
+	var fcmErr *FCMError
+	if errors.As(err, &fcmErr) {
+		return fcmErr.Code
+	}
+	return ""
+}
+
+// errorCodeFromStatus returns the error code FCM documents for the HTTP status code.
+func errorCodeFromStatus(statusCode int) ErrorCode {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrorCodeInvalidArgument
+	case http.StatusUnauthorized:
+		return ErrorCodeThirdPartyAuth
+	case http.StatusForbidden:
+		return ErrorCodeSenderIDMismatch
+	case http.StatusNotFound:
+		return ErrorCodeUnregistered
+	case http.StatusTooManyRequests:
+		return ErrorCodeQuotaExceeded
+	case http.StatusInternalServerError:
+		return ErrorCodeInternal
+	case http.StatusServiceUnavailable:
+		return ErrorCodeUnavailable
+	}
+	return ErrorCodeUnspecified
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
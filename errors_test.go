@@ -0,0 +1,181 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleResponse_Error(t *testing.T) {
+	testCases := []struct {
+		name          string
+		statusCode    int
+		header        http.Header
+		body          string
+		expectedCode  ErrorCode
+		fromStatus    bool
+		expectedError string
+		retryAfter    time.Duration
+		violations    []FieldViolation
+	}{
+		{
+			name:       "with fcm error details",
+			statusCode: 404,
+			body: `{"error":{"code":404,"status":"NOT_FOUND","message":"Requested entity was not found.","details":[` +
+				`{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`,
+			expectedCode:  ErrorCodeUnregistered,
+			expectedError: "NOT_FOUND: Requested entity was not found.",
+		},
+		{
+			name:          "without details",
+			statusCode:    400,
+			body:          `{"error":{"status":"INVALID_ARGUMENT","message":"testing"}}`,
+			expectedCode:  ErrorCodeInvalidArgument,
+			fromStatus:    true,
+			expectedError: "INVALID_ARGUMENT: testing",
+		},
+		{
+			name:       "with field violations",
+			statusCode: 400,
+			body: `{"error":{"status":"INVALID_ARGUMENT","message":"Invalid registration token","details":[` +
+				`{"@type":"type.googleapis.com/google.rpc.BadRequest","fieldViolations":[{"field":"message.token","description":"Invalid registration token"}]}]}}`,
+			expectedCode:  ErrorCodeInvalidArgument,
+			fromStatus:    true,
+			expectedError: "INVALID_ARGUMENT: Invalid registration token",
+			violations:    []FieldViolation{{Field: "message.token", Description: "Invalid registration token"}},
+		},
+		{
+			name:          "without body",
+			statusCode:    503,
+			header:        http.Header{"Retry-After": []string{"30"}},
+			expectedCode:  ErrorCodeUnavailable,
+			fromStatus:    true,
+			expectedError: "unexpected status code 503",
+			retryAfter:    30 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewClient().handleResponse(&http.Response{
+				StatusCode: tc.statusCode,
+				Header:     tc.header,
+				Body:       io.NopCloser(strings.NewReader(tc.body)),
+			})
+
+			var fcmErr *FCMError
+			if !errors.As(err, &fcmErr) {
+				t.Fatalf("expected *FCMError, got %v", err)
+			}
+			if fcmErr.Code != tc.expectedCode {
+				t.Errorf("expected code %s, got %s", tc.expectedCode, fcmErr.Code)
+			}
+			if fcmErr.CodeFromStatus != tc.fromStatus {
+				t.Errorf("expected code from status %v, got %v", tc.fromStatus, fcmErr.CodeFromStatus)
+			}
+			if fcmErr.Error() != tc.expectedError {
+				t.Errorf("expected error %q, got %q", tc.expectedError, fcmErr.Error())
+			}
+			if fcmErr.RetryAfter != tc.retryAfter {
+				t.Errorf("expected retry after %v, got %v", tc.retryAfter, fcmErr.RetryAfter)
+			}
+			if !reflect.DeepEqual(fcmErr.FieldViolations, tc.violations) {
+				t.Errorf("expected field violations %v, got %v", tc.violations, fcmErr.FieldViolations)
+			}
+		})
+	}
+}
+
+func TestSend_Retry(t *testing.T) {
+	testCases := []struct {
+		name             string
+		maxRetries       int
+		statuses         []int
+		expectedAttempts int
+		expectsErr       bool
+	}{
+		{name: "retries until success", maxRetries: 2, statuses: []int{503, 500, 200}, expectedAttempts: 3},
+		{name: "gives up after max retries", maxRetries: 1, statuses: []int{429, 429, 200}, expectedAttempts: 2, expectsErr: true},
+		{name: "does not retry client errors", maxRetries: 2, statuses: []int{400, 200}, expectedAttempts: 1, expectsErr: true},
+		{name: "does not retry by default", statuses: []int{503, 200}, expectedAttempts: 1, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			client := NewClient().
+				SetCredentialFile(testServiceAccountFile).
+				SetMaxRetries(tc.maxRetries).
+				SetHTTPClient(&testHttpClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						body := `{"name":"projects/project_id/messages/1"}`
+						if !strings.HasSuffix(req.URL.Path, "messages:send") {
+							return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+						}
+						status := tc.statuses[attempts]
+						attempts++
+						return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}, nil
+					},
+				})
+			client.retryBackoff = time.Millisecond
+
+			_, err := client.SendContext(context.Background(), &MessagePayload{Message: Message{Token: "token"}})
+			if tc.expectsErr && err == nil {
+				t.Error("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if attempts != tc.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", tc.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      *FCMError
+		attempt  int
+		expected time.Duration
+	}{
+		{name: "first retry", err: &FCMError{}, attempt: 1, expected: time.Second},
+		{name: "exponential", err: &FCMError{}, attempt: 4, expected: 8 * time.Second},
+		{name: "capped", err: &FCMError{}, attempt: 10, expected: maxRetryBackoff},
+		{name: "overflowing", err: &FCMError{}, attempt: 100, expected: maxRetryBackoff},
+		{name: "retry after", err: &FCMError{RetryAfter: 5 * time.Minute}, attempt: 100, expected: 5 * time.Minute},
+	}
+
+	client := NewClient()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := client.retryDelay(tc.err, tc.attempt); actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "120", expected: 2 * time.Minute},
+		{value: "Fri, 01 Mar 2024 12:00:10 GMT", expected: 10 * time.Second},
+		{value: "soon", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		if result := parseRetryAfter(tc.value, now); result != tc.expected {
+			t.Errorf("parseRetryAfter(%q): expected %v, got %v", tc.value, tc.expected, result)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package fcm
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+var analyticsLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9-_.~%]{1,50}$`)
+
+// FcmOptions represents the platform independent FCM options of a message.
+type FcmOptions struct {
+	// AnalyticsLabel is the label associated with the message's analytics data,
+	// used to segment delivery reports in the Firebase console.
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+// Validate checks that the options are well formed.
+func (o *FcmOptions) Validate() error {
+	return validateAnalyticsLabel(o.AnalyticsLabel)
+}
+
+// AndroidFcmOptions represents the FCM options for Android messages.
+type AndroidFcmOptions struct {
+	// AnalyticsLabel is the label associated with the message's analytics data.
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+// Validate checks that the options are well formed.
+func (o *AndroidFcmOptions) Validate() error {
+	return validateAnalyticsLabel(o.AnalyticsLabel)
+}
+
+// APNSFcmOptions represents the FCM options for APNs messages.
+type APNSFcmOptions struct {
+	// AnalyticsLabel is the label associated with the message's analytics data.
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+	// Image is the HTTPS URL of an image displayed in the notification.
+	// It requires the app to download the image in a notification service extension.
+	Image string `json:"image,omitempty"`
+}
+
+// Validate checks that the options are well formed.
+func (o *APNSFcmOptions) Validate() error {
+	if err := validateAnalyticsLabel(o.AnalyticsLabel); err != nil {
+		return err
+	}
+	if o.Image == "" {
+		return nil
+	}
+	image, err := url.Parse(o.Image)
+	if err != nil || image.Scheme != "https" || image.Host == "" {
+		return fmt.Errorf("apns fcm_options image must be an HTTPS URL")
+	}
+	return nil
+}
+
+// validateAnalyticsLabel checks the label against the format accepted by FCM.
+// An empty label is valid and leaves the field unset.
+func validateAnalyticsLabel(label string) error {
+	if label != "" && !analyticsLabelPattern.MatchString(label) {
+		return fmt.Errorf("analytics_label %q must be 1 to 50 characters from [a-zA-Z0-9-_.~%%]", label)
+	}
+	return nil
+}
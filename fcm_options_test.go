@@ -0,0 +1,104 @@
+package fcm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateAnalyticsLabel(t *testing.T) {
+	testCases := []struct {
+		name       string
+		label      string
+		expectsErr bool
+	}{
+		{name: "empty", label: ""},
+		{name: "valid", label: "spring-sale_2024.v1~%20"},
+		{name: "max length", label: strings.Repeat("a", 50)},
+		{name: "too long", label: strings.Repeat("a", 51), expectsErr: true},
+		{name: "with space", label: "spring sale", expectsErr: true},
+		{name: "with slash", label: "spring/sale", expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateAnalyticsLabel(tc.label)
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFcmOptions_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		message    Message
+		expectsErr bool
+	}{
+		{
+			name: "valid labels on every platform",
+			message: Message{
+				Topic:      "news",
+				FcmOptions: &FcmOptions{AnalyticsLabel: "campaign-1"},
+				Android:    &AndroidConfig{FcmOptions: &AndroidFcmOptions{AnalyticsLabel: "campaign-1"}},
+				APNS: &APNSConfig{FcmOptions: &APNSFcmOptions{
+					AnalyticsLabel: "campaign-1",
+					Image:          "https://example.com/image.png",
+				}},
+				Webpush: &WebpushConfig{FcmOptions: &WebpushFcmOptions{AnalyticsLabel: "campaign-1"}},
+			},
+		},
+		{
+			name:       "invalid message label",
+			message:    Message{Topic: "news", FcmOptions: &FcmOptions{AnalyticsLabel: "spring sale"}},
+			expectsErr: true,
+		},
+		{
+			name:       "invalid android label",
+			message:    Message{Topic: "news", Android: &AndroidConfig{FcmOptions: &AndroidFcmOptions{AnalyticsLabel: "a/b"}}},
+			expectsErr: true,
+		},
+		{
+			name:       "invalid apns image",
+			message:    Message{Topic: "news", APNS: &APNSConfig{FcmOptions: &APNSFcmOptions{Image: "http://example.com/a.png"}}},
+			expectsErr: true,
+		},
+		{
+			name:       "invalid webpush label",
+			message:    Message{Topic: "news", Webpush: &WebpushConfig{FcmOptions: &WebpushFcmOptions{AnalyticsLabel: "a b"}}},
+			expectsErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.message.Validate()
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFcmOptions_MarshalJSON(t *testing.T) {
+	msg := Message{
+		Topic:      "news",
+		FcmOptions: &FcmOptions{AnalyticsLabel: "campaign-1"},
+		APNS:       &APNSConfig{FcmOptions: &APNSFcmOptions{Image: "https://example.com/image.png"}},
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"topic":"news","apns":{"fcm_options":{"image":"https://example.com/image.png"}},` +
+		`"fcm_options":{"analytics_label":"campaign-1"}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
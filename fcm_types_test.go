@@ -0,0 +1,106 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+func TestMessagePayload_MarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name    string
+		payload *MessagePayload
+	}{
+		{
+			name: "data_only",
+			payload: &MessagePayload{
+				Message: Message{
+					Token: "test",
+					Data:  map[string]string{"order_id": "42", "status": "shipped"},
+				},
+			},
+		},
+		{
+			name: "notification_only",
+			payload: &MessagePayload{
+				Message: Message{
+					Topic: "news",
+					Notification: &Notification{
+						Title: "Coming Soon!",
+						Body:  "Stay tuned for the latest features and improvements.",
+					},
+				},
+			},
+		},
+		{
+			name: "mixed",
+			payload: &MessagePayload{
+				Message: Message{
+					Token: "test",
+					Notification: &Notification{
+						Title: "Order shipped",
+						Body:  "Your order is on its way",
+					},
+					Data: map[string]string{"order_id": "42"},
+					Android: &AndroidConfig{
+						Priority: AndroidMessagePriorityHigh,
+						TTL:      time.Hour,
+						Notification: &Notification{
+							Sound: "default",
+						},
+					},
+					APNS: &APNSConfig{
+						Priority: APNSPriorityHigh,
+						PushType: APNSPushTypeAlert,
+						Payload: &APNSPayload{
+							Aps: &Aps{Sound: "default"},
+						},
+					},
+					Webpush: &WebpushConfig{
+						Urgency:    WebpushUrgencyHigh,
+						FcmOptions: &WebpushFcmOptions{Link: "https://example.com/orders/42"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.payload)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			path := filepath.Join("testdata", "golden", tc.name+".json")
+			if *updateGolden {
+				var indented bytes.Buffer
+				if err := json.Indent(&indented, data, "", "  "); err != nil {
+					t.Fatal(err)
+				}
+				indented.WriteByte('\n')
+				if err := os.WriteFile(path, indented.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			golden, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expected bytes.Buffer
+			if err := json.Compact(&expected, golden); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, expected.Bytes()) {
+				t.Errorf("expected %s, got %s", expected.Bytes(), data)
+			}
+		})
+	}
+}
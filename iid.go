@@ -0,0 +1,192 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	IID_BATCH_ADD_URL    = "https://iid.googleapis.com/iid/v1:batchAdd"
+	IID_BATCH_REMOVE_URL = "https://iid.googleapis.com/iid/v1:batchRemove"
+	IID_INFO_URL         = "https://iid.googleapis.com/iid/info/%s?details=true"
+)
+
+// topicPattern matches the topic names accepted by FCM.
+var topicPattern = regexp.MustCompile(`^[a-zA-Z0-9-_.~%]{1,900}$`)
+
+// maxTopicManagementTokens is the maximum number of tokens of a single topic management request.
+const maxTopicManagementTokens = 1000
+
+// TopicManagementResponse is the result of subscribing tokens to or unsubscribing them from a topic.
+type TopicManagementResponse struct {
+	// SuccessCount is the number of tokens successfully (un)subscribed.
+	SuccessCount int `json:"success_count"`
+	// FailureCount is the number of tokens that could not be (un)subscribed.
+	FailureCount int `json:"failure_count"`
+	// Errors lists the tokens that could not be (un)subscribed.
+	Errors []TopicManagementError `json:"errors,omitempty"`
+}
+
+// TopicManagementError describes why a token could not be (un)subscribed.
+type TopicManagementError struct {
+	// Index is the index of the token in the request.
+	Index int `json:"index"`
+	// Reason is the error returned by the server, such as NOT_FOUND or INVALID_ARGUMENT.
+	Reason string `json:"reason"`
+}
+
+// TokenInfo describes a registration token as known by the Instance ID service.
+type TokenInfo struct {
+	Application        string    `json:"application,omitempty"`
+	ApplicationVersion string    `json:"applicationVersion,omitempty"`
+	AuthorizedEntity   string    `json:"authorizedEntity,omitempty"`
+	AppSigner          string    `json:"appSigner,omitempty"`
+	Platform           string    `json:"platform,omitempty"`
+	ConnectionType     string    `json:"connectionType,omitempty"`
+	ConnectDate        string    `json:"connectDate,omitempty"`
+	Scope              string    `json:"scope,omitempty"`
+	Rel                *TokenRel `json:"rel,omitempty"`
+}
+
+// TokenRel holds the relations of a registration token.
+type TokenRel struct {
+	// Topics maps the name of every topic the token is subscribed to to its subscription.
+	Topics map[string]TopicSubscription `json:"topics,omitempty"`
+}
+
+// TopicSubscription describes the subscription of a token to a topic.
+type TopicSubscription struct {
+	// AddDate is the date of the subscription, in the YYYY-MM-DD format.
+	AddDate string `json:"addDate"`
+}
+
+// SubscribeToTopic subscribes up to 1000 registration tokens to the topic.
+// It returns an error if the request fails; tokens rejected individually are reported in the response.
+func (f *FCMClient) SubscribeToTopic(ctx context.Context, topic string, tokens []string) (*TopicManagementResponse, error) {
+	return f.manageTopic(ctx, IID_BATCH_ADD_URL, topic, tokens)
+}
+
+// UnsubscribeFromTopic unsubscribes up to 1000 registration tokens from the topic.
+// It returns an error if the request fails; tokens rejected individually are reported in the response.
+func (f *FCMClient) UnsubscribeFromTopic(ctx context.Context, topic string, tokens []string) (*TopicManagementResponse, error) {
+	return f.manageTopic(ctx, IID_BATCH_REMOVE_URL, topic, tokens)
+}
+
+// GetTokenInfo returns the details of a registration token, including the topics it is subscribed to.
+func (f *FCMClient) GetTokenInfo(ctx context.Context, token string) (*TokenInfo, error) {
+	if token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	var info TokenInfo
+	if err := f.iidRequest(ctx, http.MethodGet, fmt.Sprintf(IID_INFO_URL, url.PathEscape(token)), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (f *FCMClient) manageTopic(ctx context.Context, endpoint, topic string, tokens []string) (*TopicManagementResponse, error) {
+	topic = strings.TrimPrefix(topic, "/topics/")
+	if topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+	if !topicPattern.MatchString(topic) {
+		return nil, fmt.Errorf("topic %q is invalid", topic)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens provided")
+	}
+	if len(tokens) > maxTopicManagementTokens {
+		return nil, fmt.Errorf("at most %d tokens can be provided, got %d", maxTopicManagementTokens, len(tokens))
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"to":                  "/topics/" + topic,
+		"registration_tokens": tokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := f.iidRequest(ctx, http.MethodPost, endpoint, body, &response); err != nil {
+		return nil, err
+	}
+
+	result := &TopicManagementResponse{}
+	for i, r := range response.Results {
+		if r.Error == "" {
+			result.SuccessCount++
+			continue
+		}
+		result.FailureCount++
+		result.Errors = append(result.Errors, TopicManagementError{Index: i, Reason: r.Error})
+		if reason, ok := topicManagementTokenError(r.Error); ok && i < len(tokens) {
+			f.invalidateToken(ctx, tokens[i], reason)
+		}
+	}
+	return result, nil
+}
+
+// topicManagementTokenError returns the error code of a topic management error reason meaning that
+// the token is no longer valid, and false for the other reasons.
+func topicManagementTokenError(reason string) (ErrorCode, bool) {
+	switch reason {
+	case "NOT_FOUND":
+		return ErrorCodeUnregistered, true
+	case "INVALID_ARGUMENT":
+		return ErrorCodeInvalidArgument, true
+	}
+	return "", false
+}
+
+// iidRequest makes an authorized request to the Instance ID API and decodes its JSON response into v.
+func (f *FCMClient) iidRequest(ctx context.Context, method, endpoint string, body []byte, v interface{}) error {
+	accessToken, err := f.AccessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("access_token_auth", "true")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := f.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var response struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&response)
+		return &FCMError{
+			StatusCode:     res.StatusCode,
+			Code:           errorCodeFromStatus(res.StatusCode),
+			CodeFromStatus: true,
+			Message:        response.Error,
+			RetryAfter:     parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
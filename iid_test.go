@@ -0,0 +1,153 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestIIDClient(t *testing.T, status int, body string, check func(req *http.Request)) *FCMClient {
+	t.Helper()
+	return NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetHTTPClient(&testHttpClient{
+			TokenFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"access_token":"access"}`))}, nil
+			},
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if !strings.HasPrefix(req.URL.String(), "https://iid.googleapis.com/") {
+					t.Errorf("expected IID request, got %s", req.URL)
+				}
+				if req.Header.Get("Authorization") != "Bearer access" || req.Header.Get("access_token_auth") != "true" {
+					t.Errorf("expected authorized IID request, got headers %v", req.Header)
+				}
+				if check != nil {
+					check(req)
+				}
+				return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}, nil
+			},
+		})
+}
+
+func TestSubscribeToTopic(t *testing.T) {
+	testCases := []struct {
+		name       string
+		topic      string
+		tokens     []string
+		status     int
+		body       string
+		expected   *TopicManagementResponse
+		expectsErr bool
+	}{
+		{
+			name:   "partial failure",
+			topic:  "/topics/news",
+			tokens: []string{"a", "b", "c"},
+			status: 200,
+			body:   `{"results":[{},{"error":"NOT_FOUND"},{}]}`,
+			expected: &TopicManagementResponse{
+				SuccessCount: 2,
+				FailureCount: 1,
+				Errors:       []TopicManagementError{{Index: 1, Reason: "NOT_FOUND"}},
+			},
+		},
+		{name: "without topic", tokens: []string{"a"}, expectsErr: true},
+		{name: "with invalid topic", topic: "news!", tokens: []string{"a"}, expectsErr: true},
+		{name: "without tokens", topic: "news", expectsErr: true},
+		{name: "with server error", topic: "news", tokens: []string{"a"}, status: 401, body: `{"error":"Unauthorized"}`, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestIIDClient(t, tc.status, tc.body, func(req *http.Request) {
+				if req.URL.String() != IID_BATCH_ADD_URL {
+					t.Errorf("expected %s, got %s", IID_BATCH_ADD_URL, req.URL)
+				}
+				var body map[string]interface{}
+				_ = json.NewDecoder(req.Body).Decode(&body)
+				if body["to"] != "/topics/news" {
+					t.Errorf("expected topic /topics/news, got %v", body["to"])
+				}
+			})
+
+			result, err := client.SubscribeToTopic(context.Background(), tc.topic, tc.tokens)
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeFromTopic(t *testing.T) {
+	client := newTestIIDClient(t, 200, `{"results":[{}]}`, func(req *http.Request) {
+		if req.URL.String() != IID_BATCH_REMOVE_URL {
+			t.Errorf("expected %s, got %s", IID_BATCH_REMOVE_URL, req.URL)
+		}
+	})
+
+	result, err := client.UnsubscribeFromTopic(context.Background(), "news", []string{"a"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.SuccessCount != 1 {
+		t.Errorf("expected 1 success, got %d", result.SuccessCount)
+	}
+}
+
+func TestGetTokenInfo(t *testing.T) {
+	body := `{"application":"com.example.app","platform":"ANDROID","rel":{"topics":{"news":{"addDate":"2024-03-01"}}}}`
+	client := newTestIIDClient(t, 200, body, func(req *http.Request) {
+		if req.Method != http.MethodGet || !strings.HasPrefix(req.URL.String(), "https://iid.googleapis.com/iid/info/tok%2Fen?details=true") {
+			t.Errorf("expected token info request, got %s %s", req.Method, req.URL)
+		}
+	})
+
+	info, err := client.GetTokenInfo(context.Background(), "tok/en")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := &TokenInfo{
+		Application: "com.example.app",
+		Platform:    "ANDROID",
+		Rel:         &TokenRel{Topics: map[string]TopicSubscription{"news": {AddDate: "2024-03-01"}}},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+
+	client = newTestIIDClient(t, 400, `{"error":"InvalidToken"}`, nil)
+	_, err = client.GetTokenInfo(context.Background(), "bad")
+	var fcmErr *FCMError
+	if !errors.As(err, &fcmErr) || fcmErr.Error() != "InvalidToken" || fcmErr.Code != ErrorCodeInvalidArgument {
+		t.Errorf("expected InvalidToken FCMError, got %v", err)
+	}
+}
+
+func TestAccessToken(t *testing.T) {
+	if _, err := NewClient().AccessToken(context.Background()); err == nil {
+		t.Error("expected error without credentials, got nil")
+	}
+
+	client := newTestIIDClient(t, 200, `{}`, nil)
+	token, err := client.AccessToken(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if token != "access" {
+		t.Errorf("expected access, got %q", token)
+	}
+}
@@ -0,0 +1,225 @@
+// Package jsonlog implements a durable map of JSON documents backed by an append-only log file.
+//
+// Every change is appended to the log as a JSON line and synced to disk before it returns; a failed
+// write is truncated from the log.
+// The log is replayed when opened, and rewritten without the superseded records once they
+// outnumber the live documents.
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// MinCompactRecords is the number of records a log must hold before it is compacted.
+const MinCompactRecords = 1024
+
+// Log is a map of JSON documents by key, persisted to a log file. It is safe for concurrent use.
+type Log struct {
+	mu     sync.Mutex
+	path   string
+	file   file
+	values map[string]json.RawMessage
+	// records is the number of records in the log file.
+	records int
+	// size is the length of the log file up to its last complete record.
+	size int64
+	// err is set when the log file could not be restored after a failed write. Every later
+	// change fails with it, since the file may no longer hold the documents of the log.
+	err error
+}
+
+// file is the log file, an *os.File.
+type file interface {
+	WriteAt(b []byte, off int64) (int, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// record is a line of the log. A record without value deletes the key.
+type record struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Open opens the log file at path, creating it if it does not exist.
+// A truncated last record, left by a crash during a write, is discarded.
+func Open(path string) (*Log, error) {
+	l := &Log{path: path, values: make(map[string]json.RawMessage)}
+	if err := l.replay(); err != nil {
+		return nil, err
+	}
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// replay loads the documents recorded in the log file.
+func (l *Log) replay() error {
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			if i == len(lines)-1 {
+				// The last record was not completely written.
+				return nil
+			}
+			return fmt.Errorf("%s:%d: %w", l.path, i+1, err)
+		}
+		l.apply(r)
+	}
+	return nil
+}
+
+// apply applies a record to the documents of the log.
+func (l *Log) apply(r record) {
+	if r.Value != nil {
+		l.values[r.Key] = r.Value
+	} else {
+		delete(l.values, r.Key)
+	}
+	l.records++
+}
+
+// Put stores value, encoded as JSON, under key.
+func (l *Log) Put(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return l.append(record{Key: key, Value: data})
+}
+
+// Delete removes the document stored under key. Deleting a missing key is not an error.
+func (l *Log) Delete(key string) error {
+	l.mu.Lock()
+	_, ok := l.values[key]
+	l.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return l.append(record{Key: key})
+}
+
+// Values returns the documents of the log, ordered by key.
+func (l *Log) Values() []json.RawMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.values))
+	for key := range l.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]json.RawMessage, len(keys))
+	for i, key := range keys {
+		values[i] = l.values[key]
+	}
+	return values
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// append writes r to the log file and applies it, compacting the log when needed.
+// A failed write is truncated from the file, so that no partial record is left before the next one.
+func (l *Log) append(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if _, err := l.file.WriteAt(data, l.size); err != nil {
+		return l.rollback(err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return l.rollback(err)
+	}
+	l.size += int64(len(data))
+	l.apply(r)
+
+	if l.records >= MinCompactRecords && l.records > 2*len(l.values) {
+		return l.compact()
+	}
+	return nil
+}
+
+// rollback truncates the log file to its last complete record after the write of a record failed
+// with err, and returns err. If the file cannot be truncated, the log fails every later change.
+func (l *Log) rollback(err error) error {
+	if truncErr := l.file.Truncate(l.size); truncErr != nil {
+		l.err = fmt.Errorf("jsonlog: %s: restoring the log after a failed write: %w", l.path, truncErr)
+		return l.err
+	}
+	return err
+}
+
+// compact atomically rewrites the log file with one record per document, and uses the new file for
+// the following records. If it fails, the log keeps using the current file.
+// It must be called with l.mu held, or before the log is shared.
+func (l *Log) compact() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for key, value := range l.values {
+		if err := encoder.Encode(record{Key: key, Value: value}); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	// The new file stays open, so that it is swapped in without being reopened once renamed.
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = tmp
+	l.size = int64(buf.Len())
+	l.records = len(l.values)
+	return nil
+}
@@ -0,0 +1,168 @@
+package jsonlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func values(l *Log) []string {
+	var values []string
+	for _, value := range l.Values() {
+		values = append(values, string(value))
+	}
+	return values
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, key := range []string{"b", "a", "c"} {
+		if err := l.Put(key, map[string]string{"key": key}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := l.Put("a", map[string]int{"n": 2}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, key := range []string{"c", "missing"} {
+		if err := l.Delete(key); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	expected := []string{`{"n":2}`, `{"key":"b"}`}
+	if actual := values(l); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected values %v, got %v", expected, actual)
+	}
+	l.Close()
+
+	// A crash during a write leaves a truncated record at the end of the log.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"key":"d","val`)
+	file.Close()
+
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer l.Close()
+	if actual := values(l); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected values %v after reopening, got %v", expected, actual)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("expected the log to be compacted to 2 records, got %d", lines)
+	}
+}
+
+// shortFile writes the first n bytes of the next write, then fails it.
+type shortFile struct {
+	file
+	n       int
+	failing bool
+}
+
+func (f *shortFile) WriteAt(b []byte, off int64) (int, error) {
+	if !f.failing {
+		return f.file.WriteAt(b, off)
+	}
+	f.failing = false
+	n, _ := f.file.WriteAt(b[:f.n], off)
+	return n, errors.New("short write")
+}
+
+func TestLog_FailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := l.Put("a", 1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	l.file = &shortFile{file: l.file, n: 5, failing: true}
+	if err := l.Put("b", 2); err == nil {
+		t.Fatal("expected error for a short write, got nil")
+	}
+	if err := l.Put("c", 3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	l.Close()
+
+	data, _ := os.ReadFile(path)
+	expected := `{"key":"a","value":1}` + "\n" + `{"key":"c","value":3}` + "\n"
+	if string(data) != expected {
+		t.Errorf("expected the partial record to be truncated, got %q", data)
+	}
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer l.Close()
+	if actual := values(l); !reflect.DeepEqual(actual, []string{"1", "3"}) {
+		t.Errorf("expected the values 1 and 3, got %v", actual)
+	}
+}
+
+func TestOpen_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(path, []byte("{\n{\"key\":\"a\",\"value\":1}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("expected error for a corrupt log, got nil")
+	}
+}
+
+func TestLog_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 0; i < MinCompactRecords; i++ {
+		key := fmt.Sprint(i)
+		if err := l.Put(key, i); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if i > 0 {
+			if err := l.Delete(key); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines >= MinCompactRecords {
+		t.Errorf("expected the log to be compacted, got %d records", lines)
+	}
+	if actual := values(l); !reflect.DeepEqual(actual, []string{"0"}) {
+		t.Errorf("expected the value 0, got %v", actual)
+	}
+
+	// The records written after a compaction go to the compacted file.
+	if err := l.Put("after", "compaction"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	l.Close()
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer l.Close()
+	if actual := values(l); !reflect.DeepEqual(actual, []string{"0", `"compaction"`}) {
+		t.Errorf("expected the values to survive reopening, got %v", actual)
+	}
+}
@@ -0,0 +1,20 @@
+// Package logging holds the logging helpers shared by the packages of the module.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Discard returns a logger discarding every record, used when no logger is configured.
+func Discard() *slog.Logger {
+	return slog.New(DiscardHandler{})
+}
+
+// DiscardHandler is a slog.Handler discarding every record.
+type DiscardHandler struct{}
+
+func (DiscardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (DiscardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d DiscardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d DiscardHandler) WithGroup(string) slog.Handler           { return d }
@@ -0,0 +1,219 @@
+// Package runner implements the dispatch loop shared by the background queues of the module.
+//
+// A Runner repeatedly asks its queue for the next due task and runs it in its own goroutine, up to
+// a maximum number of tasks at a time. When no task is due it sleeps until the next one is, or until
+// it is woken up because the queue changed. Shutdown stops the loop and waits for the running tasks,
+// cancelling their context if the wait is cut short.
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrStarted is returned by Start if the runner was already started or is shut down.
+var ErrStarted = errors.New("already started")
+
+// Timer is a single event, such as a time.Timer.
+type Timer interface {
+	// C returns the channel receiving the time once the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing.
+	Stop() bool
+}
+
+// NewTimer returns a Timer of the operating system firing once d has elapsed.
+func NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct{ *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+// Task is a unit of work run by a Runner. ctx is cancelled when the shutdown of the runner is cut short.
+type Task func(ctx context.Context)
+
+// NextFunc removes the next due task from the queue and returns it. If no task is due, it returns
+// a nil task and how long to wait for the next one to be due, or false if the queue is empty.
+type NextFunc func() (task Task, wait time.Duration, ok bool)
+
+// Runner runs the tasks of a queue in the background with bounded concurrency.
+type Runner struct {
+	concurrency int
+	newTimer    func(d time.Duration) Timer
+	next        NextFunc
+
+	mu       sync.Mutex
+	inFlight int
+	started  bool
+	closed   bool
+
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	tasks   sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// New returns a Runner running the tasks returned by next, up to concurrency at a time, and waiting
+// for the next task with the timers of newTimer.
+func New(concurrency int, newTimer func(d time.Duration) Timer, next NextFunc) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		concurrency: concurrency,
+		newTimer:    newTimer,
+		next:        next,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start calls load, to fill the queue, then runs the loop in the background. It returns
+// ErrStarted, without calling load, if the runner was already started or is shut down, and the
+// error of load if it fails, in which case the runner cannot be started again.
+func (r *Runner) Start(load func() error) error {
+	r.mu.Lock()
+	if r.started || r.closed {
+		r.mu.Unlock()
+		return ErrStarted
+	}
+	r.started = true
+	r.mu.Unlock()
+
+	if err := load(); err != nil {
+		close(r.stopped)
+		return err
+	}
+	go r.run()
+	return nil
+}
+
+// Closed reports whether Shutdown has been called.
+func (r *Runner) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Wake wakes the loop up, so that it asks the queue for the next task again.
+func (r *Runner) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown stops the loop and waits for the running tasks to return. If ctx is done first, the
+// context of the tasks is cancelled, and ctx.Err() is returned once they have returned.
+// Calling Shutdown again returns nil immediately.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	started := r.started
+	r.mu.Unlock()
+
+	defer r.cancel()
+	if !started {
+		return nil
+	}
+	close(r.stop)
+	<-r.stopped
+
+	done := make(chan struct{})
+	go func() {
+		r.tasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// run starts the due tasks until the runner is shut down.
+func (r *Runner) run() {
+	defer close(r.stopped)
+	for {
+		wait, ok := r.dispatch()
+		var timer Timer
+		var due <-chan time.Time
+		if ok {
+			timer = r.newTimer(wait)
+			due = timer.C()
+		}
+
+		select {
+		case <-r.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-r.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// dispatch starts the due tasks within the concurrency limit. It returns how long to wait for the
+// next task to be due, and false if there is none or the concurrency limit is reached.
+func (r *Runner) dispatch() (time.Duration, bool) {
+	for {
+		r.mu.Lock()
+		full := r.inFlight >= r.concurrency
+		r.mu.Unlock()
+		if full {
+			return 0, false
+		}
+
+		task, wait, ok := r.next()
+		if task == nil {
+			return wait, ok
+		}
+		r.mu.Lock()
+		r.inFlight++
+		r.mu.Unlock()
+		r.tasks.Add(1)
+		go r.do(task)
+	}
+}
+
+// do runs the task and wakes the loop up once it returns, as another task may now run.
+func (r *Runner) do(task Task) {
+	defer func() {
+		r.mu.Lock()
+		r.inFlight--
+		r.mu.Unlock()
+		r.Wake()
+		r.tasks.Done()
+	}()
+	task(r.ctx)
+}
+
+// NewID returns a random ID for an item of a queue.
+func NewID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testQueue is a queue of tasks that are all due.
+type testQueue struct {
+	mu    sync.Mutex
+	tasks []Task
+}
+
+func (q *testQueue) push(r *Runner, task Task) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	q.mu.Unlock()
+	r.Wake()
+}
+
+func (q *testQueue) next() (Task, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		return nil, 0, false
+	}
+	task := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return task, 0, true
+}
+
+func TestRunner(t *testing.T) {
+	queue := &testQueue{}
+	r := New(2, NewTimer, queue.next)
+	if err := r.Start(func() error { return nil }); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := r.Start(func() error { return nil }); !errors.Is(err, ErrStarted) {
+		t.Errorf("expected ErrStarted, got %v", err)
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight, done := 0, 0, 0
+	for i := 0; i < 6; i++ {
+		queue.push(r, func(ctx context.Context) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			done++
+			mu.Unlock()
+		})
+	}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		mu.Lock()
+		finished := done == 6
+		mu.Unlock()
+		if finished {
+			break
+		}
+	}
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if done != 6 || maxInFlight != 2 {
+		t.Errorf("expected 6 tasks run 2 at a time, got %d tasks and %d at a time", done, maxInFlight)
+	}
+	if !r.Closed() {
+		t.Error("expected the runner to be closed")
+	}
+}
+
+func TestRunner_Wait(t *testing.T) {
+	due := time.Now().Add(20 * time.Millisecond)
+	ran := make(chan time.Time, 1)
+	r := New(1, NewTimer, func() (Task, time.Duration, bool) {
+		if wait := time.Until(due); wait > 0 {
+			return nil, wait, true
+		}
+		if due.IsZero() {
+			return nil, 0, false
+		}
+		due = time.Time{}
+		return func(ctx context.Context) { ran <- time.Now() }, 0, true
+	})
+	start := time.Now()
+	if err := r.Start(func() error { return nil }); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer r.Shutdown(context.Background())
+
+	select {
+	case at := <-ran:
+		if elapsed := at.Sub(start); elapsed < 15*time.Millisecond {
+			t.Errorf("expected the task to wait until due, ran after %v", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the task to run once due")
+	}
+}
+
+func TestRunner_Shutdown(t *testing.T) {
+	queue := &testQueue{}
+	r := New(1, NewTimer, queue.next)
+	if err := r.Start(func() error { return nil }); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	started := make(chan struct{})
+	queue.push(r, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := r.Start(func() error { return nil }); !errors.Is(err, ErrStarted) {
+		t.Errorf("expected ErrStarted, got %v", err)
+	}
+}
+
+func TestRunner_LoadError(t *testing.T) {
+	r := New(1, NewTimer, (&testQueue{}).next)
+	if err := r.Start(func() error { return errors.New("unavailable") }); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- r.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Shutdown not to wait for a runner that failed to start")
+	}
+}
@@ -0,0 +1,298 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Bundle holds the translated notification strings of every supported locale.
+//
+// Catalog strings are text/template templates rendered with per-recipient data,
+// e.g. "Hi {{.Name}}, your order {{.OrderID}} has shipped".
+type Bundle struct {
+	defaultLocale string
+
+	mu        sync.RWMutex
+	catalogs  map[string]map[string]string
+	templates map[string]*template.Template
+	formats   map[string]func([]byte, interface{}) error
+}
+
+// NewBundle creates an empty Bundle. Strings missing from a locale fall back to
+// its parent locale (e.g. "pt-BR" to "pt") and finally to defaultLocale.
+func NewBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		defaultLocale: normalizeLocale(defaultLocale),
+		catalogs:      make(map[string]map[string]string),
+		templates:     make(map[string]*template.Template),
+		formats: map[string]func([]byte, interface{}) error{
+			".json": json.Unmarshal,
+		},
+	}
+}
+
+// catalogExtensions are the extensions LoadFS treats as catalog files even when no
+// format is registered for them.
+var catalogExtensions = map[string]bool{".json": true, ".yaml": true, ".yml": true}
+
+// RegisterFormat registers the function used by LoadFS to decode catalog files with the
+// given extension. JSON is supported out of the box; YAML catalogs can be loaded with
+//
+//	bundle.RegisterFormat(".yaml", yaml.Unmarshal)
+func (b *Bundle) RegisterFormat(ext string, unmarshal func([]byte, interface{}) error) *Bundle {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.formats[strings.ToLower(ext)] = unmarshal
+	return b
+}
+
+// AddMessages adds the key-value strings of a locale to the bundle,
+// replacing any existing string with the same key.
+func (b *Bundle) AddMessages(locale string, messages map[string]string) *Bundle {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	locale = normalizeLocale(locale)
+	catalog, ok := b.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]string, len(messages))
+		b.catalogs[locale] = catalog
+	}
+	for k, v := range messages {
+		catalog[k] = v
+		delete(b.templates, locale+"\x00"+k)
+	}
+	return b
+}
+
+// LoadFS loads every catalog file in dir of fsys. Each file holds a flat object of
+// key-value strings and is named after its locale, e.g. "en.json" or "pt-BR.yaml".
+// YAML catalogs (".yaml" or ".yml") without a registered format are an error, so a
+// locale is never dropped silently; other files, e.g. a README, are ignored.
+func (b *Bundle) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := path.Ext(entry.Name())
+		b.mu.RLock()
+		unmarshal, ok := b.formats[strings.ToLower(ext)]
+		b.mu.RUnlock()
+		if !ok {
+			if catalogExtensions[strings.ToLower(ext)] {
+				return fmt.Errorf("fcm: no format registered for catalog %s", entry.Name())
+			}
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		var messages map[string]string
+		if err := unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("fcm: parsing catalog %s: %w", entry.Name(), err)
+		}
+		b.AddMessages(strings.TrimSuffix(entry.Name(), ext), messages)
+	}
+	return nil
+}
+
+// Translate renders the string stored under key for the locale, using data for
+// its template placeholders. It returns an error if the key is not found in the
+// locale or any of its fallbacks.
+func (b *Bundle) Translate(locale, key string, data interface{}) (string, error) {
+	tmpl, err := b.lookup(locale, key)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("fcm: rendering %q: %w", key, err)
+	}
+	return buf.String(), nil
+}
+
+// lookup returns the parsed template of key for the first locale in the fallback chain that has it.
+func (b *Bundle) lookup(locale, key string) (*template.Template, error) {
+	for _, candidate := range b.fallbacks(locale) {
+		cacheKey := candidate + "\x00" + key
+
+		b.mu.RLock()
+		tmpl, cached := b.templates[cacheKey]
+		source, found := b.catalogs[candidate][key]
+		b.mu.RUnlock()
+
+		if cached {
+			return tmpl, nil
+		}
+		if !found {
+			continue
+		}
+
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("fcm: parsing %q for locale %s: %w", key, candidate, err)
+		}
+		b.mu.Lock()
+		b.templates[cacheKey] = tmpl
+		b.mu.Unlock()
+		return tmpl, nil
+	}
+	return nil, fmt.Errorf("fcm: no translation for %q in locale %q", key, locale)
+}
+
+// fallbacks returns the locales searched for locale, from most to least specific.
+func (b *Bundle) fallbacks(locale string) []string {
+	var chain []string
+	for locale = normalizeLocale(locale); locale != ""; {
+		chain = append(chain, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	if b.defaultLocale != "" {
+		chain = append(chain, b.defaultLocale)
+	}
+	return chain
+}
+
+// normalizeLocale converts a locale such as "pt_br" into the canonical "pt-BR" form used as catalog key.
+func normalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	for i, part := range parts {
+		if i == 0 {
+			parts[i] = strings.ToLower(part)
+		} else if len(part) == 2 {
+			parts[i] = strings.ToUpper(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// NotificationTemplate describes a localized notification by the catalog keys of its title and body.
+type NotificationTemplate struct {
+	// TitleKey is the catalog key of the title, also sent as title_loc_key for on-device localization.
+	TitleKey string
+	// BodyKey is the catalog key of the body, also sent as body_loc_key for on-device localization.
+	BodyKey string
+	// TitleArgs are text/template templates rendered into title_loc_args for on-device localization.
+	TitleArgs []string
+	// BodyArgs are text/template templates rendered into body_loc_args for on-device localization.
+	BodyArgs []string
+}
+
+// Render renders the title and body of the notification for the locale.
+func (t NotificationTemplate) Render(bundle *Bundle, locale string, data interface{}) (*Notification, error) {
+	notification := &Notification{}
+	var err error
+	if t.TitleKey != "" {
+		if notification.Title, err = bundle.Translate(locale, t.TitleKey, data); err != nil {
+			return nil, err
+		}
+	}
+	if t.BodyKey != "" {
+		if notification.Body, err = bundle.Translate(locale, t.BodyKey, data); err != nil {
+			return nil, err
+		}
+	}
+	return notification, nil
+}
+
+// RenderAPNAlert renders the title and body of the notification for the locale as an APNs alert.
+func (t NotificationTemplate) RenderAPNAlert(bundle *Bundle, locale string, data interface{}) (*APNAlert, error) {
+	notification, err := t.Render(bundle, locale, data)
+	if err != nil {
+		return nil, err
+	}
+	return &APNAlert{Title: notification.Title, Body: notification.Body}, nil
+}
+
+// Localize sets the notification of msg to the title and body rendered for the locale.
+func (t NotificationTemplate) Localize(msg *Message, bundle *Bundle, locale string, data interface{}) error {
+	notification, err := t.Render(bundle, locale, data)
+	if err != nil {
+		return err
+	}
+	if msg.Notification == nil {
+		msg.Notification = &Notification{}
+	}
+	msg.Notification.Title = notification.Title
+	msg.Notification.Body = notification.Body
+	return nil
+}
+
+// LocalizeOnDevice sets the localization keys and arguments of the Android notification and
+// APNs alert of msg, so that the app renders the strings bundled with it in the device locale.
+func (t NotificationTemplate) LocalizeOnDevice(msg *Message, data interface{}) error {
+	titleArgs, err := renderArgs(t.TitleArgs, data)
+	if err != nil {
+		return err
+	}
+	bodyArgs, err := renderArgs(t.BodyArgs, data)
+	if err != nil {
+		return err
+	}
+
+	if msg.Android == nil {
+		msg.Android = &AndroidConfig{}
+	}
+	if msg.Android.Notification == nil {
+		msg.Android.Notification = &Notification{}
+	}
+	msg.Android.Notification.TitleLocKey = t.TitleKey
+	msg.Android.Notification.TitleLocArgs = titleArgs
+	msg.Android.Notification.BodyLocKey = t.BodyKey
+	msg.Android.Notification.BodyLocArgs = bodyArgs
+
+	if msg.APNS == nil {
+		msg.APNS = &APNSConfig{}
+	}
+	if msg.APNS.Payload == nil {
+		msg.APNS.Payload = &APNSPayload{}
+	}
+	if msg.APNS.Payload.Aps == nil {
+		msg.APNS.Payload.Aps = &Aps{}
+	}
+	aps := msg.APNS.Payload.Aps
+	if aps.Alert == nil {
+		aps.Alert = &APNAlert{}
+	}
+	aps.Alert.TitleLocKey = t.TitleKey
+	aps.Alert.TitleLocArgs = titleArgs
+	aps.Alert.LocKey = t.BodyKey
+	aps.Alert.LocArgs = bodyArgs
+	return nil
+}
+
+func renderArgs(args []string, data interface{}) ([]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	rendered := make([]string, len(args))
+	for i, arg := range args {
+		tmpl, err := template.New("arg").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("fcm: parsing localization argument %d: %w", i, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("fcm: rendering localization argument %d: %w", i, err)
+		}
+		rendered[i] = buf.String()
+	}
+	return rendered, nil
+}
@@ -0,0 +1,180 @@
+package fcm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testBundle(t *testing.T) *Bundle {
+	t.Helper()
+	fsys := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{
+			"order_shipped.title": "Order shipped",
+			"order_shipped.body": "Hi {{.Name}}, order {{.OrderID}} is on its way"
+		}`)},
+		"locales/pt.json": {Data: []byte(`{
+			"order_shipped.title": "Pedido enviado",
+			"order_shipped.body": "Olá {{.Name}}, o pedido {{.OrderID}} está a caminho"
+		}`)},
+		"locales/pt-BR.json": {Data: []byte(`{"order_shipped.title": "Pedido despachado"}`)},
+		"locales/README.md":  {Data: []byte(`not a catalog`)},
+	}
+
+	bundle := NewBundle("en")
+	if err := bundle.LoadFS(fsys, "locales"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return bundle
+}
+
+func TestBundle_Translate(t *testing.T) {
+	bundle := testBundle(t)
+	data := map[string]string{"Name": "Ana", "OrderID": "42"}
+
+	testCases := []struct {
+		name       string
+		locale     string
+		key        string
+		expected   string
+		expectsErr bool
+	}{
+		{name: "exact locale", locale: "en", key: "order_shipped.body", expected: "Hi Ana, order 42 is on its way"},
+		{name: "regional locale", locale: "pt-BR", key: "order_shipped.title", expected: "Pedido despachado"},
+		{name: "parent locale fallback", locale: "pt_br", key: "order_shipped.body", expected: "Olá Ana, o pedido 42 está a caminho"},
+		{name: "default locale fallback", locale: "de-DE", key: "order_shipped.title", expected: "Order shipped"},
+		{name: "unknown key", locale: "en", key: "missing", expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := bundle.Translate(tc.locale, tc.key, data)
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestBundle_TranslateMissingPlaceholder(t *testing.T) {
+	bundle := testBundle(t)
+	if _, err := bundle.Translate("en", "order_shipped.body", map[string]string{"Name": "Ana"}); err == nil {
+		t.Error("expected error for missing placeholder, got nil")
+	}
+}
+
+func TestBundle_RegisterFormat(t *testing.T) {
+	fsys := fstest.MapFS{
+		"fr.txt": {Data: []byte("greeting=Bonjour {{.}}")},
+	}
+	bundle := NewBundle("en").RegisterFormat(".txt", func(data []byte, v interface{}) error {
+		key, value, _ := strings.Cut(string(data), "=")
+		*(v.(*map[string]string)) = map[string]string{key: value}
+		return nil
+	})
+	if err := bundle.LoadFS(fsys, "."); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	result, err := bundle.Translate("fr-FR", "greeting", "Ana")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "Bonjour Ana" {
+		t.Errorf("expected %q, got %q", "Bonjour Ana", result)
+	}
+}
+
+// unmarshalTestYAML decodes the flat "key: value" documents used by the tests.
+func unmarshalTestYAML(data []byte, v interface{}) error {
+	messages := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		messages[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	*(v.(*map[string]string)) = messages
+	return nil
+}
+
+func TestBundle_LoadFSYAML(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"greeting": "Hello {{.}}"}`)},
+		"locales/fr.yaml": {Data: []byte("greeting: \"Bonjour {{.}}\"\n")},
+	}
+
+	if err := NewBundle("en").LoadFS(fsys, "locales"); err == nil {
+		t.Error("expected error for a YAML catalog without a registered format, got nil")
+	}
+
+	bundle := NewBundle("en").RegisterFormat(".yaml", unmarshalTestYAML)
+	if err := bundle.LoadFS(fsys, "locales"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result, err := bundle.Translate("fr", "greeting", "Ana")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "Bonjour Ana" {
+		t.Errorf("expected %q, got %q", "Bonjour Ana", result)
+	}
+}
+
+func TestNotificationTemplate_Localize(t *testing.T) {
+	bundle := testBundle(t)
+	tmpl := NotificationTemplate{TitleKey: "order_shipped.title", BodyKey: "order_shipped.body"}
+
+	msg := Message{Token: "token"}
+	if err := tmpl.Localize(&msg, bundle, "pt", map[string]string{"Name": "Ana", "OrderID": "42"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := &Notification{Title: "Pedido enviado", Body: "Olá Ana, o pedido 42 está a caminho"}
+	if !reflect.DeepEqual(msg.Notification, expected) {
+		t.Errorf("expected %+v, got %+v", expected, msg.Notification)
+	}
+
+	alert, err := tmpl.RenderAPNAlert(bundle, "en", map[string]string{"Name": "Ana", "OrderID": "42"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if alert.Title != "Order shipped" {
+		t.Errorf("expected title %q, got %q", "Order shipped", alert.Title)
+	}
+}
+
+func TestNotificationTemplate_LocalizeOnDevice(t *testing.T) {
+	tmpl := NotificationTemplate{
+		TitleKey: "order_shipped.title",
+		BodyKey:  "order_shipped.body",
+		BodyArgs: []string{"{{.Name}}", "{{.OrderID}}"},
+	}
+
+	msg := Message{Token: "token"}
+	if err := tmpl.LocalizeOnDevice(&msg, map[string]string{"Name": "Ana", "OrderID": "42"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"token":"token","android":{"notification":{"body_loc_key":"order_shipped.body",` +
+		`"body_loc_args":["Ana","42"],"title_loc_key":"order_shipped.title"}},"apns":{"payload":{"aps":` +
+		`{"alert":{"title-loc-key":"order_shipped.title","loc-key":"order_shipped.body","loc-args":["Ana","42"]}}}}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
@@ -0,0 +1,79 @@
+package fcm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/patrickkabwe/go-fcm/internal/logging"
+)
+
+// redacted replaces secret values in log records.
+const redacted = "[REDACTED]"
+
+// SetLogger sets the logger used by the FCM client. By default the client does not log.
+//
+// Events are logged at the following levels, so the verbosity is configured through the
+// level of the logger's handler:
+//   - Debug: access token refreshes and send attempts
+//   - Info: messages sent, with their message ID and latency, and duplicate sends suppressed
+//   - Warn: retried requests, failed token refreshes, circuit breaker state changes and invalid
+//     tokens that could not be unregistered
+//   - Error: failed sends, with their FCM error code
+//
+// Registration tokens are logged as hashes and credentials never include the private key.
+func (f *FCMClient) SetLogger(logger *slog.Logger) *FCMClient {
+	f.logger = logger
+	return f
+}
+
+// log returns the logger of the client, or a logger discarding every record if none is set.
+func (f *FCMClient) log() *slog.Logger {
+	if f.logger == nil {
+		return logging.Discard()
+	}
+	return f.logger
+}
+
+// RedactToken returns a short hash of a registration token, so that log records can
+// correlate the messages sent to a device without exposing its token.
+func RedactToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// LogValue implements slog.LogValuer. It logs the target of the message,
+// with registration tokens redacted, but not its content.
+func (m Message) LogValue() slog.Value {
+	var attrs []slog.Attr
+	if m.Token != "" {
+		attrs = append(attrs, slog.String("token", RedactToken(m.Token)))
+	}
+	if len(m.Tokens) > 0 {
+		attrs = append(attrs, slog.Int("tokens", len(m.Tokens)))
+	}
+	if m.Topic != "" {
+		attrs = append(attrs, slog.String("topic", m.Topic))
+	}
+	if m.Condition != "" {
+		attrs = append(attrs, slog.String("condition", m.Condition))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer. It logs the identity of the service account
+// with its private key redacted.
+func (c Credentials) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("project_id", c.ProjectID),
+		slog.String("client_email", c.ClientEmail),
+		slog.String("private_key_id", c.PrivateKeyID),
+	}
+	if c.PrivateKey != "" {
+		attrs = append(attrs, slog.String("private_key", redacted))
+	}
+	return slog.GroupValue(attrs...)
+}
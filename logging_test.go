@@ -0,0 +1,139 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	testCases := []struct {
+		name           string
+		status         int
+		body           string
+		level          slog.Level
+		expectedEvents []string
+	}{
+		{
+			name:           "success at debug level",
+			status:         200,
+			body:           `{"name":"projects/project_id/messages/1"}`,
+			level:          slog.LevelDebug,
+			expectedEvents: []string{"fcm: access token refreshed", "fcm: send attempt", "fcm: message sent"},
+		},
+		{
+			name:           "success at info level",
+			status:         200,
+			body:           `{"name":"projects/project_id/messages/1"}`,
+			level:          slog.LevelInfo,
+			expectedEvents: []string{"fcm: message sent"},
+		},
+		{
+			name:           "failure",
+			status:         404,
+			body:           `{"error":{"status":"NOT_FOUND","message":"not found"}}`,
+			level:          slog.LevelInfo,
+			expectedEvents: []string{"fcm: send failed"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			client := NewClient().
+				SetCredentialFile(testServiceAccountFile).
+				SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: tc.level}))).
+				SetHTTPClient(&testHttpClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						if !strings.HasSuffix(req.URL.Path, "messages:send") {
+							return &http.Response{
+								StatusCode: 200,
+								Body:       io.NopCloser(strings.NewReader(`{"access_token":"secret-access-token"}`)),
+							}, nil
+						}
+						return &http.Response{StatusCode: tc.status, Body: io.NopCloser(strings.NewReader(tc.body))}, nil
+					},
+				})
+
+			_ = client.Send(&MessagePayload{Message: Message{Token: "device-registration-token"}})
+
+			var events []string
+			var records []map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var record map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("expected JSON log record, got %q", line)
+				}
+				events = append(events, record["msg"].(string))
+				records = append(records, record)
+			}
+			if strings.Join(events, ",") != strings.Join(tc.expectedEvents, ",") {
+				t.Errorf("expected events %v, got %v", tc.expectedEvents, events)
+			}
+
+			for _, secret := range []string{"device-registration-token", "secret-access-token", "PRIVATE KEY"} {
+				if strings.Contains(buf.String(), secret) {
+					t.Errorf("expected %q to be redacted, got %s", secret, buf.String())
+				}
+			}
+
+			last := records[len(records)-1]
+			message, _ := last["message"].(map[string]interface{})
+			if message["token"] != RedactToken("device-registration-token") {
+				t.Errorf("expected hashed token, got %v", message["token"])
+			}
+			if tc.status == 200 && last["message_id"] != "1" {
+				t.Errorf("expected message_id 1, got %v", last["message_id"])
+			}
+			if tc.status != 200 && last["error_code"] != string(ErrorCodeUnregistered) {
+				t.Errorf("expected error_code %s, got %v", ErrorCodeUnregistered, last["error_code"])
+			}
+		})
+	}
+}
+
+func TestCredentials_LogValue(t *testing.T) {
+	file, err := os.ReadFile(testServiceAccountFile)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var credentials Credentials
+	if err := json.Unmarshal(file, &credentials); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("loaded", "credentials", &credentials)
+
+	if strings.Contains(buf.String(), credentials.PrivateKey[:40]) {
+		t.Errorf("expected private key to be redacted, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "credentials.private_key="+redacted) {
+		t.Errorf("expected redacted private key attribute, got %s", buf.String())
+	}
+}
+
+func TestRedactToken(t *testing.T) {
+	if RedactToken("") != "" {
+		t.Error("expected empty token to stay empty")
+	}
+	hash := RedactToken("token")
+	if hash != RedactToken("token") || hash == RedactToken("other") {
+		t.Errorf("expected stable distinct hashes, got %s", hash)
+	}
+	if !strings.HasPrefix(hash, "sha256:") || len(hash) != len("sha256:")+16 {
+		t.Errorf("expected short sha256 hash, got %s", hash)
+	}
+}
+
+func TestSendResponse_MessageID(t *testing.T) {
+	res := &SendResponse{Name: "projects/project_id/messages/0:1500415314455276%31bd1c9631bd1c96"}
+	if res.MessageID() != "0:1500415314455276%31bd1c9631bd1c96" {
+		t.Errorf("expected message ID, got %q", res.MessageID())
+	}
+}
@@ -0,0 +1,76 @@
+package fcm
+
+import "time"
+
+// Outcomes of the requests reported to Metrics.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Target types of the sends reported to Metrics.
+const (
+	TargetToken     = "token"
+	TargetTokens    = "tokens"
+	TargetTopic     = "topic"
+	TargetCondition = "condition"
+	TargetRaw       = "raw"
+)
+
+// Metrics receives measurements of the requests made by the FCM client.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// IncSends counts a completed send by target type, outcome and FCM error code.
+	// The error code is empty for successful sends.
+	IncSends(target, outcome string, code ErrorCode)
+	// ObserveSendLatency records the duration of a single HTTP request to the FCM API.
+	ObserveSendLatency(duration time.Duration)
+	// ObserveTokenLatency records the duration of an access token request by outcome.
+	ObserveTokenLatency(outcome string, duration time.Duration)
+	// AddInFlight adds delta to the number of sends in progress.
+	AddInFlight(delta int)
+}
+
+// SetMetrics sets the metrics recorder of the FCM client. By default no metrics are recorded.
+func (f *FCMClient) SetMetrics(metrics Metrics) *FCMClient {
+	f.metrics = metrics
+	return f
+}
+
+// metric returns the metrics recorder of the client, or one discarding every measurement if none is set.
+func (f *FCMClient) metric() Metrics {
+	if f.metrics == nil {
+		return nopMetrics{}
+	}
+	return f.metrics
+}
+
+// targetType returns the target type of the message reported to Metrics.
+func (m Message) targetType() string {
+	switch {
+	case m.Token != "":
+		return TargetToken
+	case len(m.Tokens) > 0:
+		return TargetTokens
+	case m.Topic != "":
+		return TargetTopic
+	case m.Condition != "":
+		return TargetCondition
+	}
+	return ""
+}
+
+// outcome returns the outcome of a request reported to Metrics.
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncSends(string, string, ErrorCode)        {}
+func (nopMetrics) ObserveSendLatency(time.Duration)          {}
+func (nopMetrics) ObserveTokenLatency(string, time.Duration) {}
+func (nopMetrics) AddInFlight(int)                           {}
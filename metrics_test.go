@@ -0,0 +1,111 @@
+package fcm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	mu            sync.Mutex
+	sends         []string
+	sendLatencies int
+	tokenOutcomes []string
+	inFlight      int
+	maxInFlight   int
+}
+
+func (m *testMetrics) IncSends(target, outcome string, code ErrorCode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sends = append(m.sends, target+"/"+outcome+"/"+string(code))
+}
+
+func (m *testMetrics) ObserveSendLatency(time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sendLatencies++
+}
+
+func (m *testMetrics) ObserveTokenLatency(outcome string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokenOutcomes = append(m.tokenOutcomes, outcome)
+}
+
+func (m *testMetrics) AddInFlight(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight += delta
+	if m.inFlight > m.maxInFlight {
+		m.maxInFlight = m.inFlight
+	}
+}
+
+func TestSetMetrics(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        int
+		send          func(client *FCMClient) error
+		expectedSends string
+	}{
+		{
+			name:          "token success",
+			status:        200,
+			send:          func(c *FCMClient) error { return c.Send(&MessagePayload{Message: Message{Token: "token"}}) },
+			expectedSends: "token/success/",
+		},
+		{
+			name:          "topic failure",
+			status:        404,
+			send:          func(c *FCMClient) error { return c.SendToTopic(&MessagePayload{Message: Message{Topic: "news"}}) },
+			expectedSends: "topic/failure/UNREGISTERED",
+		},
+		{
+			name:   "raw success",
+			status: 200,
+			send: func(c *FCMClient) error {
+				_, err := c.SendRaw(context.Background(), []byte(`{"message":{"token":"token"}}`))
+				return err
+			},
+			expectedSends: "raw/success/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := &testMetrics{}
+			client := NewClient().
+				SetCredentialFile(testServiceAccountFile).
+				SetMetrics(metrics).
+				SetHTTPClient(&testHttpClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						status := 200
+						if strings.HasSuffix(req.URL.Path, "messages:send") {
+							status = tc.status
+						}
+						return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(`{"access_token":"a"}`))}, nil
+					},
+				})
+
+			_ = tc.send(client)
+
+			if strings.Join(metrics.sends, ",") != tc.expectedSends {
+				t.Errorf("expected sends %q, got %v", tc.expectedSends, metrics.sends)
+			}
+			if metrics.sendLatencies != 1 {
+				t.Errorf("expected 1 send latency, got %d", metrics.sendLatencies)
+			}
+			if len(metrics.tokenOutcomes) != 1 || metrics.tokenOutcomes[0] != OutcomeSuccess {
+				t.Errorf("expected a successful token refresh, got %v", metrics.tokenOutcomes)
+			}
+			if metrics.inFlight != 0 || metrics.maxInFlight != 1 {
+				t.Errorf("expected in-flight to go 0 -> 1 -> 0, got max %d and final %d", metrics.maxInFlight, metrics.inFlight)
+			}
+		})
+	}
+}
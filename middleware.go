@@ -0,0 +1,56 @@
+package fcm
+
+import (
+	"context"
+	"net/http"
+)
+
+// SendFunc sends a message payload to the FCM server and returns its response.
+type SendFunc func(ctx context.Context, msg *MessagePayload) (*SendResponse, error)
+
+// Middleware wraps a SendFunc to add behaviour around every logical send,
+// such as auditing the outgoing message or inspecting the result.
+type Middleware func(next SendFunc) SendFunc
+
+// RoundTripFunc performs a single HTTP request to the FCM or OAuth servers.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// HTTPMiddleware wraps a RoundTripFunc to add behaviour around every HTTP round trip,
+// such as injecting headers or recording the raw response.
+type HTTPMiddleware func(next RoundTripFunc) RoundTripFunc
+
+// Use appends middlewares to the chain wrapping every logical send made by the client.
+// The first middleware registered is the outermost one.
+// It is not safe to call Use concurrently with sending messages.
+func (f *FCMClient) Use(middlewares ...Middleware) *FCMClient {
+	f.middlewares = append(f.middlewares, middlewares...)
+	return f
+}
+
+// UseHTTP appends middlewares to the chain wrapping every HTTP request made by the client,
+// including the requests fetching access tokens and those made by SendRaw.
+// The first middleware registered is the outermost one.
+// It is not safe to call UseHTTP concurrently with sending messages.
+func (f *FCMClient) UseHTTP(middlewares ...HTTPMiddleware) *FCMClient {
+	f.httpMiddlewares = append(f.httpMiddlewares, middlewares...)
+	return f
+}
+
+// dispatch sends msg through the middleware chain.
+func (f *FCMClient) dispatch(ctx context.Context, msg *MessagePayload) (*SendResponse, error) {
+	next := SendFunc(f.makeAPICall)
+	for i := len(f.middlewares) - 1; i >= 0; i-- {
+		next = f.middlewares[i](next)
+	}
+	return next(ctx, msg)
+}
+
+// do performs req through the HTTP middleware chain, propagating the trace of the request.
+func (f *FCMClient) do(req *http.Request) (*http.Response, error) {
+	injectTraceParent(req)
+	next := RoundTripFunc(f.httpClient.Do)
+	for i := len(f.httpMiddlewares) - 1; i >= 0; i-- {
+		next = f.httpMiddlewares[i](next)
+	}
+	return next(req)
+}
@@ -0,0 +1,129 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestMiddlewareClient(status int, body string) *FCMClient {
+	return NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetHTTPClient(&testHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: status,
+					Body:       io.NopCloser(strings.NewReader(body)),
+				}, nil
+			},
+		})
+}
+
+func TestUse(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next SendFunc) SendFunc {
+			return func(ctx context.Context, msg *MessagePayload) (*SendResponse, error) {
+				calls = append(calls, name+" before "+msg.Message.Token)
+				res, err := next(ctx, msg)
+				calls = append(calls, name+" after "+res.Name)
+				return res, err
+			}
+		}
+	}
+
+	client := newTestMiddlewareClient(200, `{"name":"projects/project_id/messages/1"}`).
+		Use(trace("outer"), trace("inner"))
+
+	res, err := client.SendContext(context.Background(), &MessagePayload{Message: Message{Token: "token"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res.Name != "projects/project_id/messages/1" {
+		t.Errorf("expected message name, got %q", res.Name)
+	}
+
+	expected := []string{
+		"outer before token",
+		"inner before token",
+		"inner after projects/project_id/messages/1",
+		"outer after projects/project_id/messages/1",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestUse_ShortCircuit(t *testing.T) {
+	errBlocked := errors.New("blocked")
+	testCases := []struct {
+		name string
+		send func(client *FCMClient) error
+	}{
+		{name: "send", send: func(c *FCMClient) error { return c.Send(&MessagePayload{Message: Message{Token: "token"}}) }},
+		{name: "send to topic", send: func(c *FCMClient) error { return c.SendToTopic(&MessagePayload{Message: Message{Topic: "news"}}) }},
+		{name: "send to condition", send: func(c *FCMClient) error {
+			return c.SendToCondition(&MessagePayload{Message: Message{Condition: "'news' in topics"}})
+		}},
+		{name: "send to multiple", send: func(c *FCMClient) error {
+			return c.SendToMultiple(&MessagePayload{Message: Message{Tokens: []string{"a", "b"}}})
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewClient().
+				SetCredentialFile(testServiceAccountFile).
+				SetHTTPClient(&testHttpClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						t.Fatal("expected no HTTP request")
+						return nil, nil
+					},
+				}).
+				Use(func(next SendFunc) SendFunc {
+					return func(ctx context.Context, msg *MessagePayload) (*SendResponse, error) {
+						return nil, errBlocked
+					}
+				})
+
+			if err := tc.send(client); !errors.Is(err, errBlocked) {
+				t.Errorf("expected %v, got %v", errBlocked, err)
+			}
+		})
+	}
+}
+
+func TestUseHTTP(t *testing.T) {
+	var urls []string
+	client := newTestMiddlewareClient(200, `{"name":"projects/project_id/messages/1"}`).
+		UseHTTP(func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+				urls = append(urls, req.URL.String())
+				return next(req)
+			}
+		}).
+		UseHTTP(func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				if req.Header.Get("traceparent") == "" {
+					t.Error("expected traceparent header to be set by the outer middleware")
+				}
+				return next(req)
+			}
+		})
+
+	if _, err := client.SendRaw(context.Background(), []byte(`{"message":{"token":"token"}}`)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(urls) != 2 {
+		t.Fatalf("expected the token and send requests, got %v", urls)
+	}
+	if !strings.HasSuffix(urls[1], "messages:send") {
+		t.Errorf("expected last request to send the message, got %s", urls[1])
+	}
+}
@@ -0,0 +1,249 @@
+// Package notify sends notifications to users rather than to registration tokens.
+//
+// A UserNotifier looks up the devices of a user in a DeviceStore and sends one message to each of
+// them, adapted to its platform. Devices not seen for a while are skipped, the devices whose token
+// FCM reports as invalid are removed from the store, and the outcome of every device is
+// aggregated into a single Result per user.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+	"github.com/patrickkabwe/go-fcm/internal/logging"
+)
+
+// DefaultStaleAfter is how long a device may go unseen before it is skipped when
+// Options.StaleAfter is not set. FCM recommends treating tokens unused for a month as stale.
+const DefaultStaleAfter = 30 * 24 * time.Hour
+
+// Options configures a UserNotifier.
+type Options struct {
+	// Concurrency is the maximum number of devices of a user sent to in parallel.
+	// Defaults to fcm.DefaultConcurrency.
+	Concurrency int
+	// StaleAfter is how long since a device was last seen it is skipped. A negative duration sends
+	// to every device. Defaults to DefaultStaleAfter.
+	StaleAfter time.Duration
+	// Logger receives the devices that could not be removed from the store. It may be nil.
+	Logger *slog.Logger
+}
+
+// Notification is a message sent to every device of a user.
+type Notification struct {
+	// Message is the message sent to each device. Its target is replaced by the token of the device.
+	Message fcm.Message
+	// Platforms overrides parts of Message for the devices of a platform.
+	Platforms map[Platform]Override
+	// Customize, if set, is called with the message of every device before it is sent, for example
+	// to localize it according to the locale of the device. The maps and configurations of the
+	// message are shared between devices, so they must be replaced rather than modified.
+	Customize func(msg *fcm.Message, device Device)
+}
+
+// Override replaces parts of a message for the devices of a platform.
+type Override struct {
+	// Notification, if set, replaces the notification of the message.
+	Notification *fcm.Notification
+	// Data is merged into the data of the message, replacing the values of the same keys.
+	Data map[string]string
+	// Android, if set, replaces the Android configuration of the message.
+	Android *fcm.AndroidConfig
+	// APNS, if set, replaces the APNs configuration of the message.
+	APNS *fcm.APNSConfig
+	// Webpush, if set, replaces the Webpush configuration of the message.
+	Webpush *fcm.WebpushConfig
+}
+
+// Result is the outcome of a notification sent to a user.
+type Result struct {
+	// UserID is the user the notification was sent to.
+	UserID string `json:"user_id"`
+	// Devices holds the outcome of every device of the user, in the order of the store.
+	Devices []DeviceResult `json:"devices"`
+	// Sent is the number of devices the notification was sent to.
+	Sent int `json:"sent"`
+	// Deduplicated is the number of devices the notification was already sent to with the
+	// deduplication key of the context, and was not sent again.
+	Deduplicated int `json:"deduplicated"`
+	// Failed is the number of devices the notification failed to be sent to.
+	Failed int `json:"failed"`
+	// Skipped is the number of stale devices.
+	Skipped int `json:"skipped"`
+	// Removed is the number of failed devices removed from the store because their token is invalid.
+	Removed int `json:"removed"`
+}
+
+// Delivered reports whether the notification was sent to at least one device of the user, now or
+// by an earlier send with the same deduplication key.
+func (r *Result) Delivered() bool {
+	return r.Sent > 0 || r.Deduplicated > 0
+}
+
+// DeviceResult is the outcome of a notification sent to a device.
+type DeviceResult struct {
+	Device Device `json:"device"`
+	// MessageID is the ID of the message sent to the device.
+	MessageID string `json:"message_id,omitempty"`
+	// Deduplicated is set when the message was not sent because it was already sent to the device
+	// with the deduplication key of the context. MessageID is then the ID of that message.
+	Deduplicated bool `json:"deduplicated,omitempty"`
+	// Skipped is set when the device is stale and nothing was sent to it.
+	Skipped bool `json:"skipped,omitempty"`
+	// Removed is set when the token of the device is invalid and the device was removed from the store.
+	Removed bool `json:"removed,omitempty"`
+	// Err is the error of the send, if it failed. ErrorCode and Error describe it when the result
+	// is encoded.
+	Err       error         `json:"-"`
+	ErrorCode fcm.ErrorCode `json:"error_code,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// UserNotifier sends notifications to all the devices of a user.
+type UserNotifier struct {
+	store  DeviceStore
+	sender fcm.Sender
+	opts   Options
+	now    func() time.Time
+}
+
+// New returns a UserNotifier sending to the devices of store with sender.
+func New(store DeviceStore, sender fcm.Sender, opts Options) *UserNotifier {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = fcm.DefaultConcurrency
+	}
+	if opts.StaleAfter == 0 {
+		opts.StaleAfter = DefaultStaleAfter
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Discard()
+	}
+	return &UserNotifier{store: store, sender: sender, opts: opts, now: time.Now}
+}
+
+// Notify sends the notification to every device of the user that is not stale, and returns the
+// outcome of every device. Failed sends are reported in the result and do not make Notify fail;
+// it only returns an error if the devices of the user cannot be listed.
+// A user without devices gets an empty result.
+//
+// Given a context from fcm.WithDedupKey, such as to avoid notifying a user twice, the key applies to
+// each device separately: notifying the user again with the same key only sends to the devices the
+// notification did not reach, and reports the others as deduplicated.
+func (n *UserNotifier) Notify(ctx context.Context, userID string, notification *Notification) (*Result, error) {
+	devices, err := n.store.Devices(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("notify: listing devices: %w", err)
+	}
+
+	result := &Result{UserID: userID, Devices: make([]DeviceResult, len(devices))}
+	now := n.now()
+	slots := make(chan struct{}, n.opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		result.Devices[i].Device = device
+		if n.stale(device, now) {
+			result.Devices[i].Skipped = true
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(r *DeviceResult) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			n.send(ctx, r, notification)
+		}(&result.Devices[i])
+	}
+	wg.Wait()
+
+	for _, r := range result.Devices {
+		switch {
+		case r.Skipped:
+			result.Skipped++
+		case r.Err != nil:
+			result.Failed++
+		case r.Deduplicated:
+			result.Deduplicated++
+		default:
+			result.Sent++
+		}
+		if r.Removed {
+			result.Removed++
+		}
+	}
+	return result, nil
+}
+
+// stale reports whether the device has not been seen for longer than the StaleAfter option.
+func (n *UserNotifier) stale(device Device, now time.Time) bool {
+	if n.opts.StaleAfter < 0 || device.LastSeen.IsZero() {
+		return false
+	}
+	return now.Sub(device.LastSeen) > n.opts.StaleAfter
+}
+
+// send sends the notification to the device of r and records the outcome in r.
+func (n *UserNotifier) send(ctx context.Context, r *DeviceResult, notification *Notification) {
+	msg := notification.message(r.Device)
+	res, err := n.sender.SendContext(ctx, &fcm.MessagePayload{Message: msg})
+	if err == nil {
+		r.MessageID = res.MessageID()
+		r.Deduplicated = res.Deduplicated
+		return
+	}
+	r.Err = err
+	r.ErrorCode = fcm.ErrorCodeOf(err)
+	r.Error = err.Error()
+	if _, ok := fcm.InvalidTokenReason(err); !ok {
+		return
+	}
+	if err := n.store.RemoveDevice(ctx, r.Device.Token); err != nil {
+		n.opts.Logger.LogAttrs(ctx, slog.LevelError, "notify: removing invalid device",
+			slog.String("token", fcm.RedactToken(r.Device.Token)), slog.String("error", err.Error()))
+		return
+	}
+	r.Removed = true
+}
+
+// message returns the message of the notification for the device.
+func (n *Notification) message(device Device) fcm.Message {
+	msg := n.Message
+	msg.Token = device.Token
+	msg.Tokens = nil
+	msg.Topic = ""
+	msg.Condition = ""
+
+	if override, ok := n.Platforms[device.Platform]; ok {
+		if override.Notification != nil {
+			msg.Notification = override.Notification
+		}
+		if len(override.Data) > 0 {
+			data := make(map[string]string, len(msg.Data)+len(override.Data))
+			for k, v := range msg.Data {
+				data[k] = v
+			}
+			for k, v := range override.Data {
+				data[k] = v
+			}
+			msg.Data = data
+		}
+		if override.Android != nil {
+			msg.Android = override.Android
+		}
+		if override.APNS != nil {
+			msg.APNS = override.APNS
+		}
+		if override.Webpush != nil {
+			msg.Webpush = override.Webpush
+		}
+	}
+	if n.Customize != nil {
+		n.Customize(&msg, device)
+	}
+	return msg
+}
@@ -0,0 +1,218 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+type testSender struct {
+	mu   sync.Mutex
+	sent map[string]fcm.Message
+}
+
+func (s *testSender) SendContext(ctx context.Context, msg *fcm.MessagePayload) (*fcm.SendResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch msg.Message.Token {
+	case "dead":
+		return nil, &fcm.FCMError{StatusCode: 404, Code: fcm.ErrorCodeUnregistered}
+	case "unavailable":
+		return nil, &fcm.FCMError{StatusCode: 503, Code: fcm.ErrorCodeUnavailable}
+	}
+	if s.sent == nil {
+		s.sent = make(map[string]fcm.Message)
+	}
+	s.sent[msg.Message.Token] = msg.Message
+	return &fcm.SendResponse{Name: "projects/p/messages/" + msg.Message.Token}, nil
+}
+
+func TestUserNotifier_Notify(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryDeviceStore()
+	devices := []Device{
+		{Token: "phone", Platform: PlatformAndroid, Locale: "fr-FR", LastSeen: now.Add(-time.Hour)},
+		{Token: "tablet", Platform: PlatformIOS, LastSeen: now.Add(-24 * time.Hour)},
+		{Token: "old", Platform: PlatformAndroid, LastSeen: now.Add(-60 * 24 * time.Hour)},
+		{Token: "dead", Platform: PlatformWeb},
+		{Token: "unavailable", Platform: PlatformWeb},
+	}
+	for _, device := range devices {
+		store.PutDevice(ctx, "user-1", device)
+	}
+	sender := &testSender{}
+	notifier := New(store, sender, Options{})
+	notifier.now = func() time.Time { return now }
+
+	iosNotification := &fcm.Notification{Title: "Hello from iOS"}
+	result, err := notifier.Notify(ctx, "user-1", &Notification{
+		Message: fcm.Message{
+			Topic:        "ignored",
+			Notification: &fcm.Notification{Title: "Hello"},
+			Data:         map[string]string{"kind": "greeting"},
+		},
+		Platforms: map[Platform]Override{
+			PlatformIOS: {Notification: iosNotification, Data: map[string]string{"badge": "1"}},
+		},
+		Customize: func(msg *fcm.Message, device Device) {
+			if device.Locale == "fr-FR" {
+				msg.Notification = &fcm.Notification{Title: "Bonjour"}
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.Sent != 2 || result.Failed != 2 || result.Skipped != 1 || result.Removed != 1 {
+		t.Errorf("expected 2 sent, 2 failed, 1 skipped and 1 removed, got %+v", result)
+	}
+	if !result.Delivered() {
+		t.Error("expected the notification to be delivered")
+	}
+	outcomes := make(map[string]DeviceResult)
+	for _, r := range result.Devices {
+		outcomes[r.Device.Token] = r
+	}
+	if outcomes["phone"].MessageID != "phone" || !outcomes["old"].Skipped || !outcomes["dead"].Removed {
+		t.Errorf("unexpected device results %+v", result.Devices)
+	}
+	if outcomes["unavailable"].Err == nil || outcomes["unavailable"].Removed {
+		t.Errorf("expected the unavailable device to fail and be kept, got %+v", outcomes["unavailable"])
+	}
+	data, err := json.Marshal(outcomes["unavailable"])
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(string(data), `"error_code":"UNAVAILABLE"`) || !strings.Contains(string(data), `"error":`) {
+		t.Errorf("expected the encoded result to describe the error, got %s", data)
+	}
+
+	phone := sender.sent["phone"]
+	if phone.Topic != "" || phone.Notification.Title != "Bonjour" || !reflect.DeepEqual(phone.Data, map[string]string{"kind": "greeting"}) {
+		t.Errorf("expected the customized message, got %+v", phone)
+	}
+	tablet := sender.sent["tablet"]
+	if tablet.Notification != iosNotification || !reflect.DeepEqual(tablet.Data, map[string]string{"kind": "greeting", "badge": "1"}) {
+		t.Errorf("expected the iOS override, got %+v", tablet)
+	}
+
+	remaining, _ := store.Devices(ctx, "user-1")
+	if len(remaining) != 4 {
+		t.Errorf("expected the invalid device to be removed, got %v", remaining)
+	}
+}
+
+func TestUserNotifier_StaleAfter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryDeviceStore()
+	store.PutDevice(ctx, "user-1", Device{Token: "recent", LastSeen: now.Add(-2 * time.Hour)})
+	store.PutDevice(ctx, "user-1", Device{Token: "old", LastSeen: now.Add(-100 * 24 * time.Hour)})
+
+	testCases := []struct {
+		name       string
+		staleAfter time.Duration
+		expected   int
+	}{
+		{name: "default", expected: 1},
+		{name: "shorter", staleAfter: time.Hour, expected: 0},
+		{name: "disabled", staleAfter: -1, expected: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			notifier := New(store, &testSender{}, Options{StaleAfter: tc.staleAfter})
+			notifier.now = func() time.Time { return now }
+			result, err := notifier.Notify(ctx, "user-1", &Notification{Message: fcm.Message{Data: map[string]string{"k": "v"}}})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result.Sent != tc.expected || result.Skipped != 2-tc.expected {
+				t.Errorf("expected %d sent, got %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+type testHTTPClient struct {
+	mu    sync.Mutex
+	sends int
+}
+
+func (c *testHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "messages:send") {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"access_token":"access"}`))}, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sends++
+	body := fmt.Sprintf(`{"name":"projects/p/messages/%d"}`, c.sends)
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestUserNotifier_DedupKey(t *testing.T) {
+	ctx := fcm.WithDedupKey(context.Background(), "welcome")
+	store := NewMemoryDeviceStore()
+	store.PutDevice(ctx, "user-1", Device{Token: "phone"})
+	store.PutDevice(ctx, "user-1", Device{Token: "tablet"})
+	httpClient := &testHTTPClient{}
+	client := fcm.NewClient().SetCredentialFile("../testdata/service_test.json").SetHTTPClient(httpClient)
+	notifier := New(store, client, Options{})
+	notification := &Notification{Message: fcm.Message{Data: map[string]string{"k": "v"}}}
+
+	result, err := notifier.Notify(ctx, "user-1", notification)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Sent != 2 || result.Deduplicated != 0 || httpClient.sends != 2 {
+		t.Errorf("expected the key to apply to each device, got %+v after %d sends", result, httpClient.sends)
+	}
+	first := result.Devices[0].MessageID
+	if first == result.Devices[1].MessageID {
+		t.Errorf("expected a message per device, got %+v", result.Devices)
+	}
+
+	result, err = notifier.Notify(ctx, "user-1", notification)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Sent != 0 || result.Deduplicated != 2 || !result.Delivered() || httpClient.sends != 2 {
+		t.Errorf("expected both devices to be deduplicated, got %+v after %d sends", result, httpClient.sends)
+	}
+	if !result.Devices[0].Deduplicated || result.Devices[0].MessageID != first {
+		t.Errorf("expected the original message of the device, got %+v", result.Devices[0])
+	}
+}
+
+type failingStore struct{ DeviceStore }
+
+func (failingStore) Devices(ctx context.Context, userID string) ([]Device, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestUserNotifier_StoreError(t *testing.T) {
+	notifier := New(failingStore{}, &testSender{}, Options{})
+	if _, err := notifier.Notify(context.Background(), "user-1", &Notification{}); err == nil {
+		t.Error("expected error, got nil")
+	}
+
+	result, err := New(NewMemoryDeviceStore(), &testSender{}, Options{}).Notify(context.Background(), "nobody", &Notification{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Delivered() || len(result.Devices) != 0 {
+		t.Errorf("expected an empty result, got %+v", result)
+	}
+}
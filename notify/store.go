@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+// Platform is the platform of a device.
+type Platform string
+
+const (
+	PlatformAndroid Platform = "android"
+	PlatformIOS     Platform = "ios"
+	PlatformWeb     Platform = "web"
+)
+
+// Device is a device of a user the app can send messages to.
+type Device struct {
+	// Token is the registration token of the app on the device.
+	Token string `json:"token"`
+	// Platform is the platform of the device.
+	Platform Platform `json:"platform"`
+	// Locale is the locale of the device, such as en-US.
+	Locale string `json:"locale,omitempty"`
+	// AppVersion is the version of the app installed on the device.
+	AppVersion string `json:"app_version,omitempty"`
+	// LastSeen is when the app last ran on the device. A zero time means unknown.
+	LastSeen time.Time `json:"last_seen,omitempty"`
+}
+
+// DeviceStore keeps the devices of each user. Implementations must be safe for concurrent use.
+type DeviceStore interface {
+	// Devices returns the devices of the user, in the order they were added.
+	Devices(ctx context.Context, userID string) ([]Device, error)
+	// PutDevice adds the device to the user, or updates it if a device has the same token.
+	// A token belongs to a single user: putting it for another user moves the device.
+	PutDevice(ctx context.Context, userID string, device Device) error
+	// RemoveDevice removes the device with the given token. Removing an unknown device is not an error.
+	RemoveDevice(ctx context.Context, token string) error
+}
+
+// MemoryDeviceStore is a DeviceStore keeping the devices in memory. It does not survive restarts.
+// It is also an fcm.TokenRegistry, so that it can be given to fcm.FCMClient.SetTokenRegistry: a
+// token registered there is a device with only its token known, and an unregistered token removes
+// its device.
+type MemoryDeviceStore struct {
+	mu sync.Mutex
+	// tokens keeps the tokens of each user, in the order they were added.
+	tokens  *fcm.MemoryTokenRegistry
+	devices map[string]Device
+}
+
+// NewMemoryDeviceStore returns an empty MemoryDeviceStore.
+func NewMemoryDeviceStore() *MemoryDeviceStore {
+	return &MemoryDeviceStore{
+		tokens:  fcm.NewMemoryTokenRegistry(),
+		devices: make(map[string]Device),
+	}
+}
+
+// Devices implements DeviceStore.
+func (s *MemoryDeviceStore) Devices(ctx context.Context, userID string) ([]Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.tokens.Tokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var devices []Device
+	for _, token := range tokens {
+		devices = append(devices, s.devices[token])
+	}
+	return devices, nil
+}
+
+// PutDevice implements DeviceStore.
+func (s *MemoryDeviceStore) PutDevice(ctx context.Context, userID string, device Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.tokens.Register(ctx, userID, device.Token); err != nil {
+		return err
+	}
+	s.devices[device.Token] = device
+	return nil
+}
+
+// RemoveDevice implements DeviceStore.
+func (s *MemoryDeviceStore) RemoveDevice(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.tokens.Unregister(ctx, token); err != nil {
+		return err
+	}
+	delete(s.devices, token)
+	return nil
+}
+
+// Register implements fcm.TokenRegistry. The details of a device already having the token are kept.
+func (s *MemoryDeviceStore) Register(ctx context.Context, owner, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.tokens.Register(ctx, owner, token); err != nil {
+		return err
+	}
+	if _, ok := s.devices[token]; !ok {
+		s.devices[token] = Device{Token: token}
+	}
+	return nil
+}
+
+// Unregister implements fcm.TokenRegistry.
+func (s *MemoryDeviceStore) Unregister(ctx context.Context, token string) error {
+	return s.RemoveDevice(ctx, token)
+}
+
+// Tokens implements fcm.TokenRegistry.
+func (s *MemoryDeviceStore) Tokens(ctx context.Context, owner string) ([]string, error) {
+	return s.tokens.Tokens(ctx, owner)
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+var _ fcm.TokenRegistry = (*MemoryDeviceStore)(nil)
+
+func TestMemoryDeviceStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryDeviceStore()
+	store.PutDevice(ctx, "user-1", Device{Token: "a", Platform: PlatformAndroid})
+	store.PutDevice(ctx, "user-1", Device{Token: "b", Platform: PlatformIOS})
+	store.PutDevice(ctx, "user-1", Device{Token: "a", Platform: PlatformAndroid, AppVersion: "2.0"})
+	store.PutDevice(ctx, "user-2", Device{Token: "b", Platform: PlatformIOS})
+
+	expected := []Device{{Token: "a", Platform: PlatformAndroid, AppVersion: "2.0"}}
+	if devices, _ := store.Devices(ctx, "user-1"); !reflect.DeepEqual(devices, expected) {
+		t.Errorf("expected %v, got %v", expected, devices)
+	}
+	if devices, _ := store.Devices(ctx, "user-2"); len(devices) != 1 || devices[0].Token != "b" {
+		t.Errorf("expected the device to move to user-2, got %v", devices)
+	}
+
+	store.RemoveDevice(ctx, "a")
+	store.RemoveDevice(ctx, "unknown")
+	if devices, _ := store.Devices(ctx, "user-1"); len(devices) != 0 {
+		t.Errorf("expected no devices, got %v", devices)
+	}
+}
+
+func TestMemoryDeviceStore_TokenRegistry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryDeviceStore()
+	store.PutDevice(ctx, "user-1", Device{Token: "a", Platform: PlatformAndroid})
+	store.Register(ctx, "user-1", "b")
+	store.Register(ctx, "user-2", "a")
+
+	if devices, _ := store.Devices(ctx, "user-1"); !reflect.DeepEqual(devices, []Device{{Token: "b"}}) {
+		t.Errorf("expected the registered token to be a device, got %v", devices)
+	}
+	expected := []Device{{Token: "a", Platform: PlatformAndroid}}
+	if devices, _ := store.Devices(ctx, "user-2"); !reflect.DeepEqual(devices, expected) {
+		t.Errorf("expected the device to move to user-2 with its details, got %v", devices)
+	}
+
+	store.Unregister(ctx, "a")
+	if tokens, _ := store.Tokens(ctx, "user-2"); len(tokens) != 0 {
+		t.Errorf("expected no tokens, got %v", tokens)
+	}
+	if devices, _ := store.Devices(ctx, "user-2"); len(devices) != 0 {
+		t.Errorf("expected the device to be removed, got %v", devices)
+	}
+}
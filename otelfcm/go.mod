@@ -0,0 +1,25 @@
+module github.com/patrickkabwe/go-fcm/otelfcm
+
+go 1.23.0
+
+require (
+	github.com/patrickkabwe/go-fcm v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.35.0
+	go.opentelemetry.io/otel/sdk v1.35.0
+	go.opentelemetry.io/otel/trace v1.35.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/metric v1.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
+
+// otelfcm is developed against the go-fcm module in the parent directory, as it needs the
+// tracing hooks of FCMClient. Replace this with a requirement on the first tagged go-fcm
+// release that includes FCMClient.SetTracer once it is published.
+replace github.com/patrickkabwe/go-fcm => ../
@@ -0,0 +1,98 @@
+// Package otelfcm provides an fcm.Tracer backed by OpenTelemetry.
+//
+//	client := fcm.NewClient().
+//		SetCredentialFile("service-account.json").
+//		SetTracer(otelfcm.NewTracer(otel.GetTracerProvider()))
+package otelfcm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by this package.
+const instrumentationName = "github.com/patrickkabwe/go-fcm/otelfcm"
+
+// Tracer is an fcm.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates a Tracer using the given tracer provider, or the global
+// tracer provider if provider is nil.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+// Start implements fcm.Tracer.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, fcm.Span) {
+	kind := trace.SpanKindClient
+	if name == fcm.SpanSend {
+		kind = trace.SpanKindInternal
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(convert(attrs)...))
+	return ctx, &Span{span: span}
+}
+
+// Span is an fcm.Span wrapping an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+// SetAttributes implements fcm.Span.
+func (s *Span) SetAttributes(attrs ...slog.Attr) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+// RecordError implements fcm.Span.
+func (s *Span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceParent implements fcm.Span.
+func (s *Span) TraceParent() string {
+	sc := s.span.SpanContext()
+	if !sc.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
+// End implements fcm.Span.
+func (s *Span) End() {
+	s.span.End()
+}
+
+// convert converts slog attributes into OpenTelemetry attributes.
+func convert(attrs []slog.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		value := attr.Value.Resolve()
+		switch value.Kind() {
+		case slog.KindString:
+			kvs = append(kvs, attribute.String(attr.Key, value.String()))
+		case slog.KindInt64:
+			kvs = append(kvs, attribute.Int64(attr.Key, value.Int64()))
+		case slog.KindUint64:
+			kvs = append(kvs, attribute.Int64(attr.Key, int64(value.Uint64())))
+		case slog.KindFloat64:
+			kvs = append(kvs, attribute.Float64(attr.Key, value.Float64()))
+		case slog.KindBool:
+			kvs = append(kvs, attribute.Bool(attr.Key, value.Bool()))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, value.String()))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,88 @@
+package otelfcm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var _ fcm.Tracer = (*Tracer)(nil)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(provider)
+
+	ctx, send := tracer.Start(context.Background(), fcm.SpanSend,
+		slog.String(fcm.AttributeTargetType, fcm.TargetToken),
+		slog.String(fcm.AttributeProjectID, "project_id"),
+	)
+	_, attempt := tracer.Start(ctx, fcm.SpanHTTPAttempt, slog.Int(fcm.AttributeAttempt, 1))
+	attempt.SetAttributes(slog.Int(fcm.AttributeHTTPStatusCode, 404))
+	attempt.RecordError(errors.New("NOT_FOUND: not found"))
+	attempt.End()
+	send.SetAttributes(slog.String(fcm.AttributeErrorCode, string(fcm.ErrorCodeUnregistered)))
+	send.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	attemptSpan, sendSpan := spans[0], spans[1]
+	if attemptSpan.Parent().SpanID() != sendSpan.SpanContext().SpanID() {
+		t.Error("expected the attempt span to be a child of the send span")
+	}
+	if attemptSpan.SpanKind() != trace.SpanKindClient || sendSpan.SpanKind() != trace.SpanKindInternal {
+		t.Errorf("expected client and internal span kinds, got %v and %v", attemptSpan.SpanKind(), sendSpan.SpanKind())
+	}
+	if attemptSpan.Status().Code != codes.Error {
+		t.Errorf("expected error status, got %v", attemptSpan.Status())
+	}
+
+	expected := map[attribute.Key]attribute.Value{
+		fcm.AttributeTargetType: attribute.StringValue(fcm.TargetToken),
+		fcm.AttributeProjectID:  attribute.StringValue("project_id"),
+		fcm.AttributeErrorCode:  attribute.StringValue("UNREGISTERED"),
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range sendSpan.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	for key, value := range expected {
+		if attrs[key] != value {
+			t.Errorf("expected attribute %s=%v, got %v", key, value.Emit(), attrs[key].Emit())
+		}
+	}
+	for _, kv := range attemptSpan.Attributes() {
+		if kv.Key == fcm.AttributeHTTPStatusCode && kv.Value.AsInt64() != 404 {
+			t.Errorf("expected status code 404, got %v", kv.Value.Emit())
+		}
+	}
+}
+
+func TestSpan_TraceParent(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	_, span := NewTracer(provider).Start(context.Background(), fcm.SpanHTTPAttempt)
+	defer span.End()
+
+	sc := span.(*Span).span.SpanContext()
+	expected := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"
+	if span.TraceParent() != expected {
+		t.Errorf("expected %s, got %s", expected, span.TraceParent())
+	}
+
+	_, nop := NewTracer(noop.NewTracerProvider()).Start(context.Background(), fcm.SpanSend)
+	if nop.TraceParent() != "" {
+		t.Errorf("expected empty traceparent for an invalid span, got %s", nop.TraceParent())
+	}
+}
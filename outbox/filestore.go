@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/patrickkabwe/go-fcm/internal/jsonlog"
+)
+
+// FileStore is a Store backed by an append-only log file. Every change is appended to the log as a
+// JSON line and synced to disk before it returns. The log is replayed when the store is opened, and
+// rewritten without the superseded records once they outnumber the live entries.
+type FileStore struct {
+	log *jsonlog.Log
+}
+
+// OpenFileStore opens the FileStore logged to path, creating the file if it does not exist.
+// A truncated last record, left by a crash during a write, is discarded.
+func OpenFileStore(path string) (*FileStore, error) {
+	log, err := jsonlog.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	return &FileStore{log: log}, nil
+}
+
+// Put implements Store.
+func (s *FileStore) Put(ctx context.Context, entry *Entry) error {
+	return s.log.Put(entry.ID, entry)
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.log.Delete(id)
+}
+
+// List implements Store.
+func (s *FileStore) List(ctx context.Context) ([]*Entry, error) {
+	values := s.log.Values()
+	entries := make([]*Entry, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal(value, &entries[i]); err != nil {
+			return nil, fmt.Errorf("outbox: decoding entry: %w", err)
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Close closes the log file.
+func (s *FileStore) Close() error {
+	return s.log.Close()
+}
@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+		"file": func(t *testing.T) Store {
+			store, err := OpenFileStore(filepath.Join(t.TempDir(), "outbox.log"))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now()
+			for i, id := range []string{"c", "a", "b"} {
+				if err := store.Put(ctx, &Entry{ID: id, Payload: testPayload(id), EnqueuedAt: now.Add(time.Duration(i))}); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			}
+			if err := store.Put(ctx, &Entry{ID: "a", Payload: testPayload("a"), EnqueuedAt: now.Add(1), Attempts: 2}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := store.Delete(ctx, "b"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := store.Delete(ctx, "missing"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			entries, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(entries) != 2 || entries[0].ID != "c" || entries[1].ID != "a" {
+				t.Fatalf("expected entries c and a, got %v", entries)
+			}
+			if entries[1].Attempts != 2 || entries[1].Payload.Message.Token != "a" {
+				t.Errorf("expected the replaced entry, got %+v", entries[1])
+			}
+		})
+	}
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		if err := store.Put(ctx, &Entry{ID: id, Payload: testPayload(id)}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	store.Close()
+
+	// A crash during a write leaves a truncated record at the end of the log.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"key":"c","value":{"id":"c","pay`)
+	file.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer store.Close()
+	entries, _ := store.List(ctx)
+	if len(entries) != 1 || entries[0].ID != "b" || entries[0].Payload.Message.Token != "b" {
+		t.Errorf("expected entry b, got %v", entries)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("expected the log to be compacted to 1 record, got %d", lines)
+	}
+
+	if err := os.WriteFile(path, []byte("{\n{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileStore(path); err == nil {
+		t.Error("expected error for a corrupt log, got nil")
+	}
+}
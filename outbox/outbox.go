@@ -0,0 +1,303 @@
+// Package outbox queues messages in a durable store and delivers them at least once.
+//
+// Messages enqueued in an Outbox are persisted to a Store before Enqueue returns, then sent in the
+// background with bounded concurrency. Failed sends are retried with exponential backoff, and messages
+// rejected by FCM, or failing on every attempt, are moved to a dead-letter store. A message is removed
+// from the store only once it has been sent, so the messages left when the process stops are sent when
+// an Outbox is started again on the same store.
+package outbox
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+	"github.com/patrickkabwe/go-fcm/internal/logging"
+	"github.com/patrickkabwe/go-fcm/internal/runner"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts to send a message when Options.MaxAttempts is not set.
+	DefaultMaxAttempts = 5
+	// DefaultBackoff is the delay before the first retry of a message when Options.Backoff is not set.
+	DefaultBackoff = time.Second
+	// DefaultMaxBackoff is the maximum delay between two attempts when Options.MaxBackoff is not set.
+	DefaultMaxBackoff = 5 * time.Minute
+)
+
+// ErrClosed is returned by Enqueue once the outbox is shut down.
+var ErrClosed = errors.New("outbox: closed")
+
+// Options configures an Outbox.
+type Options struct {
+	// Concurrency is the maximum number of messages sent in parallel. Defaults to fcm.DefaultConcurrency.
+	Concurrency int
+	// MaxAttempts is the number of attempts to send a message before it is dead-lettered.
+	// Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Backoff is the delay before the first retry of a message, doubled on every following retry
+	// up to MaxBackoff. A longer delay requested by the Retry-After header of FCM is honoured.
+	// Defaults to DefaultBackoff.
+	Backoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts. Defaults to DefaultMaxBackoff.
+	MaxBackoff time.Duration
+	// DeadLetter receives the messages that could not be sent, with their last error.
+	// If nil, those messages are discarded.
+	DeadLetter Store
+	// Logger receives the failed attempts, dead-lettered messages and store errors. It may be nil.
+	Logger *slog.Logger
+}
+
+// Outbox sends the messages queued in a Store.
+type Outbox struct {
+	store  Store
+	sender fcm.Sender
+	opts   Options
+	now    func() time.Time
+
+	mu     sync.Mutex
+	queue  entryQueue
+	queued map[string]bool
+	runner *runner.Runner
+}
+
+// New returns an Outbox sending the messages of store with sender. Call Start to begin sending.
+func New(store Store, sender fcm.Sender, opts Options) *Outbox {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = fcm.DefaultConcurrency
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Discard()
+	}
+
+	o := &Outbox{
+		store:  store,
+		sender: sender,
+		opts:   opts,
+		now:    time.Now,
+		queued: make(map[string]bool),
+	}
+	o.runner = runner.New(opts.Concurrency, runner.NewTimer, o.next)
+	return o
+}
+
+// Enqueue validates the message and persists it to the store. It returns the ID of its entry.
+// The message is sent in the background once the outbox is started.
+func (o *Outbox) Enqueue(ctx context.Context, payload *fcm.MessagePayload) (string, error) {
+	if payload == nil {
+		return "", fmt.Errorf("outbox: payload is required")
+	}
+	if err := payload.Message.Validate(); err != nil {
+		return "", err
+	}
+	id, err := runner.NewID()
+	if err != nil {
+		return "", err
+	}
+	if o.runner.Closed() {
+		return "", ErrClosed
+	}
+
+	now := o.now()
+	entry := &Entry{ID: id, Payload: payload, EnqueuedAt: now, NextAttempt: now}
+	if err := o.store.Put(ctx, entry); err != nil {
+		return "", fmt.Errorf("outbox: storing message: %w", err)
+	}
+	o.push(entry)
+	return id, nil
+}
+
+// Start loads the entries of the store and starts sending them in the background.
+func (o *Outbox) Start(ctx context.Context) error {
+	err := o.runner.Start(func() error {
+		entries, err := o.store.List(ctx)
+		if err != nil {
+			return fmt.Errorf("outbox: loading messages: %w", err)
+		}
+		for _, entry := range entries {
+			o.push(entry)
+		}
+		return nil
+	})
+	if errors.Is(err, runner.ErrStarted) {
+		return fmt.Errorf("outbox: already started")
+	}
+	return err
+}
+
+// Shutdown stops sending new messages and waits for the messages in flight to be sent.
+// If ctx is done first, the sends in flight are cancelled and ctx.Err() is returned; their
+// messages stay in the store and are sent again by the next Outbox started on it.
+// Messages can no longer be enqueued once Shutdown is called.
+func (o *Outbox) Shutdown(ctx context.Context) error {
+	return o.runner.Shutdown(ctx)
+}
+
+// push queues the entry to be sent, unless it is already queued.
+func (o *Outbox) push(entry *Entry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.queued[entry.ID] {
+		return
+	}
+	o.queued[entry.ID] = true
+	heap.Push(&o.queue, entry)
+	o.runner.Wake()
+}
+
+// next pops the next due entry and returns the task sending it. It implements runner.NextFunc.
+func (o *Outbox) next() (runner.Task, time.Duration, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.queue.Len() == 0 {
+		return nil, 0, false
+	}
+	entry := o.queue[0]
+	if now := o.now(); entry.NextAttempt.After(now) {
+		return nil, entry.NextAttempt.Sub(now), true
+	}
+	heap.Pop(&o.queue)
+	return func(ctx context.Context) { o.send(ctx, entry) }, 0, true
+}
+
+// send sends the entry and records the outcome in the stores. sendCtx is cancelled when the
+// shutdown of the outbox is cut short.
+func (o *Outbox) send(sendCtx context.Context, entry *Entry) {
+	_, err := o.sender.SendContext(sendCtx, entry.Payload)
+	if err != nil && sendCtx.Err() != nil {
+		// Interrupted by the shutdown: the entry stays in the store as is.
+		return
+	}
+
+	ctx := context.Background()
+	logger := o.opts.Logger
+	if err == nil {
+		o.forget(entry)
+		if err := o.store.Delete(ctx, entry.ID); err != nil {
+			logger.LogAttrs(ctx, slog.LevelError, "outbox: deleting sent message",
+				slog.String("id", entry.ID), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	retry := *entry
+	retry.ErrorCode = fcm.ErrorCodeOf(err)
+	retry.Error = err.Error()
+	delay := o.opts.Backoff
+	if !errors.Is(err, fcm.ErrCircuitOpen) && !errors.Is(err, fcm.ErrRateLimited) {
+		// Requests failed by the client before reaching FCM do not count as attempts.
+		retry.Attempts++
+		delay = o.backoff(retry.Attempts, err)
+	}
+
+	if permanent(err) || retry.Attempts >= o.opts.MaxAttempts {
+		o.forget(entry)
+		o.deadLetter(ctx, &retry)
+		return
+	}
+
+	retry.NextAttempt = o.now().Add(delay)
+	logger.LogAttrs(ctx, slog.LevelWarn, "outbox: retrying message",
+		slog.String("id", entry.ID),
+		slog.Int("attempts", retry.Attempts),
+		slog.String("error_code", string(retry.ErrorCode)),
+		slog.String("error", retry.Error),
+		slog.Duration("delay", delay),
+	)
+	if err := o.store.Put(ctx, &retry); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "outbox: storing failed message",
+			slog.String("id", entry.ID), slog.String("error", err.Error()))
+	}
+
+	o.mu.Lock()
+	heap.Push(&o.queue, &retry)
+	o.mu.Unlock()
+}
+
+// deadLetter moves the entry from the store to the dead-letter store.
+func (o *Outbox) deadLetter(ctx context.Context, entry *Entry) {
+	logger := o.opts.Logger
+	logger.LogAttrs(ctx, slog.LevelError, "outbox: dead-lettering message",
+		slog.String("id", entry.ID),
+		slog.Int("attempts", entry.Attempts),
+		slog.String("error_code", string(entry.ErrorCode)),
+		slog.String("error", entry.Error),
+	)
+	if o.opts.DeadLetter != nil {
+		if err := o.opts.DeadLetter.Put(ctx, entry); err != nil {
+			// Keep the message in the store, so it is retried by the next Outbox started on it.
+			logger.LogAttrs(ctx, slog.LevelError, "outbox: storing dead-lettered message",
+				slog.String("id", entry.ID), slog.String("error", err.Error()))
+			return
+		}
+	}
+	if err := o.store.Delete(ctx, entry.ID); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "outbox: deleting dead-lettered message",
+			slog.String("id", entry.ID), slog.String("error", err.Error()))
+	}
+}
+
+// forget removes the entry from the queued entries.
+func (o *Outbox) forget(entry *Entry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.queued, entry.ID)
+}
+
+// backoff returns the delay before the next attempt after the given number of failed attempts.
+func (o *Outbox) backoff(attempts int, err error) time.Duration {
+	delay := o.opts.MaxBackoff
+	if attempts-1 < 32 {
+		if d := o.opts.Backoff << (attempts - 1); d > 0 && d < delay {
+			delay = d
+		}
+	}
+	var fcmErr *fcm.FCMError
+	if errors.As(err, &fcmErr) && fcmErr.RetryAfter > delay {
+		delay = fcmErr.RetryAfter
+	}
+	return delay
+}
+
+// permanent reports whether err was returned by FCM for a message that cannot succeed if sent again.
+func permanent(err error) bool {
+	var fcmErr *fcm.FCMError
+	return errors.As(err, &fcmErr) && !fcmErr.Retryable()
+}
+
+// entryQueue is a heap of entries ordered by NextAttempt, then by EnqueuedAt.
+type entryQueue []*Entry
+
+func (q entryQueue) Len() int { return len(q) }
+
+func (q entryQueue) Less(i, j int) bool {
+	if !q[i].NextAttempt.Equal(q[j].NextAttempt) {
+		return q[i].NextAttempt.Before(q[j].NextAttempt)
+	}
+	return q[i].EnqueuedAt.Before(q[j].EnqueuedAt)
+}
+
+func (q entryQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *entryQueue) Push(x interface{}) { *q = append(*q, x.(*Entry)) }
+
+func (q *entryQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,257 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+type testSender struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	sent     []string
+	send     func(ctx context.Context, token string, attempt int) error
+}
+
+func (s *testSender) SendContext(ctx context.Context, msg *fcm.MessagePayload) (*fcm.SendResponse, error) {
+	token := msg.Message.Token
+	s.mu.Lock()
+	if s.attempts == nil {
+		s.attempts = make(map[string]int)
+	}
+	s.attempts[token]++
+	attempt := s.attempts[token]
+	s.mu.Unlock()
+
+	if s.send != nil {
+		if err := s.send(ctx, token, attempt); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, token)
+	return &fcm.SendResponse{Name: "projects/p/messages/" + token}, nil
+}
+
+func (s *testSender) sentCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+func testPayload(token string) *fcm.MessagePayload {
+	return &fcm.MessagePayload{Message: fcm.Message{Token: token, Data: map[string]string{"k": "v"}}}
+}
+
+// waitFor polls condition until it holds or the test times out.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the outbox")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func storeLen(t *testing.T, store Store) int {
+	t.Helper()
+	entries, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return len(entries)
+}
+
+func TestOutbox(t *testing.T) {
+	unavailable := &fcm.FCMError{StatusCode: 503, Code: fcm.ErrorCodeUnavailable}
+	unregistered := &fcm.FCMError{StatusCode: 404, Code: fcm.ErrorCodeUnregistered}
+	sender := &testSender{send: func(ctx context.Context, token string, attempt int) error {
+		switch token {
+		case "flaky":
+			if attempt < 3 {
+				return unavailable
+			}
+		case "circuit":
+			if attempt < 3 {
+				return fcm.ErrCircuitOpen
+			}
+		case "down":
+			return unavailable
+		case "stale":
+			return unregistered
+		}
+		return nil
+	}}
+	store, deadLetter := NewMemoryStore(), NewMemoryStore()
+	outbox := New(store, sender, Options{MaxAttempts: 3, Backoff: time.Millisecond, DeadLetter: deadLetter})
+	if err := outbox.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx := context.Background()
+	for _, token := range []string{"ok", "flaky", "circuit", "down", "stale"} {
+		if _, err := outbox.Enqueue(ctx, testPayload(token)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if _, err := outbox.Enqueue(ctx, &fcm.MessagePayload{}); err == nil {
+		t.Error("expected error for an invalid message, got nil")
+	}
+	if _, err := outbox.Enqueue(ctx, nil); err == nil {
+		t.Error("expected error for a nil payload, got nil")
+	}
+
+	waitFor(t, func() bool { return storeLen(t, store) == 0 })
+	if err := outbox.Shutdown(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := outbox.Enqueue(ctx, testPayload("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	if sent := sender.sentCount(); sent != 3 {
+		t.Errorf("expected 3 messages sent, got %d", sent)
+	}
+	dead, _ := deadLetter.List(ctx)
+	if len(dead) != 2 {
+		t.Fatalf("expected 2 dead-lettered messages, got %d", len(dead))
+	}
+	for _, entry := range dead {
+		switch entry.Payload.Message.Token {
+		case "down":
+			if entry.Attempts != 3 || entry.ErrorCode != fcm.ErrorCodeUnavailable {
+				t.Errorf("expected 3 UNAVAILABLE attempts, got %+v", entry)
+			}
+		case "stale":
+			if entry.Attempts != 1 || entry.ErrorCode != fcm.ErrorCodeUnregistered || entry.Error == "" {
+				t.Errorf("expected a single UNREGISTERED attempt, got %+v", entry)
+			}
+		default:
+			t.Errorf("unexpected dead-lettered message %+v", entry)
+		}
+	}
+}
+
+func TestOutbox_Restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Messages enqueued by a process that stops before sending them.
+	stopped := New(store, &testSender{}, Options{})
+	for _, token := range []string{"a", "b", "c"} {
+		if _, err := stopped.Enqueue(context.Background(), testPayload(token)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer store.Close()
+	sender := &testSender{}
+	outbox := New(store, sender, Options{})
+	if err := outbox.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, func() bool { return sender.sentCount() == 3 })
+	if err := outbox.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n := storeLen(t, store); n != 0 {
+		t.Errorf("expected the sent messages to be deleted, got %d", n)
+	}
+}
+
+func TestOutbox_Shutdown(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	sender := &testSender{send: func(ctx context.Context, token string, attempt int) error {
+		started <- token
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+	store := NewMemoryStore()
+	outbox := New(store, sender, Options{Concurrency: 1})
+	if err := outbox.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, token := range []string{"a", "b"} {
+		if _, err := outbox.Enqueue(context.Background(), testPayload(token)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	<-started
+
+	// The send in flight is completed, and the queued message is left in the store.
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	if err := outbox.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if sent := sender.sentCount(); sent != 1 {
+		t.Errorf("expected the message in flight to be sent, got %d sent", sent)
+	}
+	if n := storeLen(t, store); n != 1 {
+		t.Errorf("expected 1 message left in the store, got %d", n)
+	}
+
+	// A shutdown whose context expires cancels the sends in flight, and keeps their messages.
+	sender = &testSender{send: func(ctx context.Context, token string, attempt int) error {
+		started <- token
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	outbox = New(store, sender, Options{})
+	if err := outbox.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := outbox.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if n := storeLen(t, store); n != 1 {
+		t.Errorf("expected the interrupted message to stay in the store, got %d", n)
+	}
+}
+
+func TestOutbox_Backoff(t *testing.T) {
+	outbox := New(NewMemoryStore(), &testSender{}, Options{Backoff: time.Second, MaxBackoff: 10 * time.Second})
+	testCases := []struct {
+		attempts int
+		err      error
+		expected time.Duration
+	}{
+		{attempts: 1, err: errors.New("timeout"), expected: time.Second},
+		{attempts: 3, err: errors.New("timeout"), expected: 4 * time.Second},
+		{attempts: 10, err: errors.New("timeout"), expected: 10 * time.Second},
+		{attempts: 100, err: errors.New("timeout"), expected: 10 * time.Second},
+		{attempts: 1, err: &fcm.FCMError{StatusCode: 429, RetryAfter: time.Minute}, expected: time.Minute},
+	}
+
+	for _, tc := range testCases {
+		if delay := outbox.backoff(tc.attempts, tc.err); delay != tc.expected {
+			t.Errorf("expected a delay of %v after %d attempts, got %v", tc.expected, tc.attempts, delay)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+// Entry is a message queued in an Outbox.
+type Entry struct {
+	// ID identifies the entry in its store.
+	ID string `json:"id"`
+	// Payload is the message to send.
+	Payload *fcm.MessagePayload `json:"payload"`
+	// EnqueuedAt is when the message was enqueued. Entries are sent in this order.
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	// Attempts is the number of failed attempts to send the message.
+	Attempts int `json:"attempts,omitempty"`
+	// NextAttempt is when the message is sent next, after a failed attempt.
+	NextAttempt time.Time `json:"next_attempt"`
+	// ErrorCode and Error describe the last failed attempt.
+	ErrorCode fcm.ErrorCode `json:"error_code,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Store persists the entries of an Outbox. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put adds the entry to the store, replacing any entry with the same ID.
+	// The entry must be durable once Put returns.
+	Put(ctx context.Context, entry *Entry) error
+	// Delete removes the entry with the given ID. Deleting a missing entry is not an error.
+	Delete(ctx context.Context, id string) error
+	// List returns every entry of the store, ordered by EnqueuedAt.
+	List(ctx context.Context) ([]*Entry, error)
+}
+
+// MemoryStore is a Store keeping its entries in memory. It does not survive restarts and
+// is mostly useful as a dead-letter store inspected by the application, or in tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(ctx context.Context, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.ID] = *entry
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List(ctx context.Context) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entry := entry
+		entries = append(entries, &entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// sortEntries orders entries by EnqueuedAt, then by ID.
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].EnqueuedAt.Equal(entries[j].EnqueuedAt) {
+			return entries[i].EnqueuedAt.Before(entries[j].EnqueuedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
@@ -0,0 +1,410 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// messageKeys are the JSON keys of the fields modelled by Message.
+var messageKeys = jsonKeys(reflect.TypeOf(Message{}))
+
+// ParseOption configures ParseMessage.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	disallowUnknownFields bool
+}
+
+// DisallowUnknownFields makes ParseMessage return an error if the document contains
+// fields that are not modelled by MessagePayload, instead of preserving them in
+// Message.Extensions or dropping them.
+func DisallowUnknownFields() ParseOption {
+	return func(o *parseOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// ParseMessage decodes a raw FCM v1 request body, i.e. a {"message": {...}} document,
+// into a MessagePayload. Unknown fields of the message, at any depth, are preserved in Message.Extensions
+// and sent back to FCM unchanged, unless DisallowUnknownFields is given.
+func ParseMessage(data []byte, opts ...ParseOption) (*MessagePayload, error) {
+	var options parseOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var document map[string]json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("fcm: parsing message: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("fcm: parsing message: unexpected data after the document")
+	}
+	if _, ok := document["message"]; !ok {
+		return nil, fmt.Errorf("fcm: parsing message: missing \"message\" field")
+	}
+	if options.disallowUnknownFields {
+		for key := range document {
+			if key != "message" && key != "validate_only" {
+				return nil, fmt.Errorf("fcm: parsing message: unknown field %q", key)
+			}
+		}
+	}
+
+	var payload MessagePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("fcm: parsing message: %w", err)
+	}
+
+	if options.disallowUnknownFields {
+		if unknown, err := unknownFields(document["message"], payload.Message); err != nil {
+			return nil, err
+		} else if len(unknown) > 0 {
+			return nil, fmt.Errorf("fcm: parsing message: unknown fields %s", strings.Join(unknown, ", "))
+		}
+	}
+
+	return &payload, nil
+}
+
+// MarshalJSON encodes the message, appending its Extensions after the modelled fields.
+// Nested extensions are inserted into their section, if the message still has it.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	data, err := json.Marshal(message(m))
+	if err != nil || len(m.Extensions) == 0 {
+		return data, err
+	}
+
+	extensions := make(map[string]json.RawMessage, len(m.Extensions))
+	var nested []string
+	for key, value := range m.Extensions {
+		switch {
+		case isNestedPath(key):
+			nested = append(nested, key)
+		case !messageKeys[key]:
+			extensions[key] = value
+		}
+	}
+	if data, err = appendJSONFields(data, extensions); err != nil {
+		return nil, err
+	}
+	sort.Strings(nested)
+	for _, path := range nested {
+		if data, err = setJSONPath(data, splitJSONPath(path), m.Extensions[path]); err != nil {
+			return nil, fmt.Errorf("fcm: encoding extension %q: %w", path, err)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalJSON decodes the message, collecting unknown fields into Extensions.
+// Unknown fields of nested sections are collected under their path, such as
+// android.notification.channel_id or webpush.notification.actions[0].type.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	var decoded message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	extensions := make(map[string]json.RawMessage)
+	for key, value := range fields {
+		if !messageKeys[key] {
+			extensions[key] = value
+		}
+	}
+	nested, err := lostFields(data, Message(decoded))
+	if err != nil {
+		return err
+	}
+	for path, value := range nested {
+		if isNestedPath(path) {
+			if extensions[path], err = json.Marshal(value); err != nil {
+				return err
+			}
+		}
+	}
+	if len(extensions) > 0 {
+		decoded.Extensions = extensions
+	}
+
+	*m = Message(decoded)
+	return nil
+}
+
+// unknownFields reports the paths of the fields of the raw message that were lost when
+// decoding it into message, ignoring its Extensions.
+func unknownFields(raw json.RawMessage, message Message) ([]string, error) {
+	message.Extensions = nil
+	lost, err := lostFields(raw, message)
+	if err != nil {
+		return nil, err
+	}
+	unknown := make([]string, 0, len(lost))
+	for path := range lost {
+		unknown = append(unknown, "message."+path)
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// lostFields returns the fields of the raw message missing from message, by path relative to the
+// message, by comparing the raw document with the modelled fields of message re-encoded.
+func lostFields(raw json.RawMessage, message Message) (map[string]interface{}, error) {
+	message.Extensions = nil
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := decodeJSONValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	roundTripped, err := decodeJSONValue(encoded)
+	if err != nil {
+		return nil, err
+	}
+	lost := make(map[string]interface{})
+	collectUnknownFields("", original, roundTripped, reflect.TypeOf(message), lost)
+	return lost, nil
+}
+
+// decodeJSONValue decodes data, keeping its numbers as json.Number so that they are encoded unchanged.
+func decodeJSONValue(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// collectUnknownFields records in unknown the values of original missing from roundTripped, by path.
+// t is the type original was decoded into; the modelled fields of t are only reported when they
+// have a non-empty value, since empty values are legitimately omitted when re-encoded.
+func collectUnknownFields(path string, original, roundTripped interface{}, t reflect.Type, unknown map[string]interface{}) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch original := original.(type) {
+	case map[string]interface{}:
+		other, _ := roundTripped.(map[string]interface{})
+		var fields map[string]reflect.Type
+		if t != nil && t.Kind() == reflect.Struct {
+			fields = encodedFields(t)
+		}
+		for key, value := range original {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			otherValue, ok := other[key]
+			if !ok && isHeaderMap(path, t) {
+				otherValue, ok = lookupHeader(other, key)
+			}
+			if !ok {
+				if _, modelled := fields[key]; !modelled || !isZeroJSON(value) {
+					unknown[keyPath] = value
+				}
+				continue
+			}
+			var child reflect.Type
+			switch {
+			case fields != nil:
+				child = fields[key]
+			case t != nil && t.Kind() == reflect.Map:
+				child = t.Elem()
+			}
+			collectUnknownFields(keyPath, value, otherValue, child, unknown)
+		}
+	case []interface{}:
+		other, _ := roundTripped.([]interface{})
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i, value := range original {
+			if i < len(other) {
+				collectUnknownFields(fmt.Sprintf("%s[%d]", path, i), value, other[i], elem, unknown)
+			}
+		}
+	}
+}
+
+// wireTypes maps the types with a custom JSON encoding to a struct type with the same JSON fields.
+var wireTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(AndroidConfig{}): reflect.TypeOf(struct {
+		androidConfig
+		TTL string `json:"ttl"`
+	}{}),
+	reflect.TypeOf(CriticalSound{}): reflect.TypeOf(struct {
+		CriticalSound
+		Critical int `json:"critical"`
+	}{}),
+	reflect.TypeOf(Aps{}): reflect.TypeOf(apsWire{}),
+	reflect.TypeOf(WebpushNotification{}): reflect.TypeOf(struct {
+		webpushNotification
+		Timestamp int64 `json:"timestamp"`
+	}{}),
+}
+
+// encodedFields returns the type of each JSON field of the struct type t, by key.
+func encodedFields(t reflect.Type) map[string]reflect.Type {
+	if wire, ok := wireTypes[t]; ok {
+		t = wire
+	}
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+		case name == "" && field.Anonymous:
+			for key, fieldType := range encodedFields(field.Type) {
+				if _, ok := fields[key]; !ok {
+					fields[key] = fieldType
+				}
+			}
+		case name == "" && field.IsExported():
+			fields[field.Name] = field.Type
+		case name != "":
+			fields[name] = field.Type
+		}
+	}
+	return fields
+}
+
+// isHeaderMap reports whether the object at path is a map of HTTP headers, whose
+// names are not case sensitive.
+func isHeaderMap(path string, t reflect.Type) bool {
+	return t != nil && t.Kind() == reflect.Map && (path == "headers" || strings.HasSuffix(path, ".headers"))
+}
+
+// isNestedPath reports whether the extension key is the path of a field of a nested section.
+func isNestedPath(key string) bool {
+	return strings.ContainsAny(key, ".[")
+}
+
+// splitJSONPath splits a path such as a.b[0].c into its keys and indexes: a, b, [0], c.
+func splitJSONPath(path string) []string {
+	var parts []string
+	for _, key := range strings.Split(path, ".") {
+		for key != "" {
+			i := strings.IndexByte(key[1:], '[')
+			if i < 0 {
+				break
+			}
+			parts = append(parts, key[:i+1])
+			key = key[i+1:]
+		}
+		if key != "" {
+			parts = append(parts, key)
+		}
+	}
+	return parts
+}
+
+// setJSONPath sets the field at path in the encoded JSON data to value, unless the field is already
+// set or one of its parents is missing. The objects along the path are re-encoded with sorted keys.
+func setJSONPath(data []byte, path []string, value json.RawMessage) ([]byte, error) {
+	if len(path) == 0 {
+		return data, nil
+	}
+	key := path[0]
+	if strings.HasPrefix(key, "[") {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return nil, err
+		}
+		i, err := strconv.Atoi(strings.Trim(key, "[]"))
+		if err != nil || i < 0 || i >= len(elements) || len(path) == 1 {
+			return data, nil
+		}
+		if elements[i], err = setJSONPath(elements[i], path[1:], value); err != nil {
+			return nil, err
+		}
+		return json.Marshal(elements)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	child, ok := fields[key]
+	switch {
+	case len(path) == 1 && ok:
+		// The modelled field takes precedence.
+		return data, nil
+	case len(path) == 1:
+		fields[key] = value
+	case !ok || bytes.Equal(child, []byte("null")):
+		return data, nil
+	default:
+		var err error
+		if fields[key], err = setJSONPath(child, path[1:], value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// lookupHeader returns the value of the header key in fields, ignoring case.
+func lookupHeader(fields map[string]interface{}, key string) (interface{}, bool) {
+	for k, value := range fields {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// isZeroJSON reports whether a decoded JSON value is empty, and therefore
+// legitimately omitted when re-encoded.
+func isZeroJSON(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !value
+	case json.Number:
+		f, err := value.Float64()
+		return err == nil && f == 0
+	case string:
+		return value == ""
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		for _, v := range value {
+			if !isZeroJSON(v) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// jsonKeys returns the JSON keys of the exported fields of the struct type t.
+func jsonKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
@@ -0,0 +1,222 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMessage(t *testing.T) {
+	testCases := []struct {
+		name       string
+		data       string
+		opts       []ParseOption
+		expectsErr bool
+	}{
+		{name: "valid message", data: `{"message":{"token":"test","data":{"k":"v"}}}`},
+		{name: "validate only", data: `{"validate_only":true,"message":{"topic":"news"}}`},
+		{name: "not an object", data: `[]`, expectsErr: true},
+		{name: "missing message", data: `{"token":"test"}`, expectsErr: true},
+		{name: "trailing data", data: `{"message":{}} {}`, expectsErr: true},
+		{name: "invalid ttl", data: `{"message":{"android":{"ttl":"3600"}}}`, expectsErr: true},
+		{name: "unknown message field", data: `{"message":{"token":"test","future":{"a":1}}}`},
+		{
+			name:       "unknown message field when disallowed",
+			data:       `{"message":{"token":"test","future":{"a":1}}}`,
+			opts:       []ParseOption{DisallowUnknownFields()},
+			expectsErr: true,
+		},
+		{
+			name:       "unknown nested field when disallowed",
+			data:       `{"message":{"token":"test","android":{"notification":{"channel_id":"orders"}}}}`,
+			opts:       []ParseOption{DisallowUnknownFields()},
+			expectsErr: true,
+		},
+		{
+			name:       "unknown document field when disallowed",
+			data:       `{"message":{"token":"test"},"dry_run":true}`,
+			opts:       []ParseOption{DisallowUnknownFields()},
+			expectsErr: true,
+		},
+		{
+			name:       "zero valued unknown field when disallowed",
+			data:       `{"message":{"token":"test","android":{"notification":{"sticky_future":false}}}}`,
+			opts:       []ParseOption{DisallowUnknownFields()},
+			expectsErr: true,
+		},
+		{
+			name:       "miscased field when disallowed",
+			data:       `{"message":{"token":"test","android":{"Priority":"high"}}}`,
+			opts:       []ParseOption{DisallowUnknownFields()},
+			expectsErr: true,
+		},
+		{
+			name: "zero valued known fields when disallowed",
+			data: `{"message":{"token":"test","android":{"priority":"","ttl":"","notification":{"title":""}},` +
+				`"apns":{"headers":{"Apns-Priority":"5"},"payload":{"aps":{"badge":null,"mutable-content":0}}},` +
+				`"webpush":{"notification":{"renotify":false,"timestamp":0}}}}`,
+			opts: []ParseOption{DisallowUnknownFields()},
+		},
+		{
+			name: "known fields when disallowed",
+			data: `{"message":{"token":"test","android":{"priority":"high","ttl":"3.5s","direct_boot_ok":false},` +
+				`"apns":{"headers":{"apns-priority":"5"},"payload":{"aps":{"content-available":1},"order_id":"42"}},` +
+				`"webpush":{"headers":{"ttl":"60"},"notification":{"title":"Hello","x-custom":true}}}}`,
+			opts: []ParseOption{DisallowUnknownFields()},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseMessage([]byte(tc.data), tc.opts...)
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseMessage_RoundTrip(t *testing.T) {
+	data := `{"message":{"token":"test","notification":{"title":"Hello"},` +
+		`"android":{"priority":"high","ttl":"3.5s"},"future":{"a":1},"another":"x"}}`
+
+	payload, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if payload.Message.Android.TTL != 3500*time.Millisecond {
+		t.Errorf("expected ttl 3.5s, got %v", payload.Message.Android.TTL)
+	}
+	if len(payload.Message.Extensions) != 2 {
+		t.Errorf("expected 2 extensions, got %v", payload.Message.Extensions)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"message":{"token":"test","notification":{"title":"Hello"},` +
+		`"android":{"priority":"high","ttl":"3.5s"},"another":"x","future":{"a":1}}}`
+	if string(encoded) != expected {
+		t.Errorf("expected %s, got %s", expected, encoded)
+	}
+}
+
+func TestParseMessage_NestedRoundTrip(t *testing.T) {
+	data := `{"message":{"token":"test","android":{"priority":"high","notification":{"title":"Hi","channel_id":"orders"}},` +
+		`"webpush":{"notification":{"title":"Hi","actions":[{"action":"open","title":"Open","type":"button"}]}},` +
+		`"apns":{"headers":{"apns-priority":"10"},"future":{"id":9007199254740993}}}}`
+
+	payload, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, path := range []string{"android.notification.channel_id", "webpush.notification.actions[0].type", "apns.future"} {
+		if _, ok := payload.Message.Extensions[path]; !ok {
+			t.Errorf("expected extension %s, got %v", path, payload.Message.Extensions)
+		}
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var expected, actual interface{}
+	json.Unmarshal([]byte(data), &expected)
+	json.Unmarshal(encoded, &actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %s, got %s", data, encoded)
+	}
+	if !strings.Contains(string(encoded), "9007199254740993") {
+		t.Errorf("expected the large integer to be preserved, got %s", encoded)
+	}
+
+	// Extensions of a removed section are dropped with it.
+	payload.Message.Android = nil
+	if encoded, _ := json.Marshal(payload); strings.Contains(string(encoded), "channel_id") {
+		t.Errorf("expected the android extension to be dropped, got %s", encoded)
+	}
+}
+
+func TestParseMessage_ZeroValuedExtensions(t *testing.T) {
+	data := `{"message":{"token":"test","android":{"priority":"","notification":{"title":"Hi","count":0,"sticky_future":false}},` +
+		`"webpush":{"notification":{"actions":[{"action":"open","type":""}]}}}}`
+
+	payload, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := map[string]json.RawMessage{
+		"android.notification.count":           json.RawMessage(`0`),
+		"android.notification.sticky_future":   json.RawMessage(`false`),
+		"webpush.notification.actions[0].type": json.RawMessage(`""`),
+	}
+	if !reflect.DeepEqual(payload.Message.Extensions, expected) {
+		t.Errorf("expected extensions %s, got %s", expected, payload.Message.Extensions)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(string(encoded), `"sticky_future":false`) || !strings.Contains(string(encoded), `"type":""`) {
+		t.Errorf("expected the zero valued extensions to be sent, got %s", encoded)
+	}
+}
+
+func TestSendRaw(t *testing.T) {
+	body := `{"message":{"token":"test","future":true}}`
+	testCases := []struct {
+		name         string
+		body         string
+		expectedName string
+		expectsErr   bool
+	}{
+		{name: "valid body", body: body, expectedName: "projects/project_id/messages/1"},
+		{name: "invalid body", body: `{"message":`, expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent string
+			client := NewClient().
+				SetCredentialFile(testServiceAccountFile).
+				SetHTTPClient(&testHttpClient{
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						if strings.Contains(req.URL.String(), "messages:send") {
+							data, _ := io.ReadAll(req.Body)
+							sent = string(data)
+						}
+						return &http.Response{
+							StatusCode: 200,
+							Body:       io.NopCloser(strings.NewReader(`{"name":"projects/project_id/messages/1"}`)),
+						}, nil
+					},
+				})
+
+			res, err := client.SendRaw(context.Background(), json.RawMessage(tc.body))
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if res.Name != tc.expectedName {
+				t.Errorf("expected name %q, got %q", tc.expectedName, res.Name)
+			}
+			if sent != tc.body {
+				t.Errorf("expected body %s to be sent as is, got %s", tc.body, sent)
+			}
+		})
+	}
+}
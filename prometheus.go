@@ -0,0 +1,171 @@
+package fcm
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the latency histograms of PrometheusMetrics.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a Metrics implementation keeping the measurements in memory and
+// serving them in the Prometheus text exposition format. It implements http.Handler:
+//
+//	metrics := fcm.NewPrometheusMetrics()
+//	client := fcm.NewClient().SetMetrics(metrics)
+//	http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	mu           sync.Mutex
+	sends        map[[3]string]uint64
+	sendLatency  *histogram
+	tokenLatency map[string]*histogram
+	inFlight     int64
+	buckets      []float64
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics using the given histogram buckets,
+// or DefaultLatencyBuckets if none are given.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		sends:        make(map[[3]string]uint64),
+		sendLatency:  newHistogram(buckets),
+		tokenLatency: make(map[string]*histogram),
+		buckets:      buckets,
+	}
+}
+
+// IncSends implements Metrics.
+func (m *PrometheusMetrics) IncSends(target, outcome string, code ErrorCode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sends[[3]string{target, outcome, string(code)}]++
+}
+
+// ObserveSendLatency implements Metrics.
+func (m *PrometheusMetrics) ObserveSendLatency(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sendLatency.observe(duration.Seconds())
+}
+
+// ObserveTokenLatency implements Metrics.
+func (m *PrometheusMetrics) ObserveTokenLatency(outcome string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.tokenLatency[outcome]
+	if !ok {
+		h = newHistogram(m.buckets)
+		m.tokenLatency[outcome] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// AddInFlight implements Metrics.
+func (m *PrometheusMetrics) AddInFlight(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight += int64(delta)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.writeTo(bw)
+	bw.Flush()
+}
+
+func (m *PrometheusMetrics) writeTo(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP fcm_sends_total Number of completed sends by target type, outcome and FCM error code.")
+	fmt.Fprintln(w, "# TYPE fcm_sends_total counter")
+	keys := make([][3]string, 0, len(m.sends))
+	for key := range m.sends {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], "\x00") < strings.Join(keys[j][:], "\x00")
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "fcm_sends_total{target=%s,outcome=%s,error_code=%s} %d\n",
+			quoteLabel(key[0]), quoteLabel(key[1]), quoteLabel(key[2]), m.sends[key])
+	}
+
+	fmt.Fprintln(w, "# HELP fcm_send_duration_seconds Duration of the HTTP requests to the FCM API.")
+	fmt.Fprintln(w, "# TYPE fcm_send_duration_seconds histogram")
+	m.sendLatency.writeTo(w, "fcm_send_duration_seconds", "")
+
+	fmt.Fprintln(w, "# HELP fcm_token_refresh_duration_seconds Duration of the OAuth access token requests by outcome.")
+	fmt.Fprintln(w, "# TYPE fcm_token_refresh_duration_seconds histogram")
+	outcomes := make([]string, 0, len(m.tokenLatency))
+	for outcome := range m.tokenLatency {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+	for _, outcome := range outcomes {
+		m.tokenLatency[outcome].writeTo(w, "fcm_token_refresh_duration_seconds", "outcome="+quoteLabel(outcome)+",")
+	}
+
+	fmt.Fprintln(w, "# HELP fcm_in_flight_requests Number of sends in progress.")
+	fmt.Fprintln(w, "# TYPE fcm_in_flight_requests gauge")
+	fmt.Fprintf(w, "fcm_in_flight_requests %d\n", m.inFlight)
+}
+
+// histogram is a cumulative histogram in the Prometheus sense.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// writeTo writes the samples of the histogram, prefixing the le label with the given labels.
+func (h *histogram) writeTo(w *bufio.Writer, name, labels string) {
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// quoteLabel quotes a label value, escaping backslashes, double quotes and line feeds.
+func quoteLabel(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
@@ -0,0 +1,60 @@
+package fcm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics_ServeHTTP(t *testing.T) {
+	metrics := NewPrometheusMetrics(0.1, 1)
+	metrics.IncSends(TargetToken, OutcomeSuccess, "")
+	metrics.IncSends(TargetToken, OutcomeSuccess, "")
+	metrics.IncSends(TargetTopic, OutcomeFailure, ErrorCodeQuotaExceeded)
+	metrics.ObserveSendLatency(50 * time.Millisecond)
+	metrics.ObserveSendLatency(2 * time.Second)
+	metrics.ObserveTokenLatency(OutcomeSuccess, 500*time.Millisecond)
+	metrics.AddInFlight(2)
+	metrics.AddInFlight(-1)
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("expected Prometheus text content type, got %q", contentType)
+	}
+
+	expected := `# HELP fcm_sends_total Number of completed sends by target type, outcome and FCM error code.
+# TYPE fcm_sends_total counter
+fcm_sends_total{target="token",outcome="success",error_code=""} 2
+fcm_sends_total{target="topic",outcome="failure",error_code="QUOTA_EXCEEDED"} 1
+# HELP fcm_send_duration_seconds Duration of the HTTP requests to the FCM API.
+# TYPE fcm_send_duration_seconds histogram
+fcm_send_duration_seconds_bucket{le="0.1"} 1
+fcm_send_duration_seconds_bucket{le="1"} 1
+fcm_send_duration_seconds_bucket{le="+Inf"} 2
+fcm_send_duration_seconds_sum 2.05
+fcm_send_duration_seconds_count 2
+# HELP fcm_token_refresh_duration_seconds Duration of the OAuth access token requests by outcome.
+# TYPE fcm_token_refresh_duration_seconds histogram
+fcm_token_refresh_duration_seconds_bucket{outcome="success",le="0.1"} 0
+fcm_token_refresh_duration_seconds_bucket{outcome="success",le="1"} 1
+fcm_token_refresh_duration_seconds_bucket{outcome="success",le="+Inf"} 1
+fcm_token_refresh_duration_seconds_sum{outcome="success"} 0.5
+fcm_token_refresh_duration_seconds_count{outcome="success"} 1
+# HELP fcm_in_flight_requests Number of sends in progress.
+# TYPE fcm_in_flight_requests gauge
+fcm_in_flight_requests 1
+`
+	if rec.Body.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, rec.Body.String())
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	if result := quoteLabel("a\"b\\c\nd"); result != `"a\"b\\c\nd"` {
+		t.Errorf("expected escaped label, got %s", result)
+	}
+}
@@ -0,0 +1,335 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a request cannot be sent within the rate limits of the client
+// before the deadline of its context.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+const (
+	// rateRecoveryPeriod is how long a rate lowered after a 429 response takes to grow back to its limit.
+	rateRecoveryPeriod = 10 * time.Second
+	// rateDecreaseInterval is the minimum interval between two decreases of a rate, so that the
+	// concurrent requests throttled together lower it only once.
+	rateDecreaseInterval = time.Second
+	// minSweepSize is the number of per target limiters above which idle ones are removed.
+	minSweepSize = 1024
+)
+
+// RateLimit limits the requests sent to the FCM server.
+type RateLimit struct {
+	// Rate is the maximum number of requests per second. Zero means no limit.
+	Rate float64
+	// Burst is the number of requests that may be sent at once after a quiet period.
+	// It defaults to 1.
+	Burst int
+	// MaxInFlight is the maximum number of requests in progress at the same time. Zero means no limit.
+	MaxInFlight int
+}
+
+// RateLimits configures the client side rate limiting of the FCM client.
+type RateLimits struct {
+	// Global limits every request sent by the client.
+	Global RateLimit
+	// PerToken limits the requests sent to each device token.
+	PerToken RateLimit
+	// PerTopic limits the requests sent to each topic.
+	PerTopic RateLimit
+}
+
+// SetRateLimits sets the rate limits applied to every HTTP request sending a message, retries included.
+// A send waits until its request is allowed by every limit that applies, or fails with ErrRateLimited
+// without waiting when that would take longer than the deadline of its context. When the FCM server
+// responds with 429 Too Many Requests, the rates of the limits the request went through are halved and
+// grow back over ten seconds, and no request is sent through them before the delay given by the
+// Retry-After header. By default requests are not limited.
+// It is not safe to call SetRateLimits concurrently with sending messages.
+func (f *FCMClient) SetRateLimits(limits RateLimits) *FCMClient {
+	f.limiter = newRateLimiter(limits)
+	return f
+}
+
+// recipient returns the device token or topic the message is sent to, or an empty string for
+// the other targets.
+func (m Message) recipient() string {
+	if m.Token != "" {
+		return m.Token
+	}
+	return m.Topic
+}
+
+// rateLimiter applies RateLimits to the requests of the client.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limits    RateLimits
+	global    *bucket
+	tokens    map[string]*bucket
+	topics    map[string]*bucket
+	nextSweep int
+	now       func() time.Time
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	return &rateLimiter{
+		limits:    limits,
+		global:    newBucket(limits.Global, time.Now()),
+		tokens:    make(map[string]*bucket),
+		topics:    make(map[string]*bucket),
+		nextSweep: minSweepSize,
+		now:       time.Now,
+	}
+}
+
+// acquire waits until a request to the recipient of the given target type is allowed.
+// It returns a function that must be called with the result of the request once it completes.
+// A nil rateLimiter allows every request.
+func (l *rateLimiter) acquire(ctx context.Context, target, recipient string) (func(err error), error) {
+	if l == nil {
+		return func(error) {}, nil
+	}
+
+	buckets := l.buckets(target, recipient)
+	done := func(err error) {
+		var fcmErr *FCMError
+		throttled := errors.As(err, &fcmErr) && fcmErr.StatusCode == http.StatusTooManyRequests
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, b := range buckets {
+			if throttled {
+				b.throttle(l.now(), fcmErr.RetryAfter)
+			}
+			b.users--
+		}
+	}
+
+	// The buckets of the recipient come before the global one, so that a request waiting for its
+	// recipient does not hold a global slot or token other recipients could use meanwhile.
+	acquired, reserved := 0, 0
+	release := func() {
+		for _, b := range buckets[:acquired] {
+			if b.slots != nil {
+				<-b.slots
+			}
+		}
+	}
+	fail := func(err error) (func(err error), error) {
+		l.mu.Lock()
+		for _, b := range buckets[:reserved] {
+			b.refund()
+		}
+		l.mu.Unlock()
+		release()
+		done(nil)
+		return nil, err
+	}
+	for _, b := range buckets {
+		if b.slots != nil {
+			select {
+			case b.slots <- struct{}{}:
+			case <-ctx.Done():
+				return fail(ctx.Err())
+			}
+		}
+		acquired++
+
+		wait, err := l.reserve(ctx, b)
+		if err != nil {
+			return fail(err)
+		}
+		reserved++
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fail(ctx.Err())
+			case <-timer.C:
+			}
+		}
+	}
+
+	return func(err error) {
+		release()
+		done(err)
+	}, nil
+}
+
+// buckets returns the buckets limiting a request to the recipient, the global one last, marking them in use.
+func (l *rateLimiter) buckets(target, recipient string) []*bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buckets []*bucket
+	switch {
+	case target == TargetToken && l.limits.PerToken != (RateLimit{}):
+		buckets = append(buckets, l.bucket(l.tokens, l.limits.PerToken, recipient))
+	case target == TargetTopic && l.limits.PerTopic != (RateLimit{}):
+		buckets = append(buckets, l.bucket(l.topics, l.limits.PerTopic, recipient))
+	}
+	buckets = append(buckets, l.global)
+	for _, b := range buckets {
+		b.users++
+	}
+	return buckets
+}
+
+// bucket returns the bucket of the recipient in buckets, creating it if needed.
+// It must be called with l.mu held.
+func (l *rateLimiter) bucket(buckets map[string]*bucket, limit RateLimit, recipient string) *bucket {
+	if b, ok := buckets[recipient]; ok {
+		return b
+	}
+	now := l.now()
+	if len(l.tokens)+len(l.topics) >= l.nextSweep {
+		l.sweep(now)
+	}
+	b := newBucket(limit, now)
+	buckets[recipient] = b
+	return b
+}
+
+// sweep removes the per target buckets that are in the same state as new ones.
+// It must be called with l.mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	for _, buckets := range []map[string]*bucket{l.tokens, l.topics} {
+		for recipient, b := range buckets {
+			if b.idle(now) {
+				delete(buckets, recipient)
+			}
+		}
+	}
+	l.nextSweep = 2 * (len(l.tokens) + len(l.topics))
+	if l.nextSweep < minSweepSize {
+		l.nextSweep = minSweepSize
+	}
+}
+
+// reserve takes a token from the bucket and returns how long to wait before sending the request.
+// It returns ErrRateLimited, without taking the token, if the wait would exceed the deadline of ctx.
+func (l *rateLimiter) reserve(ctx context.Context, b *bucket) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	wait := b.wait(now)
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		return 0, ErrRateLimited
+	}
+	b.take()
+	return wait, nil
+}
+
+// bucket is a token bucket whose rate is lowered when the FCM server throttles the requests.
+type bucket struct {
+	limit RateLimit
+	// slots holds one element per request in flight when MaxInFlight is set.
+	slots chan struct{}
+	// users is the number of requests holding or waiting for the bucket.
+	users int
+
+	tokens float64
+	last   time.Time
+	// throttledRate is the rate set when the bucket was last throttled, at throttledAt.
+	// It is zero when the rate is back to its limit.
+	throttledRate float64
+	throttledAt   time.Time
+	pausedUntil   time.Time
+}
+
+func newBucket(limit RateLimit, now time.Time) *bucket {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	b := &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+	if limit.MaxInFlight > 0 {
+		b.slots = make(chan struct{}, limit.MaxInFlight)
+	}
+	return b
+}
+
+// rate returns the current rate of the bucket, growing linearly back to its limit after a throttle.
+func (b *bucket) rate(now time.Time) float64 {
+	if b.throttledRate == 0 {
+		return b.limit.Rate
+	}
+	rate := b.throttledRate + b.limit.Rate*float64(now.Sub(b.throttledAt))/float64(rateRecoveryPeriod)
+	if rate >= b.limit.Rate {
+		b.throttledRate = 0
+		return b.limit.Rate
+	}
+	return rate
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += b.rate(now) * now.Sub(b.last).Seconds()
+		if burst := float64(b.limit.Burst); b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = now
+	}
+}
+
+// wait returns how long a request must wait for a token of the bucket.
+func (b *bucket) wait(now time.Time) time.Duration {
+	var wait time.Duration
+	if b.pausedUntil.After(now) {
+		wait = b.pausedUntil.Sub(now)
+	}
+	if b.limit.Rate == 0 {
+		return wait
+	}
+	b.refill(now)
+	if b.tokens < 1 {
+		if w := time.Duration((1 - b.tokens) / b.rate(now) * float64(time.Second)); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// take takes a token, possibly going into debt for a request waiting for it.
+func (b *bucket) take() {
+	if b.limit.Rate > 0 {
+		b.tokens--
+	}
+}
+
+// refund gives back the token taken by a request that gave up waiting.
+func (b *bucket) refund() {
+	if b.limit.Rate > 0 {
+		b.tokens++
+	}
+}
+
+// throttle halves the rate of the bucket and pauses it for retryAfter.
+func (b *bucket) throttle(now time.Time, retryAfter time.Duration) {
+	if until := now.Add(retryAfter); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	if b.limit.Rate == 0 || (b.throttledRate != 0 && now.Sub(b.throttledAt) < rateDecreaseInterval) {
+		return
+	}
+	b.refill(now)
+	b.throttledRate = b.rate(now) / 2
+	b.throttledAt = now
+}
+
+// idle reports whether the bucket is unused and in the same state as a new one.
+func (b *bucket) idle(now time.Time) bool {
+	if b.users > 0 || b.pausedUntil.After(now) {
+		return false
+	}
+	if b.limit.Rate == 0 {
+		return true
+	}
+	b.refill(now)
+	return b.throttledRate == 0 && b.tokens >= float64(b.limit.Burst)
+}
@@ -0,0 +1,275 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestRateLimitClient(limits RateLimits, doFunc func(req *http.Request) (int, string)) *FCMClient {
+	return NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetRateLimits(limits).
+		SetHTTPClient(&testHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if !strings.HasSuffix(req.URL.Path, "messages:send") {
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+				}
+				status, body := doFunc(req)
+				return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}, nil
+			},
+		})
+}
+
+func TestSetRateLimits_Rate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		limits      RateLimits
+		messages    []Message
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "global rate",
+			limits:      RateLimits{Global: RateLimit{Rate: 100}},
+			messages:    []Message{{Token: "a"}, {Token: "b"}, {Topic: "news"}, {Condition: "'a' in topics"}, {Token: "c"}},
+			minDuration: 40 * time.Millisecond,
+		},
+		{
+			name:        "global burst",
+			limits:      RateLimits{Global: RateLimit{Rate: 1, Burst: 3}},
+			messages:    []Message{{Token: "a"}, {Token: "b"}, {Token: "c"}},
+			maxDuration: 500 * time.Millisecond,
+		},
+		{
+			name:        "per token rate",
+			limits:      RateLimits{PerToken: RateLimit{Rate: 50}},
+			messages:    []Message{{Token: "a"}, {Token: "a"}, {Token: "a"}},
+			minDuration: 40 * time.Millisecond,
+		},
+		{
+			name:        "per token rate with different tokens",
+			limits:      RateLimits{PerToken: RateLimit{Rate: 1}},
+			messages:    []Message{{Token: "a"}, {Token: "b"}, {Token: "c"}, {Topic: "news"}},
+			maxDuration: 500 * time.Millisecond,
+		},
+		{
+			name:        "per topic rate",
+			limits:      RateLimits{PerTopic: RateLimit{Rate: 50}},
+			messages:    []Message{{Topic: "news"}, {Topic: "news"}, {Topic: "news"}},
+			minDuration: 40 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestRateLimitClient(tc.limits, func(req *http.Request) (int, string) {
+				return 200, `{"name":"projects/project_id/messages/1"}`
+			})
+
+			start := time.Now()
+			for _, msg := range tc.messages {
+				if _, err := client.SendContext(context.Background(), &MessagePayload{Message: msg}); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			}
+			elapsed := time.Since(start)
+			if elapsed < tc.minDuration {
+				t.Errorf("expected sends to take at least %v, took %v", tc.minDuration, elapsed)
+			}
+			if tc.maxDuration > 0 && elapsed > tc.maxDuration {
+				t.Errorf("expected sends to take at most %v, took %v", tc.maxDuration, elapsed)
+			}
+		})
+	}
+}
+
+func TestSetRateLimits_MaxInFlight(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	client := newTestRateLimitClient(RateLimits{Global: RateLimit{MaxInFlight: 3}}, func(req *http.Request) (int, string) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return 200, `{"name":"projects/project_id/messages/1"}`
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SendContext(context.Background(), &MessagePayload{Message: Message{Token: "token"}}); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 3 {
+		t.Errorf("expected 3 requests in flight at most, got %d", maxInFlight)
+	}
+}
+
+func TestSetRateLimits_Context(t *testing.T) {
+	client := newTestRateLimitClient(RateLimits{Global: RateLimit{Rate: 0.1, MaxInFlight: 1}}, func(req *http.Request) (int, string) {
+		return 200, `{"name":"projects/project_id/messages/1"}`
+	})
+	msg := &MessagePayload{Message: Message{Token: "token"}}
+	if _, err := client.SendContext(context.Background(), msg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.SendContext(ctx, msg); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected the send to fail fast, took %v", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := client.SendContext(ctx, msg); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// The token taken by the canceled send is given back, and the in flight slot released.
+	if tokens := client.limiter.global.tokens; tokens < -0.01 {
+		t.Errorf("expected the token of the canceled send to be refunded, got %v tokens", tokens)
+	}
+	if n := len(client.limiter.global.slots); n != 0 {
+		t.Errorf("expected no request in flight, got %d", n)
+	}
+}
+
+func TestSetRateLimits_Throttle(t *testing.T) {
+	attempts := 0
+	client := newTestRateLimitClient(RateLimits{PerToken: RateLimit{Rate: 100}}, func(req *http.Request) (int, string) {
+		attempts++
+		if attempts == 1 {
+			return 429, `{"error":{"status":"RESOURCE_EXHAUSTED","message":"quota"}}`
+		}
+		return 200, `{"name":"projects/project_id/messages/1"}`
+	})
+	client.SetMaxRetries(1)
+	client.retryBackoff = time.Millisecond
+
+	if _, err := client.SendContext(context.Background(), &MessagePayload{Message: Message{Token: "token"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	b := client.limiter.tokens["token"]
+	if b.throttledRate != 50 {
+		t.Errorf("expected the rate of the token to be halved, got %v", b.throttledRate)
+	}
+	if client.limiter.global.throttledRate != 0 {
+		t.Errorf("expected the unlimited global rate to be unchanged, got %v", client.limiter.global.throttledRate)
+	}
+}
+
+func TestBucket_Throttle(t *testing.T) {
+	now := time.Now()
+	b := newBucket(RateLimit{Rate: 100}, now)
+
+	b.throttle(now, 2*time.Second)
+	if rate := b.rate(now); rate != 50 {
+		t.Errorf("expected rate 50 after a throttle, got %v", rate)
+	}
+	if wait := b.wait(now); wait != 2*time.Second {
+		t.Errorf("expected to wait for the Retry-After delay, got %v", wait)
+	}
+
+	b.throttle(now.Add(100*time.Millisecond), 0)
+	if rate := b.rate(now.Add(100 * time.Millisecond)); rate != 51 {
+		t.Errorf("expected concurrent throttles to lower the rate once, got %v", rate)
+	}
+
+	b.throttle(now.Add(5*time.Second), 0)
+	if rate := b.rate(now.Add(5 * time.Second)); rate != 50 {
+		t.Errorf("expected rate 50 after a second throttle, got %v", rate)
+	}
+	if rate := b.rate(now.Add(7500 * time.Millisecond)); rate != 75 {
+		t.Errorf("expected the rate to grow back to 75, got %v", rate)
+	}
+	if rate := b.rate(now.Add(time.Minute)); rate != 100 {
+		t.Errorf("expected the rate to grow back to its limit, got %v", rate)
+	}
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	limiter := newRateLimiter(RateLimits{PerToken: RateLimit{Rate: 1000}})
+	ctx := context.Background()
+	busy, err := limiter.acquire(ctx, TargetToken, "busy")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for i := 1; i < minSweepSize; i++ {
+		done, err := limiter.acquire(ctx, TargetToken, string(rune('a'+i%26))+strings.Repeat("x", i/26))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		done(nil)
+	}
+
+	limiter.now = func() time.Time { return time.Now().Add(time.Second) }
+	done, err := limiter.acquire(ctx, TargetToken, "new")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	done(nil)
+	busy(nil)
+
+	if len(limiter.tokens) != 2 {
+		t.Errorf("expected the idle limiters to be removed, got %d limiters", len(limiter.tokens))
+	}
+}
+
+func TestSetRateLimits_MaxInFlightPerToken(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	client := newTestRateLimitClient(RateLimits{Global: RateLimit{MaxInFlight: 2}, PerToken: RateLimit{MaxInFlight: 1}}, func(req *http.Request) (int, string) {
+		body, _ := io.ReadAll(req.Body)
+		if strings.Contains(string(body), `"token":"a"`) {
+			started <- struct{}{}
+			<-release
+		}
+		return 200, `{"name":"projects/project_id/messages/1"}`
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SendContext(context.Background(), &MessagePayload{Message: Message{Token: "a"}}); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	<-started
+	// Give the other sends to a the time to queue behind the first one.
+	time.Sleep(20 * time.Millisecond)
+
+	// The sends waiting for a must not hold the global slots b needs.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.SendContext(ctx, &MessagePayload{Message: Message{Token: "b"}}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+}
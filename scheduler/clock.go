@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/patrickkabwe/go-fcm/internal/runner"
+)
+
+// Clock tells the time and creates the timers of a Scheduler, so that tests can control time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a timer firing once d has elapsed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event created by a Clock.
+type Timer interface {
+	// C returns the channel receiving the time once the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing.
+	Stop() bool
+}
+
+// SystemClock is the Clock of the operating system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return runner.NewTimer(d) }
@@ -0,0 +1,313 @@
+// Package scheduler sends messages at a given time.
+//
+// FCM has no option to deliver a message later, so a Scheduler keeps the scheduled messages in a
+// Store and sends each of them once its time comes. Schedules are persisted before they are
+// accepted and removed once sent, so the messages scheduled when the process stops are sent when a
+// Scheduler is started again on the same store, immediately if their time has passed meanwhile.
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+	"github.com/patrickkabwe/go-fcm/internal/logging"
+	"github.com/patrickkabwe/go-fcm/internal/runner"
+)
+
+var (
+	// ErrNotFound is returned by Cancel for a schedule that is not pending.
+	ErrNotFound = errors.New("scheduler: schedule not found")
+	// ErrClosed is returned when scheduling a message once the scheduler is shut down.
+	ErrClosed = errors.New("scheduler: closed")
+)
+
+// Options configures a Scheduler.
+type Options struct {
+	// Concurrency is the maximum number of messages sent in parallel. Defaults to fcm.DefaultConcurrency.
+	Concurrency int
+	// Clock tells the time. Defaults to SystemClock.
+	Clock Clock
+	// OnSent, if set, is called with the outcome of every scheduled message once sent.
+	// Failed messages are not retried by the scheduler; use an fcm.Sender that retries, such as an
+	// FCMClient with retries enabled, or one enqueuing to an outbox.
+	OnSent func(schedule *Schedule, res *fcm.SendResponse, err error)
+	// Logger receives the failed sends and store errors. It may be nil.
+	Logger *slog.Logger
+}
+
+// Scheduler sends the messages of a Store at their scheduled time.
+type Scheduler struct {
+	store  Store
+	sender fcm.Sender
+	opts   Options
+
+	mu      sync.Mutex
+	queue   scheduleQueue
+	pending map[string]*Schedule
+	// loaded is set once Start has queued the schedules of the store. Until then, cancelled holds
+	// the schedules cancelled in the store only, so that Start does not queue them.
+	loaded    bool
+	cancelled map[string]bool
+	runner    *runner.Runner
+}
+
+// New returns a Scheduler sending the messages of store with sender. Call Start to begin sending.
+func New(store Store, sender fcm.Sender, opts Options) *Scheduler {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = fcm.DefaultConcurrency
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Discard()
+	}
+
+	s := &Scheduler{
+		store:     store,
+		sender:    sender,
+		opts:      opts,
+		pending:   make(map[string]*Schedule),
+		cancelled: make(map[string]bool),
+	}
+	newTimer := func(d time.Duration) runner.Timer { return opts.Clock.NewTimer(d) }
+	s.runner = runner.New(opts.Concurrency, newTimer, s.next)
+	return s
+}
+
+// SendAt schedules the message to be sent at the given time, and returns the ID of the schedule.
+// A time in the past sends the message as soon as possible.
+func (s *Scheduler) SendAt(ctx context.Context, at time.Time, msg *fcm.MessagePayload) (string, error) {
+	return s.schedule(ctx, &Schedule{Payload: msg, SendAt: at})
+}
+
+// SendAfter schedules the message to be sent once d has elapsed, and returns the ID of the schedule.
+func (s *Scheduler) SendAfter(ctx context.Context, d time.Duration, msg *fcm.MessagePayload) (string, error) {
+	return s.SendAt(ctx, s.opts.Clock.Now().Add(d), msg)
+}
+
+// SendAtLocal schedules the message to be sent at the next occurrence of the wall clock time
+// hour:minute in the time zone of the recipient, given as an IANA name such as "Europe/Paris",
+// and returns the ID of the schedule. For example SendAtLocal(ctx, 9, 0, "Asia/Tokyo", msg)
+// sends the message at the next 9am in Tokyo.
+func (s *Scheduler) SendAtLocal(ctx context.Context, hour, minute int, timezone string, msg *fcm.MessagePayload) (string, error) {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return "", fmt.Errorf("scheduler: invalid local time %02d:%02d", hour, minute)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return "", fmt.Errorf("scheduler: %w", err)
+	}
+	return s.schedule(ctx, &Schedule{
+		Payload:  msg,
+		SendAt:   nextLocalTime(s.opts.Clock.Now(), hour, minute, loc),
+		TimeZone: timezone,
+	})
+}
+
+// nextLocalTime returns the first time after now at which the wall clock reads hour:minute in loc.
+func nextLocalTime(now time.Time, hour, minute int, loc *time.Location) time.Time {
+	local := now.In(loc)
+	at := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+	if !at.After(now) {
+		at = time.Date(local.Year(), local.Month(), local.Day()+1, hour, minute, 0, 0, loc)
+	}
+	return at
+}
+
+// schedule validates, persists and queues the schedule.
+func (s *Scheduler) schedule(ctx context.Context, schedule *Schedule) (string, error) {
+	if schedule.Payload == nil {
+		return "", fmt.Errorf("scheduler: payload is required")
+	}
+	if err := schedule.Payload.Message.Validate(); err != nil {
+		return "", err
+	}
+	id, err := runner.NewID()
+	if err != nil {
+		return "", err
+	}
+	if s.runner.Closed() {
+		return "", ErrClosed
+	}
+
+	schedule.ID = id
+	schedule.CreatedAt = s.opts.Clock.Now()
+	if err := s.store.Put(ctx, schedule); err != nil {
+		return "", fmt.Errorf("scheduler: storing schedule: %w", err)
+	}
+	s.push(schedule)
+	return id, nil
+}
+
+// Cancel cancels the pending schedule with the given ID. It returns ErrNotFound if the schedule
+// does not exist or its message has already been sent or is being sent.
+// Before Start, the schedules of the store can be cancelled too, such as those of a previous
+// Scheduler on the same store.
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	s.mu.Lock()
+	_, ok := s.pending[id]
+	delete(s.pending, id)
+	loaded := s.loaded
+	s.mu.Unlock()
+	if !ok && !loaded {
+		var err error
+		if ok, err = s.stored(ctx, id); err != nil {
+			return err
+		}
+		if ok {
+			s.mu.Lock()
+			if s.loaded {
+				// Start queued the schedule meanwhile, and may have sent it already.
+				_, ok = s.pending[id]
+				delete(s.pending, id)
+			} else {
+				s.cancelled[id] = true
+			}
+			s.mu.Unlock()
+		}
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	if err := s.store.Delete(ctx, id); err != nil {
+		return fmt.Errorf("scheduler: deleting schedule: %w", err)
+	}
+	return nil
+}
+
+// stored reports whether the store holds the schedule with the given ID.
+func (s *Scheduler) stored(ctx context.Context, id string) (bool, error) {
+	schedules, err := s.store.List(ctx)
+	if err != nil {
+		return false, fmt.Errorf("scheduler: loading schedules: %w", err)
+	}
+	for _, schedule := range schedules {
+		if schedule.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Start loads the schedules of the store and starts sending their messages in the background.
+func (s *Scheduler) Start(ctx context.Context) error {
+	err := s.runner.Start(func() error {
+		schedules, err := s.store.List(ctx)
+		if err != nil {
+			return fmt.Errorf("scheduler: loading schedules: %w", err)
+		}
+		for _, schedule := range schedules {
+			s.push(schedule)
+		}
+		s.mu.Lock()
+		s.loaded = true
+		s.cancelled = nil
+		s.mu.Unlock()
+		return nil
+	})
+	if errors.Is(err, runner.ErrStarted) {
+		return fmt.Errorf("scheduler: already started")
+	}
+	return err
+}
+
+// Shutdown stops sending messages and waits for the messages in flight to be sent.
+// If ctx is done first, the sends in flight are cancelled and ctx.Err() is returned; their
+// schedules stay in the store and are sent by the next Scheduler started on it.
+// Messages can no longer be scheduled once Shutdown is called.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	return s.runner.Shutdown(ctx)
+}
+
+// push queues the schedule, unless it is already pending.
+func (s *Scheduler) push(schedule *Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[schedule.ID]; ok || s.cancelled[schedule.ID] {
+		return
+	}
+	s.pending[schedule.ID] = schedule
+	heap.Push(&s.queue, schedule)
+	s.runner.Wake()
+}
+
+// next pops the next due schedule and returns the task sending its message. It implements
+// runner.NextFunc.
+func (s *Scheduler) next() (runner.Task, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.opts.Clock.Now()
+	for s.queue.Len() > 0 {
+		next := s.queue[0]
+		if s.pending[next.ID] != next {
+			// Cancelled.
+			heap.Pop(&s.queue)
+			continue
+		}
+		if next.SendAt.After(now) {
+			return nil, next.SendAt.Sub(now), true
+		}
+		heap.Pop(&s.queue)
+		delete(s.pending, next.ID)
+		return func(ctx context.Context) { s.send(ctx, next) }, 0, true
+	}
+	return nil, 0, false
+}
+
+// send sends the message of the schedule and removes the schedule from the store. sendCtx is
+// cancelled when the shutdown of the scheduler is cut short.
+func (s *Scheduler) send(sendCtx context.Context, schedule *Schedule) {
+	res, err := s.sender.SendContext(sendCtx, schedule.Payload)
+	if err != nil && sendCtx.Err() != nil {
+		// Interrupted by the shutdown: the schedule stays in the store.
+		return
+	}
+
+	ctx := context.Background()
+	logger := s.opts.Logger
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "scheduler: sending scheduled message",
+			slog.String("id", schedule.ID),
+			slog.String("error_code", string(fcm.ErrorCodeOf(err))),
+			slog.String("error", err.Error()),
+		)
+	}
+	if err := s.store.Delete(ctx, schedule.ID); err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "scheduler: deleting sent schedule",
+			slog.String("id", schedule.ID), slog.String("error", err.Error()))
+	}
+	if s.opts.OnSent != nil {
+		s.opts.OnSent(schedule, res, err)
+	}
+}
+
+// scheduleQueue is a heap of schedules ordered by SendAt, then by CreatedAt.
+type scheduleQueue []*Schedule
+
+func (q scheduleQueue) Len() int { return len(q) }
+
+func (q scheduleQueue) Less(i, j int) bool {
+	if !q[i].SendAt.Equal(q[j].SendAt) {
+		return q[i].SendAt.Before(q[j].SendAt)
+	}
+	return q[i].CreatedAt.Before(q[j].CreatedAt)
+}
+
+func (q scheduleQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *scheduleQueue) Push(x interface{}) { *q = append(*q, x.(*Schedule)) }
+
+func (q *scheduleQueue) Pop() interface{} {
+	old := *q
+	schedule := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return schedule
+}
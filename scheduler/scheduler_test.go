@@ -0,0 +1,335 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+)
+
+// testClock is a Clock whose time only moves when advanced.
+type testClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*testTimer
+}
+
+type testTimer struct {
+	clock *testClock
+	at    time.Time
+	c     chan time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &testTimer{clock: c, at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the time forward by d and fires the timers due.
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.timers = timers
+}
+
+// waiting returns the number of timers not fired yet.
+func (c *testClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (t *testTimer) C() <-chan time.Time { return t.c }
+
+func (t *testTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type testSender struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (s *testSender) SendContext(ctx context.Context, msg *fcm.MessagePayload) (*fcm.SendResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.Message.Token == "stale" {
+		return nil, &fcm.FCMError{StatusCode: 404, Code: fcm.ErrorCodeUnregistered}
+	}
+	s.sent = append(s.sent, msg.Message.Token)
+	return &fcm.SendResponse{Name: "projects/p/messages/" + msg.Message.Token}, nil
+}
+
+func (s *testSender) sentTokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent := append([]string(nil), s.sent...)
+	sort.Strings(sent)
+	return sent
+}
+
+func testPayload(token string) *fcm.MessagePayload {
+	return &fcm.MessagePayload{Message: fcm.Message{Token: token, Data: map[string]string{"k": "v"}}}
+}
+
+// waitFor polls condition until it holds or the test times out.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the scheduler")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	sender := &testSender{}
+	var mu sync.Mutex
+	results := make(map[string]error)
+	scheduler := New(NewMemoryStore(), sender, Options{
+		Clock: clock,
+		OnSent: func(schedule *Schedule, res *fcm.SendResponse, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			results[schedule.Payload.Message.Token] = err
+		},
+	})
+	if err := scheduler.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer scheduler.Shutdown(context.Background())
+
+	ctx := context.Background()
+	if _, err := scheduler.SendAt(ctx, clock.Now().Add(-time.Minute), testPayload("past")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, func() bool { return len(sender.sentTokens()) == 1 })
+
+	if _, err := scheduler.SendAfter(ctx, time.Hour, testPayload("later")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := scheduler.SendAfter(ctx, 30*time.Minute, testPayload("stale")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cancelled, err := scheduler.SendAt(ctx, clock.Now().Add(time.Minute), testPayload("cancelled"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := scheduler.Cancel(ctx, cancelled); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := scheduler.Cancel(ctx, cancelled); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := scheduler.SendAfter(ctx, time.Minute, &fcm.MessagePayload{}); err == nil {
+		t.Error("expected error for an invalid message, got nil")
+	}
+	if _, err := scheduler.SendAtLocal(ctx, 9, 0, "Asia/Tokyo", nil); err == nil {
+		t.Error("expected error for a nil payload, got nil")
+	}
+
+	waitFor(t, func() bool { return clock.waiting() == 1 })
+	clock.Advance(59 * time.Minute)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return results["stale"] != nil
+	})
+	if sent := sender.sentTokens(); len(sent) != 1 {
+		t.Errorf("expected the later message to wait, got %v sent", sent)
+	}
+
+	waitFor(t, func() bool { return clock.waiting() == 1 })
+	clock.Advance(time.Minute)
+	waitFor(t, func() bool { return len(sender.sentTokens()) == 2 })
+	if sent := sender.sentTokens(); sent[0] != "later" || sent[1] != "past" {
+		t.Errorf("expected the past and later messages to be sent, got %v", sent)
+	}
+}
+
+func TestScheduler_Restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.log")
+	clock := &testClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Messages scheduled by a process that stops before sending them.
+	stopped := New(store, &testSender{}, Options{Clock: clock})
+	ctx := context.Background()
+	for token, delay := range map[string]time.Duration{"missed": time.Minute, "pending": time.Hour} {
+		if _, err := stopped.SendAfter(ctx, delay, testPayload(token)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	store.Close()
+
+	clock.Advance(10 * time.Minute)
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer store.Close()
+	sender := &testSender{}
+	scheduler := New(store, sender, Options{Clock: clock})
+	if err := scheduler.Start(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, func() bool { return len(sender.sentTokens()) == 1 })
+
+	waitFor(t, func() bool { return clock.waiting() == 1 })
+	clock.Advance(50 * time.Minute)
+	waitFor(t, func() bool { return len(sender.sentTokens()) == 2 })
+	if err := scheduler.Shutdown(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if schedules, _ := store.List(ctx); len(schedules) != 0 {
+		t.Errorf("expected the sent schedules to be deleted, got %d", len(schedules))
+	}
+	if _, err := scheduler.SendAfter(ctx, time.Minute, testPayload("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestScheduler_CancelBeforeStart(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	// Messages scheduled by a process that stopped before sending them.
+	stopped := New(store, &testSender{}, Options{Clock: clock})
+	cancelled, err := stopped.SendAfter(ctx, time.Minute, testPayload("cancelled"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := stopped.SendAfter(ctx, time.Minute, testPayload("kept")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sender := &testSender{}
+	scheduler := New(store, sender, Options{Clock: clock})
+	if err := scheduler.Cancel(ctx, cancelled); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := scheduler.Cancel(ctx, cancelled); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := scheduler.Start(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer scheduler.Shutdown(ctx)
+
+	waitFor(t, func() bool { return clock.waiting() == 1 })
+	clock.Advance(time.Minute)
+	waitFor(t, func() bool { return len(sender.sentTokens()) == 1 })
+	if sent := sender.sentTokens(); sent[0] != "kept" {
+		t.Errorf("expected the cancelled message not to be sent, got %v", sent)
+	}
+}
+
+func TestScheduler_SendAtLocal(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	scheduler := New(store, &testSender{}, Options{Clock: clock})
+	ctx := context.Background()
+
+	testCases := []struct {
+		name       string
+		hour       int
+		minute     int
+		timezone   string
+		expected   time.Time
+		expectsErr bool
+	}{
+		{name: "later today", hour: 9, timezone: "America/New_York", expected: time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC)},
+		{name: "tomorrow", hour: 9, timezone: "Asia/Tokyo", expected: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "half hour offset", hour: 18, minute: 30, timezone: "Asia/Kolkata", expected: time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC)},
+		{name: "unknown time zone", hour: 9, timezone: "Mars/Olympus", expectsErr: true},
+		{name: "invalid time", hour: 24, timezone: "UTC", expectsErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := scheduler.SendAtLocal(ctx, tc.hour, tc.minute, tc.timezone, testPayload("token"))
+			if tc.expectsErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			schedules, _ := store.List(ctx)
+			for _, schedule := range schedules {
+				if schedule.ID != id {
+					continue
+				}
+				if !schedule.SendAt.Equal(tc.expected) || schedule.TimeZone != tc.timezone {
+					t.Errorf("expected %v in %s, got %v in %s", tc.expected, tc.timezone, schedule.SendAt.UTC(), schedule.TimeZone)
+				}
+				return
+			}
+			t.Errorf("expected schedule %s to be stored", id)
+		})
+	}
+}
+
+func TestNextLocalTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		now      time.Time
+		expected time.Time
+	}{
+		{name: "before", now: time.Date(2024, 3, 30, 8, 59, 0, 0, paris), expected: time.Date(2024, 3, 30, 9, 0, 0, 0, paris)},
+		{name: "exactly", now: time.Date(2024, 3, 30, 9, 0, 0, 0, paris), expected: time.Date(2024, 3, 31, 9, 0, 0, 0, paris)},
+		{name: "across daylight saving time", now: time.Date(2024, 3, 30, 10, 0, 0, 0, paris), expected: time.Date(2024, 3, 31, 7, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := nextLocalTime(tc.now, 9, 0, paris); !actual.Equal(tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
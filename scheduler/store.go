@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	fcm "github.com/patrickkabwe/go-fcm"
+	"github.com/patrickkabwe/go-fcm/internal/jsonlog"
+)
+
+// Schedule is a message scheduled to be sent at a given time.
+type Schedule struct {
+	// ID identifies the schedule, for example to cancel it.
+	ID string `json:"id"`
+	// Payload is the message to send.
+	Payload *fcm.MessagePayload `json:"payload"`
+	// SendAt is when the message is sent.
+	SendAt time.Time `json:"send_at"`
+	// TimeZone is the time zone of the recipient the time was chosen in, for schedules
+	// created by SendAtLocal.
+	TimeZone string `json:"time_zone,omitempty"`
+	// CreatedAt is when the message was scheduled.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store persists the pending schedules of a Scheduler. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put adds the schedule to the store. The schedule must be durable once Put returns.
+	Put(ctx context.Context, schedule *Schedule) error
+	// Delete removes the schedule with the given ID. Deleting a missing schedule is not an error.
+	Delete(ctx context.Context, id string) error
+	// List returns every schedule of the store, ordered by SendAt.
+	List(ctx context.Context) ([]*Schedule, error)
+}
+
+// MemoryStore is a Store keeping its schedules in memory. It does not survive restarts.
+type MemoryStore struct {
+	mu        sync.Mutex
+	schedules map[string]Schedule
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{schedules: make(map[string]Schedule)}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(ctx context.Context, schedule *Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[schedule.ID] = *schedule
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.schedules, id)
+	return nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List(ctx context.Context) ([]*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := make([]*Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedule := schedule
+		schedules = append(schedules, &schedule)
+	}
+	sortSchedules(schedules)
+	return schedules, nil
+}
+
+// FileStore is a Store backed by an append-only log file. Every change is appended to the log as a
+// JSON line and synced to disk before it returns. The log is replayed when the store is opened, and
+// rewritten without the superseded records once they outnumber the pending schedules.
+type FileStore struct {
+	log *jsonlog.Log
+}
+
+// OpenFileStore opens the FileStore logged to path, creating the file if it does not exist.
+// A truncated last record, left by a crash during a write, is discarded.
+func OpenFileStore(path string) (*FileStore, error) {
+	log, err := jsonlog.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: %w", err)
+	}
+	return &FileStore{log: log}, nil
+}
+
+// Put implements Store.
+func (s *FileStore) Put(ctx context.Context, schedule *Schedule) error {
+	return s.log.Put(schedule.ID, schedule)
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.log.Delete(id)
+}
+
+// List implements Store.
+func (s *FileStore) List(ctx context.Context) ([]*Schedule, error) {
+	values := s.log.Values()
+	schedules := make([]*Schedule, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal(value, &schedules[i]); err != nil {
+			return nil, fmt.Errorf("scheduler: decoding schedule: %w", err)
+		}
+	}
+	sortSchedules(schedules)
+	return schedules, nil
+}
+
+// Close closes the log file.
+func (s *FileStore) Close() error {
+	return s.log.Close()
+}
+
+// sortSchedules orders schedules by SendAt, then by ID.
+func sortSchedules(schedules []*Schedule) {
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].SendAt.Equal(schedules[j].SendAt) {
+			return schedules[i].SendAt.Before(schedules[j].SendAt)
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+}
@@ -0,0 +1,175 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// TokenRegistry keeps the registration tokens of the devices of each owner, such as a user of the app.
+// Implementations must be safe for concurrent use.
+type TokenRegistry interface {
+	// Register adds token to the tokens of owner. A token belongs to a single owner: registering
+	// it again for another owner moves it.
+	Register(ctx context.Context, owner, token string) error
+	// Unregister removes token. Unregistering an unknown token is not an error.
+	Unregister(ctx context.Context, token string) error
+	// Tokens returns the tokens of owner, in the order they were registered.
+	Tokens(ctx context.Context, owner string) ([]string, error)
+}
+
+// OnInvalidToken registers fn to be called with every registration token FCM reports as no longer
+// valid, so that it can be deleted: when a send to the token fails with UNREGISTERED, or with
+// INVALID_ARGUMENT about the token, and when a token fails to be subscribed to or unsubscribed from
+// a topic because it is unknown or invalid. The reason is ErrorCodeUnregistered or
+// ErrorCodeInvalidArgument. fn is called before the send returns, so it must not block for long.
+// It is not safe to call OnInvalidToken concurrently with sending messages.
+func (f *FCMClient) OnInvalidToken(fn func(token string, reason ErrorCode)) *FCMClient {
+	f.invalidToken = append(f.invalidToken, fn)
+	return f
+}
+
+// SetTokenRegistry sets the registry the invalid tokens are unregistered from, see OnInvalidToken.
+// Failing to unregister a token is logged and does not fail the send.
+// It is not safe to call SetTokenRegistry concurrently with sending messages.
+func (f *FCMClient) SetTokenRegistry(registry TokenRegistry) *FCMClient {
+	f.tokenRegistry = registry
+	return f
+}
+
+// InvalidTokenReason reports whether err, returned by a send to a single registration token, means
+// that the token is no longer valid and should be deleted, and returns the error code saying why.
+// Only the errors of FCM saying so are reported: UNREGISTERED read from the FcmError details of the
+// response, or INVALID_ARGUMENT with a violation of the message.token field. A code derived from the
+// HTTP status alone, such as a 404 response of a proxy, is not enough.
+func InvalidTokenReason(err error) (ErrorCode, bool) {
+	var fcmErr *FCMError
+	if !errors.As(err, &fcmErr) {
+		return "", false
+	}
+	switch fcmErr.Code {
+	case ErrorCodeUnregistered:
+		return fcmErr.Code, !fcmErr.CodeFromStatus
+	case ErrorCodeInvalidArgument:
+		for _, violation := range fcmErr.FieldViolations {
+			if violation.Field == "message.token" {
+				return fcmErr.Code, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkInvalidToken reports token as invalid if the send to it failed with err because of it.
+func (f *FCMClient) checkInvalidToken(ctx context.Context, token string, err error) {
+	if token == "" {
+		return
+	}
+	if reason, ok := InvalidTokenReason(err); ok {
+		f.invalidateToken(ctx, token, reason)
+	}
+}
+
+// invalidateToken unregisters the invalid token from the registry of the client and calls the
+// OnInvalidToken callbacks.
+func (f *FCMClient) invalidateToken(ctx context.Context, token string, reason ErrorCode) {
+	if f.tokenRegistry != nil {
+		if err := f.tokenRegistry.Unregister(ctx, token); err != nil {
+			f.log().LogAttrs(ctx, slog.LevelWarn, "fcm: unregistering invalid token failed",
+				slog.String("token", RedactToken(token)), slog.String("error", err.Error()))
+		}
+	}
+	for _, fn := range f.invalidToken {
+		fn(token, reason)
+	}
+}
+
+// deviceToken returns the registration token the message is sent to, or an empty string if it is
+// not sent to a single device.
+func (m Message) deviceToken() string {
+	if m.Token != "" {
+		return m.Token
+	}
+	if len(m.Tokens) == 1 {
+		return m.Tokens[0]
+	}
+	return ""
+}
+
+// rawToken returns the registration token a raw request body is sent to, or an empty string if it
+// is not sent to a single device.
+func rawToken(body []byte) string {
+	var request struct {
+		Message Message `json:"message"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return ""
+	}
+	return request.Message.deviceToken()
+}
+
+// MemoryTokenRegistry is a TokenRegistry keeping the tokens in memory. It does not survive restarts.
+type MemoryTokenRegistry struct {
+	mu     sync.Mutex
+	tokens map[string][]string
+	owners map[string]string
+}
+
+// NewMemoryTokenRegistry returns an empty MemoryTokenRegistry.
+func NewMemoryTokenRegistry() *MemoryTokenRegistry {
+	return &MemoryTokenRegistry{
+		tokens: make(map[string][]string),
+		owners: make(map[string]string),
+	}
+}
+
+// Register implements TokenRegistry.
+func (r *MemoryTokenRegistry) Register(ctx context.Context, owner, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, ok := r.owners[token]; ok {
+		if current == owner {
+			return nil
+		}
+		r.remove(current, token)
+	}
+	r.owners[token] = owner
+	r.tokens[owner] = append(r.tokens[owner], token)
+	return nil
+}
+
+// Unregister implements TokenRegistry.
+func (r *MemoryTokenRegistry) Unregister(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if owner, ok := r.owners[token]; ok {
+		delete(r.owners, token)
+		r.remove(owner, token)
+	}
+	return nil
+}
+
+// Tokens implements TokenRegistry.
+func (r *MemoryTokenRegistry) Tokens(ctx context.Context, owner string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.tokens[owner]...), nil
+}
+
+// remove removes token from the tokens of owner.
+func (r *MemoryTokenRegistry) remove(owner, token string) {
+	tokens := r.tokens[owner]
+	for i, t := range tokens {
+		if t == token {
+			tokens = append(tokens[:i:i], tokens[i+1:]...)
+			break
+		}
+	}
+	if len(tokens) == 0 {
+		delete(r.tokens, owner)
+		return
+	}
+	r.tokens[owner] = tokens
+}
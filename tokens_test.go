@@ -0,0 +1,176 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInvalidTokenReason(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected ErrorCode
+		ok       bool
+	}{
+		{name: "unregistered", err: &FCMError{StatusCode: 404, Code: ErrorCodeUnregistered}, expected: ErrorCodeUnregistered, ok: true},
+		{name: "wrapped", err: fmt.Errorf("sending: %w", &FCMError{Code: ErrorCodeUnregistered}), expected: ErrorCodeUnregistered, ok: true},
+		{
+			name:     "invalid token field",
+			err:      &FCMError{Code: ErrorCodeInvalidArgument, FieldViolations: []FieldViolation{{Field: "message.token"}}},
+			expected: ErrorCodeInvalidArgument,
+			ok:       true,
+		},
+		{
+			name: "unregistered from status",
+			err:  &FCMError{StatusCode: 404, Code: ErrorCodeUnregistered, CodeFromStatus: true},
+		},
+		{
+			name: "invalid token message",
+			err:  &FCMError{Code: ErrorCodeInvalidArgument, Message: "The registration token is not a valid FCM registration token"},
+		},
+		{
+			name: "other invalid field",
+			err:  &FCMError{Code: ErrorCodeInvalidArgument, FieldViolations: []FieldViolation{{Field: "message.data[0].value"}}},
+		},
+		{name: "unavailable", err: &FCMError{StatusCode: 503, Code: ErrorCodeUnavailable}},
+		{name: "other error", err: fmt.Errorf("network error")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, ok := InvalidTokenReason(tc.err)
+			if ok != tc.ok || (ok && reason != tc.expected) {
+				t.Errorf("expected %s, %v, got %s, %v", tc.expected, tc.ok, reason, ok)
+			}
+		})
+	}
+}
+
+// newTestInvalidTokenClient returns a client failing the sends to the tokens dead and invalid, and
+// recording the tokens reported as invalid.
+func newTestInvalidTokenClient(registry TokenRegistry, invalid map[string]ErrorCode) *FCMClient {
+	return NewClient().
+		SetCredentialFile(testServiceAccountFile).
+		SetHTTPClient(&testHttpClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if !strings.HasSuffix(req.URL.Path, "messages:send") {
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+				}
+				body, _ := io.ReadAll(req.Body)
+				switch {
+				case strings.Contains(string(body), `"dead"`):
+					return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader(
+						`{"error":{"status":"NOT_FOUND","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`))}, nil
+				case strings.Contains(string(body), `"invalid"`):
+					return &http.Response{StatusCode: 400, Body: io.NopCloser(strings.NewReader(
+						`{"error":{"status":"INVALID_ARGUMENT","message":"The registration token is not a valid FCM registration token",` +
+							`"details":[{"@type":"type.googleapis.com/google.rpc.BadRequest","fieldViolations":[{"field":"message.token"}]}]}}`))}, nil
+				case strings.Contains(string(body), `"news"`), strings.Contains(string(body), `"proxied"`):
+					return &http.Response{StatusCode: 404, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+				}
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"name":"projects/p/messages/1"}`))}, nil
+			},
+		}).
+		SetTokenRegistry(registry).
+		OnInvalidToken(func(token string, reason ErrorCode) { invalid[token] = reason })
+}
+
+func TestOnInvalidToken(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryTokenRegistry()
+	for _, token := range []string{"dead", "alive", "invalid", "proxied"} {
+		registry.Register(ctx, "user-1", token)
+	}
+	invalid := make(map[string]ErrorCode)
+	client := newTestInvalidTokenClient(registry, invalid)
+
+	client.SendContext(ctx, &MessagePayload{Message: Message{Token: "dead"}})
+	client.SendContext(ctx, &MessagePayload{Message: Message{Token: "alive"}})
+	client.SendContext(ctx, &MessagePayload{Message: Message{Token: "proxied"}})
+	client.SendContext(ctx, &MessagePayload{Message: Message{Topic: "news"}})
+	client.SendRaw(ctx, []byte(`{"message":{"token":"invalid"}}`))
+
+	expected := map[string]ErrorCode{"dead": ErrorCodeUnregistered, "invalid": ErrorCodeInvalidArgument}
+	if !reflect.DeepEqual(invalid, expected) {
+		t.Errorf("expected %v, got %v", expected, invalid)
+	}
+	if tokens, _ := registry.Tokens(ctx, "user-1"); !reflect.DeepEqual(tokens, []string{"alive", "proxied"}) {
+		t.Errorf("expected the invalid tokens to be unregistered, got %v", tokens)
+	}
+}
+
+func TestOnInvalidToken_MultipleTokens(t *testing.T) {
+	testCases := []struct {
+		name string
+		send func(client *FCMClient, msg *MessagePayload) error
+	}{
+		{name: "multicast", send: (*FCMClient).SendToMultiple},
+		{name: "batch", send: (*FCMClient).SendAll},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			registry := NewMemoryTokenRegistry()
+			for _, token := range []string{"dead", "alive", "invalid"} {
+				registry.Register(ctx, "user-1", token)
+			}
+			invalid := make(map[string]ErrorCode)
+			client := newTestInvalidTokenClient(registry, invalid)
+
+			err := tc.send(client, &MessagePayload{Message: Message{Tokens: []string{"dead", "alive", "invalid"}}})
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+			expected := map[string]ErrorCode{"dead": ErrorCodeUnregistered, "invalid": ErrorCodeInvalidArgument}
+			if !reflect.DeepEqual(invalid, expected) {
+				t.Errorf("expected %v, got %v", expected, invalid)
+			}
+			if tokens, _ := registry.Tokens(ctx, "user-1"); !reflect.DeepEqual(tokens, []string{"alive"}) {
+				t.Errorf("expected the invalid tokens to be unregistered, got %v", tokens)
+			}
+		})
+	}
+}
+
+func TestOnInvalidToken_TopicManagement(t *testing.T) {
+	invalid := make(map[string]ErrorCode)
+	client := newTestIIDClient(t, 200, `{"results":[{},{"error":"NOT_FOUND"},{"error":"INVALID_ARGUMENT"},{"error":"INTERNAL"}]}`, nil).
+		OnInvalidToken(func(token string, reason ErrorCode) { invalid[token] = reason })
+
+	if _, err := client.SubscribeToTopic(context.Background(), "news", []string{"a", "b", "c", "d"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := map[string]ErrorCode{"b": ErrorCodeUnregistered, "c": ErrorCodeInvalidArgument}
+	if !reflect.DeepEqual(invalid, expected) {
+		t.Errorf("expected %v, got %v", expected, invalid)
+	}
+}
+
+func TestMemoryTokenRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryTokenRegistry()
+	registry.Register(ctx, "user-1", "a")
+	registry.Register(ctx, "user-1", "b")
+	registry.Register(ctx, "user-1", "a")
+	registry.Register(ctx, "user-2", "c")
+	registry.Register(ctx, "user-2", "b")
+
+	if tokens, _ := registry.Tokens(ctx, "user-1"); !reflect.DeepEqual(tokens, []string{"a"}) {
+		t.Errorf("expected [a], got %v", tokens)
+	}
+	if tokens, _ := registry.Tokens(ctx, "user-2"); !reflect.DeepEqual(tokens, []string{"c", "b"}) {
+		t.Errorf("expected [c b], got %v", tokens)
+	}
+
+	registry.Unregister(ctx, "a")
+	registry.Unregister(ctx, "unknown")
+	if tokens, _ := registry.Tokens(ctx, "user-1"); len(tokens) != 0 {
+		t.Errorf("expected no tokens, got %v", tokens)
+	}
+}
@@ -0,0 +1,97 @@
+package fcm
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// Names of the spans started by the FCM client.
+const (
+	SpanSend        = "fcm.send"
+	SpanTokenFetch  = "fcm.token_fetch"
+	SpanHTTPAttempt = "fcm.http_attempt"
+)
+
+// Attribute keys of the spans started by the FCM client.
+const (
+	AttributeTargetType     = "fcm.target_type"
+	AttributeProjectID      = "fcm.project_id"
+	AttributeMessageID      = "fcm.message_id"
+	AttributeErrorCode      = "fcm.error_code"
+	AttributeAttempt        = "fcm.attempt"
+	AttributeHTTPMethod     = "http.request.method"
+	AttributeHTTPURL        = "url.full"
+	AttributeHTTPStatusCode = "http.response.status_code"
+)
+
+// Tracer starts the spans of the requests made by the FCM client. See the otelfcm
+// package for an implementation backed by OpenTelemetry.
+type Tracer interface {
+	// Start starts a span with the given name and attributes as a child of the span in ctx,
+	// and returns a context holding the new span.
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is a unit of work started by a Tracer.
+type Span interface {
+	// SetAttributes sets attributes on the span.
+	SetAttributes(attrs ...slog.Attr)
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	// TraceParent returns the W3C traceparent header identifying the span,
+	// or an empty string if the span is not recording or sampled out.
+	TraceParent() string
+	// End completes the span.
+	End()
+}
+
+// SetTracer sets the tracer of the FCM client. By default no spans are started.
+//
+// The client starts a span for every send, with a child span for the access token fetch
+// and for each HTTP attempt. Outgoing requests carry the traceparent header of their span.
+func (f *FCMClient) SetTracer(tracer Tracer) *FCMClient {
+	f.tracer = tracer
+	return f
+}
+
+// startSpan starts a span with the tracer of the client, or a span doing nothing if none is set.
+// The span is stored in the returned context, so that the HTTP requests made with it carry its traceparent.
+func (f *FCMClient) startSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	if f.tracer == nil {
+		return ctx, nopSpan{}
+	}
+	ctx, span := f.tracer.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// injectTraceParent sets the traceparent header of req to the one of the span in its context, if any.
+func injectTraceParent(req *http.Request) {
+	span, ok := req.Context().Value(spanContextKey{}).(Span)
+	if !ok {
+		return
+	}
+	if traceParent := span.TraceParent(); traceParent != "" {
+		req.Header.Set("traceparent", traceParent)
+	}
+}
+
+// endSpan records the outcome of a request on span and ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		if code := ErrorCodeOf(err); code != "" {
+			span.SetAttributes(slog.String(AttributeErrorCode, string(code)))
+		}
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type spanContextKey struct{}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...slog.Attr) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) TraceParent() string        { return "" }
+func (nopSpan) End()                       {}
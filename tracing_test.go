@@ -0,0 +1,143 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]string
+	err    error
+	ended  bool
+	id     int
+}
+
+type testSpanKey struct{}
+
+func (tr *testTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attrs: map[string]string{}, id: len(tr.spans) + 1}
+	span.SetAttributes(attrs...)
+	tr.spans = append(tr.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (s *testSpan) SetAttributes(attrs ...slog.Attr) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value.String()
+	}
+}
+
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  { s.ended = true }
+
+func (s *testSpan) TraceParent() string {
+	return fmt.Sprintf("00-0af7651916cd43dd8448eb211c80319c-%016x-01", s.id)
+}
+
+func TestSetTracer(t *testing.T) {
+	testCases := []struct {
+		name              string
+		statuses          []int
+		expectedSpans     []string
+		expectedErrorCode string
+	}{
+		{
+			name:          "success",
+			statuses:      []int{200},
+			expectedSpans: []string{"fcm.send", "fcm.token_fetch", "fcm.http_attempt"},
+		},
+		{
+			name:              "retried failure",
+			statuses:          []int{503, 404},
+			expectedSpans:     []string{"fcm.send", "fcm.token_fetch", "fcm.http_attempt", "fcm.http_attempt"},
+			expectedErrorCode: "UNREGISTERED",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer := &testTracer{}
+			var traceParents []string
+			attempts := 0
+			client := NewClient().
+				SetCredentialFile(testServiceAccountFile).
+				SetTracer(tracer).
+				SetMaxRetries(1).
+				SetHTTPClient(&testHttpClient{
+					TokenFunc: func(req *http.Request) (*http.Response, error) {
+						traceParents = append(traceParents, req.Header.Get("traceparent"))
+						return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"access_token":"test"}`))}, nil
+					},
+					DoFunc: func(req *http.Request) (*http.Response, error) {
+						traceParents = append(traceParents, req.Header.Get("traceparent"))
+						status := 200
+						if strings.HasSuffix(req.URL.Path, "messages:send") {
+							status = tc.statuses[attempts]
+							attempts++
+						}
+						return &http.Response{
+							StatusCode: status,
+							Body:       io.NopCloser(strings.NewReader(`{"name":"projects/project_id/messages/1"}`)),
+						}, nil
+					},
+				})
+			client.retryBackoff = 1
+
+			_ = client.Send(&MessagePayload{Message: Message{Topic: "news"}})
+
+			var names []string
+			for _, span := range tracer.spans {
+				names = append(names, span.name)
+				if !span.ended {
+					t.Errorf("expected span %s to be ended", span.name)
+				}
+				if span.name != SpanSend && span.parent != tracer.spans[0] {
+					t.Errorf("expected span %s to be a child of the send span", span.name)
+				}
+			}
+			if strings.Join(names, ",") != strings.Join(tc.expectedSpans, ",") {
+				t.Fatalf("expected spans %v, got %v", tc.expectedSpans, names)
+			}
+
+			for i, traceParent := range traceParents {
+				if expected := tracer.spans[i+1].TraceParent(); traceParent != expected {
+					t.Errorf("expected request %d to carry traceparent %s, got %q", i, expected, traceParent)
+				}
+			}
+
+			send := tracer.spans[0]
+			if send.attrs[AttributeTargetType] != TargetTopic || send.attrs[AttributeProjectID] != "project_id" {
+				t.Errorf("expected target type and project ID attributes, got %v", send.attrs)
+			}
+			if tc.expectedErrorCode == "" {
+				if send.attrs[AttributeMessageID] != "1" || send.err != nil {
+					t.Errorf("expected message ID and no error, got %v and %v", send.attrs, send.err)
+				}
+				return
+			}
+			if send.attrs[AttributeErrorCode] != tc.expectedErrorCode || send.err == nil {
+				t.Errorf("expected error code %s and recorded error, got %v and %v", tc.expectedErrorCode, send.attrs, send.err)
+			}
+			last := tracer.spans[len(tracer.spans)-1]
+			if last.attrs[AttributeHTTPStatusCode] != "404" || last.attrs[AttributeAttempt] != "2" {
+				t.Errorf("expected last attempt attributes, got %v", last.attrs)
+			}
+		})
+	}
+}
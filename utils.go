@@ -1,6 +1,10 @@
 package fcm
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -25,3 +29,32 @@ func generateGoogleJWT(serviceAccount *Credentials) (string, error) {
 
 	return token.SignedString(rsaPrivateKey)
 }
+
+// appendJSONFields appends the fields to the encoded JSON object data, ordered by key.
+// The values are written as is, so their numbers and key order are preserved.
+func appendJSONFields(data []byte, fields map[string]json.RawMessage) ([]byte, error) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for _, key := range keys {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		if err := json.Compact(&buf, fields[key]); err != nil {
+			return nil, fmt.Errorf("fcm: encoding field %q: %w", key, err)
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
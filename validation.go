@@ -0,0 +1,208 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxPayloadSize is the largest notification and data payload FCM accepts, in bytes.
+const MaxPayloadSize = 4096
+
+const (
+	// maxAPNSPayloadSize is the largest payload APNs accepts for regular notifications, in bytes.
+	maxAPNSPayloadSize = 4096
+	// maxAPNSVoIPPayloadSize is the largest payload APNs accepts for VoIP notifications, in bytes.
+	maxAPNSVoIPPayloadSize = 5120
+	// maxWebpushTTL is the longest TTL FCM accepts for Web Push messages.
+	maxWebpushTTL = 28 * 24 * time.Hour
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// reservedDataKeys are the data keys FCM rejects because it uses them internally.
+var reservedDataKeys = map[string]bool{
+	"from":         true,
+	"notification": true,
+	"message_type": true,
+}
+
+// reservedDataPrefixes are the data key prefixes FCM rejects because it uses them internally.
+var reservedDataPrefixes = []string{"google.", "gcm."}
+
+// ValidationError describes a single rule violated by a message.
+type ValidationError struct {
+	// Field is the path of the offending field, e.g. "message.android.ttl".
+	Field string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is returned by Message.Validate and holds every rule violated by the message.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the individual violations so they can be inspected with errors.Is and errors.As.
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Validate checks the message against the rules enforced by the FCM v1 API,
+// so that invalid messages can be rejected before they are sent.
+// It returns nil or a ValidationErrors listing every violation found.
+func (m *Message) Validate() error {
+	var errs ValidationErrors
+	add := func(field string, err error) {
+		errs = append(errs, &ValidationError{Field: field, Err: err})
+	}
+
+	targets := 0
+	for _, target := range []string{m.Token, m.Topic, m.Condition} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		add("message", fmt.Errorf("exactly one of token, topic or condition is required, got %d", targets))
+	}
+	if len(m.Tokens) > 0 {
+		add("message.tokens", fmt.Errorf("tokens is not supported by the FCM v1 API, send one message per token instead"))
+	}
+
+	validateData("message.data", m.Data, add)
+	if m.Notification != nil {
+		validateNotification("message.notification", m.Notification, add)
+	}
+
+	if m.FcmOptions != nil {
+		if err := m.FcmOptions.Validate(); err != nil {
+			add("message.fcm_options", err)
+		}
+	}
+
+	size, err := payloadSize(m)
+	if err != nil {
+		add("message", err)
+	} else if size > MaxPayloadSize {
+		add("message", fmt.Errorf("notification and data payload is %d bytes, the limit is %d bytes", size, MaxPayloadSize))
+	}
+
+	if m.Android != nil {
+		if err := m.Android.Validate(); err != nil {
+			add("message.android", err)
+		}
+		validateData("message.android.data", m.Android.Data, add)
+		if m.Android.Notification != nil {
+			validateNotification("message.android.notification", m.Android.Notification, add)
+		}
+	}
+
+	if m.APNS != nil {
+		if err := m.APNS.Validate(); err != nil {
+			add("message.apns", err)
+		}
+		if m.APNS.Payload != nil {
+			limit := maxAPNSPayloadSize
+			if m.APNS.PushType == APNSPushTypeVoIP {
+				limit = maxAPNSVoIPPayloadSize
+			}
+			data, err := json.Marshal(m.APNS.Payload)
+			if err != nil {
+				add("message.apns.payload", err)
+			} else if len(data) > limit {
+				add("message.apns.payload", fmt.Errorf("payload is %d bytes, the limit is %d bytes", len(data), limit))
+			}
+		}
+	}
+
+	if m.Webpush != nil {
+		if err := m.Webpush.Validate(); err != nil {
+			add("message.webpush", err)
+		}
+		if m.Webpush.TTL != nil && *m.Webpush.TTL > maxWebpushTTL {
+			add("message.webpush.ttl", fmt.Errorf("ttl must not be longer than 28 days"))
+		}
+		validateData("message.webpush.data", m.Webpush.Data, add)
+		if n := m.Webpush.Notification; n != nil {
+			validateHTTPSURL("message.webpush.notification.image", n.Image, add)
+			validateHTTPSURL("message.webpush.notification.icon", n.Icon, add)
+			validateHTTPSURL("message.webpush.notification.badge", n.Badge, add)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// payloadSize returns the size of the serialized notification and data sections of the message.
+func payloadSize(m *Message) (int, error) {
+	data, err := json.Marshal(struct {
+		Notification *Notification     `json:"notification,omitempty"`
+		Data         map[string]string `json:"data,omitempty"`
+	}{m.Notification, m.Data})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func validateData(field string, data map[string]string, add func(string, error)) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if reservedDataKeys[key] {
+			add(field, fmt.Errorf("key %q is reserved", key))
+			continue
+		}
+		for _, prefix := range reservedDataPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				add(field, fmt.Errorf("key %q uses the reserved prefix %q", key, prefix))
+			}
+		}
+	}
+}
+
+func validateNotification(field string, n *Notification, add func(string, error)) {
+	if n.Color != "" && !colorPattern.MatchString(n.Color) {
+		add(field+".color", fmt.Errorf("color must be in the #rrggbb format, got %q", n.Color))
+	}
+	validateHTTPSURL(field+".image", n.Image, add)
+}
+
+func validateHTTPSURL(field, value string, add func(string, error)) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		add(field, fmt.Errorf("%q is not an HTTPS URL", value))
+	}
+}
@@ -0,0 +1,143 @@
+package fcm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage_Validate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		message        Message
+		expectedFields []string
+	}{
+		{
+			name:    "valid token message",
+			message: Message{Token: "token", Notification: &Notification{Title: "Hello"}},
+		},
+		{
+			name:           "without target",
+			message:        Message{},
+			expectedFields: []string{"message"},
+		},
+		{
+			name:           "with token and topic",
+			message:        Message{Token: "token", Topic: "news"},
+			expectedFields: []string{"message"},
+		},
+		{
+			name:           "with tokens",
+			message:        Message{Token: "token", Tokens: []string{"a", "b"}},
+			expectedFields: []string{"message.tokens"},
+		},
+		{
+			name: "with reserved data keys",
+			message: Message{
+				Topic: "news",
+				Data:  map[string]string{"from": "x", "google.sent_time": "1", "gcm.n.e": "1", "order_id": "42"},
+			},
+			expectedFields: []string{"message.data", "message.data", "message.data"},
+		},
+		{
+			name: "with reserved android data key",
+			message: Message{
+				Topic:   "news",
+				Android: &AndroidConfig{Data: map[string]string{"message_type": "x"}},
+			},
+			expectedFields: []string{"message.android.data"},
+		},
+		{
+			name: "with payload over the limit",
+			message: Message{
+				Topic: "news",
+				Data:  map[string]string{"blob": strings.Repeat("a", MaxPayloadSize)},
+			},
+			expectedFields: []string{"message"},
+		},
+		{
+			name: "with invalid ttl",
+			message: Message{
+				Topic:   "news",
+				Android: &AndroidConfig{TTL: 29 * 24 * time.Hour},
+				Webpush: &WebpushConfig{TTL: durationPtr(29 * 24 * time.Hour)},
+			},
+			expectedFields: []string{"message.android", "message.webpush.ttl"},
+		},
+		{
+			name: "with invalid colors",
+			message: Message{
+				Topic:        "news",
+				Notification: &Notification{Color: "red"},
+				Android:      &AndroidConfig{Notification: &Notification{Color: "#ff00001"}},
+			},
+			expectedFields: []string{"message.notification.color", "message.android.notification.color"},
+		},
+		{
+			name: "with valid color",
+			message: Message{
+				Topic:   "news",
+				Android: &AndroidConfig{Notification: &Notification{Color: "#FF8800"}},
+			},
+		},
+		{
+			name: "with non https images",
+			message: Message{
+				Topic:        "news",
+				Notification: &Notification{Image: "http://example.com/a.png"},
+				Webpush:      &WebpushConfig{Notification: &WebpushNotification{Icon: "icon.png"}},
+			},
+			expectedFields: []string{"message.notification.image", "message.webpush.notification.icon"},
+		},
+		{
+			name: "with apns payload over the limit",
+			message: Message{
+				Topic: "news",
+				APNS: &APNSConfig{Payload: &APNSPayload{
+					Aps:        &Aps{AlertString: "Hello"},
+					CustomData: map[string]interface{}{"blob": strings.Repeat("a", maxAPNSPayloadSize)},
+				}},
+			},
+			expectedFields: []string{"message.apns.payload"},
+		},
+		{
+			name: "with voip payload under the voip limit",
+			message: Message{
+				Topic: "news",
+				APNS: &APNSConfig{
+					PushType: APNSPushTypeVoIP,
+					Payload: &APNSPayload{
+						Aps:        &Aps{AlertString: "Hello"},
+						CustomData: map[string]interface{}{"blob": strings.Repeat("a", maxAPNSPayloadSize)},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.message.Validate()
+			if len(tc.expectedFields) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			}
+			if len(errs) != len(tc.expectedFields) {
+				t.Fatalf("expected %d violations, got %d: %v", len(tc.expectedFields), len(errs), errs)
+			}
+			for i, field := range tc.expectedFields {
+				if errs[i].Field != field {
+					t.Errorf("expected violation %d on %q, got %q", i, field, errs[i].Field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebpushUrgency is the value of the Urgency header of a Web Push message.
+type WebpushUrgency string
+
+// Urgency values as defined by RFC 8030, from least to most urgent.
+const (
+	WebpushUrgencyVeryLow WebpushUrgency = "very-low"
+	WebpushUrgencyLow     WebpushUrgency = "low"
+	WebpushUrgencyNormal  WebpushUrgency = "normal"
+	WebpushUrgencyHigh    WebpushUrgency = "high"
+)
+
+// WebpushDirection is the text direction of a Web notification.
+type WebpushDirection string
+
+// Text directions supported by the Notification API.
+const (
+	WebpushDirectionAuto        WebpushDirection = "auto"
+	WebpushDirectionLeftToRight WebpushDirection = "ltr"
+	WebpushDirectionRightToLeft WebpushDirection = "rtl"
+)
+
+const (
+	headerWebpushTTL     = "TTL"
+	headerWebpushUrgency = "Urgency"
+)
+
+// WebpushNotificationAction represents an action button shown on a Web notification.
+type WebpushNotificationAction struct {
+	Action string `json:"action,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Icon   string `json:"icon,omitempty"`
+}
+
+// WebpushNotification represents the options of a Web notification, as defined by the
+// Notification API (https://developer.mozilla.org/en-US/docs/Web/API/Notification).
+type WebpushNotification struct {
+	Title              string                      `json:"title,omitempty"`
+	Body               string                      `json:"body,omitempty"`
+	Icon               string                      `json:"icon,omitempty"`
+	Image              string                      `json:"image,omitempty"`
+	Badge              string                      `json:"badge,omitempty"`
+	Tag                string                      `json:"tag,omitempty"`
+	Direction          WebpushDirection            `json:"dir,omitempty"`
+	Language           string                      `json:"lang,omitempty"`
+	Renotify           bool                        `json:"renotify,omitempty"`
+	RequireInteraction bool                        `json:"requireInteraction,omitempty"`
+	Silent             bool                        `json:"silent,omitempty"`
+	Actions            []WebpushNotificationAction `json:"actions,omitempty"`
+	// Timestamp is the time the notification refers to. It is sent in milliseconds since the epoch.
+	Timestamp time.Time `json:"-"`
+	// Vibrate is the vibration pattern, alternating vibration and pause durations in milliseconds.
+	Vibrate []int `json:"vibrate,omitempty"`
+	// Data is arbitrary data made available to the service worker. When decoded, its numbers are
+	// json.Number values, so that large integers are sent back unchanged.
+	Data interface{} `json:"data,omitempty"`
+	// CustomData holds any additional notification options not covered above.
+	CustomData map[string]interface{} `json:"-"`
+}
+
+// webpushNotification is used to marshal WebpushNotification without recursing into its MarshalJSON method.
+type webpushNotification WebpushNotification
+
+// MarshalJSON encodes the notification, merging CustomData into the top level object.
+func (n WebpushNotification) MarshalJSON() ([]byte, error) {
+	type wire struct {
+		webpushNotification
+		Timestamp int64 `json:"timestamp,omitempty"`
+	}
+	w := wire{webpushNotification: webpushNotification(n)}
+	if !n.Timestamp.IsZero() {
+		w.Timestamp = n.Timestamp.UnixMilli()
+	}
+	data, err := json.Marshal(w)
+	if err != nil || len(n.CustomData) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	custom := make(map[string]json.RawMessage, len(n.CustomData))
+	for k, v := range n.CustomData {
+		if _, ok := fields[k]; ok {
+			continue
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		custom[k] = value
+	}
+	return appendJSONFields(data, custom)
+}
+
+// UnmarshalJSON decodes the notification, collecting unknown options into CustomData.
+func (n *WebpushNotification) UnmarshalJSON(data []byte) error {
+	type wire struct {
+		*webpushNotification
+		Timestamp int64 `json:"timestamp,omitempty"`
+	}
+	*n = WebpushNotification{}
+	w := wire{webpushNotification: (*webpushNotification)(n)}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	if w.Timestamp != 0 {
+		n.Timestamp = time.UnixMilli(w.Timestamp)
+	}
+
+	// Numbers are decoded as json.Number so that large integers are sent back unchanged.
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return err
+	}
+	if data, ok := fields["data"]; ok {
+		n.Data = data
+	}
+	for k, v := range fields {
+		if webpushNotificationKeys[k] {
+			continue
+		}
+		if n.CustomData == nil {
+			n.CustomData = make(map[string]interface{})
+		}
+		n.CustomData[k] = v
+	}
+	return nil
+}
+
+// webpushNotificationKeys are the options with a dedicated field on WebpushNotification.
+var webpushNotificationKeys = map[string]bool{
+	"title": true, "body": true, "icon": true, "image": true, "badge": true, "tag": true,
+	"dir": true, "lang": true, "renotify": true, "requireInteraction": true, "silent": true,
+	"actions": true, "timestamp": true, "vibrate": true, "data": true,
+}
+
+// Validate checks that the notification options are well formed.
+func (n *WebpushNotification) Validate() error {
+	switch n.Direction {
+	case "", WebpushDirectionAuto, WebpushDirectionLeftToRight, WebpushDirectionRightToLeft:
+	default:
+		return fmt.Errorf("webpush notification dir must be auto, ltr or rtl, got %q", n.Direction)
+	}
+	if n.Renotify && n.Tag == "" {
+		return fmt.Errorf("webpush notification renotify requires a tag")
+	}
+	if n.Silent && len(n.Vibrate) > 0 {
+		return fmt.Errorf("webpush notification must not set vibrate when silent")
+	}
+	for i, action := range n.Actions {
+		if action.Action == "" || action.Title == "" {
+			return fmt.Errorf("webpush notification action %d requires action and title", i)
+		}
+	}
+	for k := range n.CustomData {
+		if webpushNotificationKeys[k] {
+			return fmt.Errorf("webpush notification custom data must not contain the reserved key %q", k)
+		}
+	}
+	return nil
+}
+
+// WebpushFcmOptions represents the FCM options for Web Push messages.
+type WebpushFcmOptions struct {
+	// Link is the URL opened when the user clicks the notification. It must use HTTPS.
+	Link           string `json:"link,omitempty"`
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+// Validate checks that the options are well formed.
+func (o *WebpushFcmOptions) Validate() error {
+	if err := validateAnalyticsLabel(o.AnalyticsLabel); err != nil {
+		return err
+	}
+	if o.Link == "" {
+		return nil
+	}
+	link, err := url.Parse(o.Link)
+	if err != nil {
+		return fmt.Errorf("webpush fcm_options link is not a valid URL: %w", err)
+	}
+	if link.Scheme != "https" || link.Host == "" {
+		return fmt.Errorf("webpush fcm_options link must be an HTTPS URL")
+	}
+	return nil
+}
+
+// WebpushConfig represents the Web Push specific options for messages sent through FCM.
+type WebpushConfig struct {
+	// TTL is sent as the TTL header: how long the push service retains the message. Nil leaves the
+	// header unset; a pointer to zero asks the push service to deliver the message only if the
+	// device is reachable right away.
+	TTL *time.Duration `json:"-"`
+	// Urgency is sent as the Urgency header.
+	Urgency WebpushUrgency `json:"-"`
+	// Headers holds any additional Web Push headers. The typed fields above take precedence.
+	Headers      map[string]string    `json:"headers,omitempty"`
+	Data         map[string]string    `json:"data,omitempty"`
+	Notification *WebpushNotification `json:"notification,omitempty"`
+	FcmOptions   *WebpushFcmOptions   `json:"fcm_options,omitempty"`
+}
+
+// webpushConfig is used to marshal WebpushConfig without recursing into its MarshalJSON method.
+type webpushConfig WebpushConfig
+
+// MarshalJSON encodes the config, merging the typed header fields into Headers.
+func (c WebpushConfig) MarshalJSON() ([]byte, error) {
+	w := webpushConfig(c)
+	w.Headers = c.headers()
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes the config, moving well-known headers into their typed fields.
+func (c *WebpushConfig) UnmarshalJSON(data []byte) error {
+	var w webpushConfig
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+
+	headers := make(map[string]string, len(w.Headers))
+	for k, v := range w.Headers {
+		switch {
+		case strings.EqualFold(k, headerWebpushTTL):
+			seconds, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s header %q", headerWebpushTTL, v)
+			}
+			ttl := time.Duration(seconds) * time.Second
+			w.TTL = &ttl
+		case strings.EqualFold(k, headerWebpushUrgency):
+			w.Urgency = WebpushUrgency(v)
+		default:
+			headers[k] = v
+		}
+	}
+	w.Headers = nil
+	if len(headers) > 0 {
+		w.Headers = headers
+	}
+
+	*c = WebpushConfig(w)
+	return nil
+}
+
+// headers returns Headers with the typed header fields applied.
+func (c *WebpushConfig) headers() map[string]string {
+	headers := make(map[string]string, len(c.Headers)+2)
+	for k, v := range c.Headers {
+		headers[k] = v
+	}
+	if c.TTL != nil {
+		headers[headerWebpushTTL] = strconv.FormatInt(int64(*c.TTL/time.Second), 10)
+	}
+	if c.Urgency != "" {
+		headers[headerWebpushUrgency] = string(c.Urgency)
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// Validate checks that the Web Push options are well formed.
+func (c *WebpushConfig) Validate() error {
+	for k := range c.Headers {
+		if strings.EqualFold(k, headerWebpushTTL) || strings.EqualFold(k, headerWebpushUrgency) {
+			return fmt.Errorf("%s header must be set through its typed field", k)
+		}
+	}
+	if c.TTL != nil {
+		if *c.TTL < 0 {
+			return fmt.Errorf("webpush ttl must not be negative")
+		}
+		if *c.TTL%time.Second != 0 {
+			return fmt.Errorf("webpush ttl must be a whole number of seconds")
+		}
+	}
+	switch c.Urgency {
+	case "", WebpushUrgencyVeryLow, WebpushUrgencyLow, WebpushUrgencyNormal, WebpushUrgencyHigh:
+	default:
+		return fmt.Errorf("webpush urgency must be very-low, low, normal or high, got %q", c.Urgency)
+	}
+	if c.Notification != nil {
+		if err := c.Notification.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.FcmOptions != nil {
+		return c.FcmOptions.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package fcm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestWebpushConfig_MarshalJSON(t *testing.T) {
+	config := WebpushConfig{
+		TTL:     durationPtr(time.Hour),
+		Urgency: WebpushUrgencyHigh,
+		Notification: &WebpushNotification{
+			Title:              "Order shipped",
+			Body:               "Your order is on its way",
+			Badge:              "https://example.com/badge.png",
+			Direction:          WebpushDirectionLeftToRight,
+			Language:           "en-US",
+			Tag:                "order-42",
+			Renotify:           true,
+			RequireInteraction: true,
+			Actions:            []WebpushNotificationAction{{Action: "track", Title: "Track"}},
+			Timestamp:          time.UnixMilli(1700000000123),
+			Vibrate:            []int{200, 100, 200},
+			Data:               map[string]interface{}{"order_id": "42"},
+		},
+		FcmOptions: &WebpushFcmOptions{Link: "https://example.com/orders/42"},
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"headers":{"TTL":"3600","Urgency":"high"},"notification":{"title":"Order shipped",` +
+		`"body":"Your order is on its way","badge":"https://example.com/badge.png","tag":"order-42",` +
+		`"dir":"ltr","lang":"en-US","renotify":true,"requireInteraction":true,` +
+		`"actions":[{"action":"track","title":"Track"}],"vibrate":[200,100,200],"data":{"order_id":"42"},` +
+		`"timestamp":1700000000123},"fcm_options":{"link":"https://example.com/orders/42"}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var decoded WebpushConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !decoded.Notification.Timestamp.Equal(config.Notification.Timestamp) {
+		t.Errorf("expected timestamp %v, got %v", config.Notification.Timestamp, decoded.Notification.Timestamp)
+	}
+	decoded.Notification.Timestamp = config.Notification.Timestamp
+	if !reflect.DeepEqual(decoded, config) {
+		t.Errorf("expected round trip to produce %+v, got %+v", config, decoded)
+	}
+}
+
+func TestWebpushConfig_ZeroTTL(t *testing.T) {
+	data, err := json.Marshal(WebpushConfig{TTL: durationPtr(0)})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected := `{"headers":{"TTL":"0"}}`; string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var decoded WebpushConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if decoded.TTL == nil || *decoded.TTL != 0 {
+		t.Errorf("expected a zero TTL, got %v", decoded.TTL)
+	}
+}
+
+func TestWebpushNotification_CustomData(t *testing.T) {
+	notification := WebpushNotification{
+		Title:      "Hello",
+		CustomData: map[string]interface{}{"x-campaign": "spring"},
+	}
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"title":"Hello","x-campaign":"spring"}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var decoded WebpushNotification
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(decoded, notification) {
+		t.Errorf("expected round trip to produce %+v, got %+v", notification, decoded)
+	}
+}
+
+func TestWebpushNotification_CustomDataNumbers(t *testing.T) {
+	data := []byte(`{"title":"Hello","data":{"order_id":9007199254740993},"x-id":9007199254740993,"x-options":{"b":1,"a":2}}`)
+
+	var notification WebpushNotification
+	if err := json.Unmarshal(data, &notification); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	encoded, err := json.Marshal(notification)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(string(encoded), `"x-id":9007199254740993`) {
+		t.Errorf("expected the large integer to be preserved, got %s", encoded)
+	}
+	if !strings.Contains(string(encoded), `"data":{"order_id":9007199254740993}`) {
+		t.Errorf("expected the large integer of data to be preserved, got %s", encoded)
+	}
+
+	encoded, err = json.Marshal(WebpushNotification{Title: "Hello", CustomData: map[string]interface{}{
+		"x-id": uint64(1<<63 + 1), "x-b": 1, "x-a": 2,
+	}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `{"title":"Hello","x-a":2,"x-b":1,"x-id":9223372036854775809}`
+	if string(encoded) != expected {
+		t.Errorf("expected %s, got %s", expected, encoded)
+	}
+}
+
+func TestWebpushConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     WebpushConfig
+		expectsErr bool
+	}{
+		{name: "empty", config: WebpushConfig{}},
+		{name: "https link", config: WebpushConfig{FcmOptions: &WebpushFcmOptions{Link: "https://example.com"}}},
+		{name: "http link", config: WebpushConfig{FcmOptions: &WebpushFcmOptions{Link: "http://example.com"}}, expectsErr: true},
+		{name: "relative link", config: WebpushConfig{FcmOptions: &WebpushFcmOptions{Link: "/orders"}}, expectsErr: true},
+		{name: "zero ttl", config: WebpushConfig{TTL: durationPtr(0)}},
+		{name: "negative ttl", config: WebpushConfig{TTL: durationPtr(-time.Second)}, expectsErr: true},
+		{name: "fractional ttl", config: WebpushConfig{TTL: durationPtr(1500 * time.Millisecond)}, expectsErr: true},
+		{name: "valid urgency", config: WebpushConfig{Urgency: WebpushUrgencyVeryLow}},
+		{name: "unknown urgency", config: WebpushConfig{Urgency: "urgent"}, expectsErr: true},
+		{name: "ttl in headers map", config: WebpushConfig{Headers: map[string]string{"ttl": "60"}}, expectsErr: true},
+		{name: "unknown dir", config: WebpushConfig{Notification: &WebpushNotification{Direction: "up"}}, expectsErr: true},
+		{name: "renotify without tag", config: WebpushConfig{Notification: &WebpushNotification{Renotify: true}}, expectsErr: true},
+		{
+			name:       "silent with vibrate",
+			config:     WebpushConfig{Notification: &WebpushNotification{Silent: true, Vibrate: []int{100}}},
+			expectsErr: true,
+		},
+		{
+			name:       "action without title",
+			config:     WebpushConfig{Notification: &WebpushNotification{Actions: []WebpushNotificationAction{{Action: "open"}}}},
+			expectsErr: true,
+		},
+		{
+			name:       "custom data shadowing a known option",
+			config:     WebpushConfig{Notification: &WebpushNotification{CustomData: map[string]interface{}{"title": "x"}}},
+			expectsErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.expectsErr && err == nil {
+				t.Errorf("expected error, got nil")
+			} else if !tc.expectsErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}